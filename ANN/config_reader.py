@@ -1,10 +1,49 @@
 import yaml
 import os
+import re
+
+
+# Числовые типы, пригодные для обучения (BOOL исключён)
+NUMERIC_TYPES = {
+    'sint', 'int', 'dint', 'lint', 'usint', 'uint', 'udint', 'ulint', 'real', 'lreal',
+    'int8', 'int16', 'int32', 'int64', 'uint8', 'uint16', 'uint32', 'uint64', 'float32', 'float64',
+}
+
+
+def tag_series(tag_name, tag_config):
+    """
+    Возвращает имена рядов тега по правилу config.ParseArrayTag: массив
+    задаётся диапазоном в имени (Temps[0..15]) или полем elements (Temps или
+    Temps[4] — индекс первого элемента) и пишется поэлементно (Temps[0], ...)
+    """
+    elements = int(tag_config.get('elements') or 0)
+    match = re.fullmatch(r'(.*)\[([^\[\]]*)\]', tag_name)
+
+    if match and '..' in match.group(2):
+        first, last = match.group(2).split('..', 1)
+        start, end = int(first), int(last)
+        if start < 0 or end < start:
+            raise ValueError(f"тег {tag_name}: некорректный диапазон элементов")
+        if elements and elements != end - start + 1:
+            raise ValueError(f"тег {tag_name}: elements не совпадает с диапазоном")
+        base, count = match.group(1), end - start + 1
+    elif elements == 0:
+        return [tag_name]
+    elif elements < 0:
+        raise ValueError(f"тег {tag_name}: отрицательное число элементов")
+    elif match:
+        base, start, count = match.group(1), int(match.group(2)), elements
+        if start < 0:
+            raise ValueError(f"тег {tag_name}: некорректный индекс первого элемента")
+    else:
+        base, start, count = tag_name, 0, elements
+
+    return [f"{base}[{i}]" for i in range(start, start + count)]
 
 
 def load_tags_from_yaml(file_path='configs/tags.yaml'):
     """
-    Загружает список тегов из YAML-файла конфигурации с валидацией
+    Загружает список рядов тегов (PLC/тег) из YAML-файла конфигурации с валидацией
     """
     if not os.path.exists(file_path):
         raise FileNotFoundError(f"Файл конфигурации не найден: {file_path}")
@@ -26,11 +65,18 @@ def load_tags_from_yaml(file_path='configs/tags.yaml'):
             excluded_tags.append(tag_name)
             continue
 
-        # Проверяем, что тег имеет правильный тип
-        if tag_config.get('type') in ['float32', 'float64', 'int32', 'int16']:
-            tags.append(tag_name)
-        else:
+        # Проверяем, что тег имеет правильный тип (имя Logix или Go, как в internal/datatype).
+        # В БД ряд тега называется PLC/тег, у массива — PLC/тег[i] для каждого элемента
+        if str(tag_config.get('type', '')).lower() not in NUMERIC_TYPES:
             excluded_tags.append(tag_name)
+            continue
+        try:
+            series = tag_series(tag_name, tag_config)
+        except ValueError as e:
+            print(f"Ошибка в описании тега: {e}")
+            excluded_tags.append(tag_name)
+            continue
+        tags.extend(f"{tag_config.get('plc')}/{name}" for name in series)
 
     print(f"Загружено тегов: {len(tags)}")
     print(f"Исключено тегов: {len(excluded_tags)}")
@@ -13,10 +13,15 @@ from config_reader import load_tags_from_yaml
 # ]
 TAGS = load_tags_from_yaml('../configs/tags.yaml')
 
+# База сборщика (database.database в конфигурации + plc_data.db);
+# для имитации (configs/sim.yaml) — '../data-sim/plc_data.db'
+DB_PATH = '../data/plc_data.db'
+
 
 def fetch_plc_data(start_time: Union[str, pd.Timestamp, datetime, int],
                    end_time: Union[str, pd.Timestamp, datetime, int],
-                   tags: List[str] = TAGS) -> pd.DataFrame:
+                   tags: List[str] = TAGS,
+                   db_path: str = DB_PATH) -> pd.DataFrame:
     """
     Извлекает данные из БД за указанный период
 
@@ -28,6 +33,7 @@ def fetch_plc_data(start_time: Union[str, pd.Timestamp, datetime, int],
                    - int: Unix timestamp в наносекундах (прямой вход в БД)
         end_time: Конечное время (аналогичные форматы)
         tags: Список тегов для извлечения
+        db_path: Путь к файлу базы SQLite
 
     Returns:
         pd.DataFrame: DataFrame с данными в широком формате
@@ -48,7 +54,7 @@ def fetch_plc_data(start_time: Union[str, pd.Timestamp, datetime, int],
     print(f"Запрос данных: {pd.Timestamp(start_ns)} -> {pd.Timestamp(end_ns)}")
 
     # Далее ваш существующий код...
-    conn = sqlite3.connect('../data/plc_data.db')
+    conn = sqlite3.connect(db_path)
 
     query = f"""
     SELECT timestamp_ns, tag_name, value 
@@ -61,10 +67,28 @@ def fetch_plc_data(start_time: Union[str, pd.Timestamp, datetime, int],
 
     params = tags + [start_ns, end_ns]
     df = pd.read_sql_query(query, conn, params=params)
+
+    # Теги с записью по исключению (deadband/heartbeat) сохраняются только
+    # при изменении: значение на начало диапазона — последняя запись до него
+    initial_query = f"""
+    SELECT ? AS timestamp_ns, tag_name, value
+    FROM numeric_time_series AS t
+    WHERE tag_name IN ({','.join('?' * len(tags))})
+    AND quality = 0
+    AND timestamp_ns = (
+        SELECT MAX(timestamp_ns) FROM numeric_time_series
+        WHERE tag_name = t.tag_name AND timestamp_ns < ? AND quality = 0
+    )
+    """
+    initial = pd.read_sql_query(initial_query, conn, params=[start_ns] + tags + [start_ns])
     conn.close()
 
-    # Преобразуем в широкий формат
-    df_wide = df.pivot(index='timestamp_ns', columns='tag_name', values='value')
+    df = pd.concat([initial, df], ignore_index=True)
+
+    # Преобразуем в широкий формат и восстанавливаем ступенчатые ряды
+    # (запись ровно в начале диапазона важнее перенесённой)
+    df_wide = df.pivot_table(index='timestamp_ns', columns='tag_name', values='value', aggfunc='last')
+    df_wide = df_wide.sort_index().ffill()
     df_wide.index = pd.to_datetime(df_wide.index)
 
     return df_wide
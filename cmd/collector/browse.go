@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/plc"
+)
+
+// runBrowse выполняет подкоманду browse: получает список тегов ПЛК и
+// выводит его таблицей или готовой секцией tags для tags.yaml.
+//
+//	collector browse -config configs/tags.yaml -plc JAR24 -filter "TT*,PT*" -type REAL
+func runBrowse(args []string) int {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	var configPath, plcName, filter, types, program, outPath, logLevel string
+	var list bool
+	fs.StringVar(&configPath, "config", "", "Путь к файлу конфигурации (tags.yaml)")
+	fs.StringVar(&plcName, "plc", "", "Имя ПЛК из секции plcs (можно не указывать, если ПЛК один)")
+	fs.StringVar(&filter, "filter", "", "Шаблоны имён через запятую, например TT*,Pump_?")
+	fs.StringVar(&types, "type", "", "Типы данных через запятую, например REAL,DINT")
+	fs.StringVar(&program, "program", "", "Область: имя программы или controller; по умолчанию все")
+	fs.StringVar(&outPath, "out", "", "Файл для секции tags (по умолчанию stdout)")
+	fs.StringVar(&logLevel, "loglevel", "warn", "Уровень логирования: debug, info, warn, error")
+	fs.BoolVar(&list, "list", false, "Вывести таблицу тегов вместо YAML")
+	fs.Parse(args)
+
+	if err := logging.InitStderr(logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка инициализации логгера:", err)
+		return 1
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		logging.Error("Ошибка загрузки конфигурации", "error", err)
+		return 1
+	}
+
+	if plcName == "" {
+		if len(cfg.PLCs) != 1 {
+			logging.Error("Укажите ПЛК флагом -plc", "всего ПЛК", len(cfg.PLCs))
+			return 1
+		}
+		for name := range cfg.PLCs {
+			plcName = name
+		}
+	}
+	plcConfig, exists := cfg.PLCs[plcName]
+	if !exists {
+		logging.Error("ПЛК не найден в конфигурации", "PLC", plcName)
+		return 1
+	}
+
+	tags, err := plc.BrowseTags(plcName, plcConfig)
+	if err != nil {
+		logging.Error("Ошибка просмотра тегов", "PLC", plcName, "error", err)
+		return 1
+	}
+
+	return writeTags(tags, plcName, tagFilter{Program: program, Names: filter, Types: types}, outPath, list)
+}
+
+// tagFilter отбирает теги по области, шаблонам имён и типам данных
+type tagFilter struct {
+	Program string // Имя программы или controller; пусто — все
+	Names   string // Шаблоны имён через запятую
+	Types   string // Типы данных через запятую
+}
+
+func (f tagFilter) apply(tags []browse.Tag) []browse.Tag {
+	patterns := splitList(f.Names)
+	types := splitList(f.Types)
+
+	var selected []browse.Tag
+	for _, tag := range tags {
+		if !matchScope(tag, f.Program) || !matchPatterns(tag, patterns) {
+			continue
+		}
+		if len(types) > 0 && !slices.Contains(types, strings.ToLower(tag.Type)) {
+			continue
+		}
+		selected = append(selected, tag)
+	}
+	return selected
+}
+
+// splitList разбирает список через запятую в нижнем регистре
+func splitList(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, strings.ToLower(item))
+		}
+	}
+	return result
+}
+
+// writeTags отбирает теги фильтром и выводит их таблицей (list) или
+// секцией tags для tags.yaml в файл outPath либо в stdout
+func writeTags(tags []browse.Tag, plcName string, filter tagFilter, outPath string, list bool) int {
+	selected := filter.apply(tags)
+
+	out := io.Writer(os.Stdout)
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			logging.Error("Ошибка создания файла", "path", outPath, "error", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if list {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ТЕГ\tТИП\tРАЗМЕРНОСТЬ\tОБЛАСТЬ\tОПИСАНИЕ")
+		for _, tag := range selected {
+			scope := tag.Program
+			if scope == "" {
+				scope = "controller"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tag.Name, tag.Type, formatDimensions(tag.Dimensions), scope, tag.Description)
+		}
+		w.Flush()
+		return 0
+	}
+
+	section := make(map[string]config.TagConfig)
+	skipped := 0
+	for _, tag := range selected {
+		name, tagConfig, ok := tag.TagConfig(plcName)
+		if !ok {
+			logging.Warn("Тег пропущен: тип не поддерживается сборщиком", "tag", tag.Name,
+				"type", tag.Type, "размерность", formatDimensions(tag.Dimensions))
+			skipped++
+			continue
+		}
+		section[name] = tagConfig
+	}
+
+	data, err := config.MarshalTags(section)
+	if err != nil {
+		logging.Error("Ошибка формирования секции tags", "error", err)
+		return 1
+	}
+	if _, err := out.Write(data); err != nil {
+		logging.Error("Ошибка записи секции tags", "error", err)
+		return 1
+	}
+	logging.Info("Секция tags сформирована", "PLC", plcName, "тегов", len(section), "пропущено", skipped)
+	return 0
+}
+
+// matchScope проверяет область тега: controller — теги контроллера,
+// иначе имя программы без учёта регистра
+func matchScope(tag browse.Tag, program string) bool {
+	switch {
+	case program == "":
+		return true
+	case strings.EqualFold(program, "controller"):
+		return tag.Program == ""
+	default:
+		return strings.EqualFold(program, tag.Program)
+	}
+}
+
+// matchPatterns сравнивает имя тега с шаблонами. У программных тегов
+// шаблон проверяется и по полному имени, и по имени внутри программы.
+func matchPatterns(tag browse.Tag, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	full := strings.ToLower(tag.Name)
+	short := full
+	if i := strings.Index(full, "."); tag.Program != "" && i >= 0 {
+		short = full[i+1:]
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, full); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, short); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func formatDimensions(dims []int) string {
+	if len(dims) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(dims))
+	for i, d := range dims {
+		parts[i] = fmt.Sprint(d)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"plc_tsdb/internal/l5x"
+	"plc_tsdb/internal/logging"
+)
+
+// runL5X выполняет подкоманду l5x: разбирает экспорт проекта и выводит
+// теги таблицей или секцией tags для tags.yaml. Подключение к ПЛК не нужно.
+//
+//	collector l5x -file JAR24.L5X -plc JAR24 -program MainProgram -type REAL -out tags_jar24.yaml
+func runL5X(args []string) int {
+	fs := flag.NewFlagSet("l5x", flag.ExitOnError)
+	var filename, plcName, filter, types, program, outPath, logLevel string
+	var list bool
+	fs.StringVar(&filename, "file", "", "Путь к файлу экспорта проекта (.L5X)")
+	fs.StringVar(&plcName, "plc", "", "Имя ПЛК для поля plc (как в секции plcs)")
+	fs.StringVar(&filter, "filter", "", "Шаблоны имён через запятую, например TT*,Pump_?")
+	fs.StringVar(&types, "type", "", "Типы данных через запятую, например REAL,DINT")
+	fs.StringVar(&program, "program", "", "Область: имя программы или controller; по умолчанию все")
+	fs.StringVar(&outPath, "out", "", "Файл для секции tags (по умолчанию stdout)")
+	fs.StringVar(&logLevel, "loglevel", "warn", "Уровень логирования: debug, info, warn, error")
+	fs.BoolVar(&list, "list", false, "Вывести таблицу тегов вместо YAML")
+	fs.Parse(args)
+
+	if err := logging.InitStderr(logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка инициализации логгера:", err)
+		return 1
+	}
+	if filename == "" || plcName == "" {
+		logging.Error("Укажите файл экспорта флагом -file и имя ПЛК флагом -plc")
+		return 1
+	}
+
+	tags, err := l5x.Load(filename)
+	if err != nil {
+		logging.Error("Ошибка чтения L5X", "path", filename, "error", err)
+		return 1
+	}
+
+	return writeTags(tags, plcName, tagFilter{Program: program, Names: filter, Types: types}, outPath, list)
+}
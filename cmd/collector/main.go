@@ -12,6 +12,16 @@ import (
 )
 
 func main() {
+	// Подкоманды генерации секции tags: browse — по тегам ПЛК, l5x — по экспорту проекта
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "browse":
+			os.Exit(runBrowse(os.Args[2:]))
+		case "l5x":
+			os.Exit(runL5X(os.Args[2:]))
+		}
+	}
+
 	var configPath, logDir, logLevel string
 	flag.StringVar(&configPath, "config", "", "Путь к файлу конфигурации (tags.yaml)")
 	flag.StringVar(&logDir, "logdir", "", "Каталог для логов (по умолчанию stdout/stderr)")
@@ -32,6 +42,10 @@ func main() {
 		logging.Error("Ошибка загрузки конфигурации", "error", err)
 		os.Exit(1)
 	}
+	if err := cfg.Validate(); err != nil {
+		logging.Error("Ошибка в конфигурации", "error", err)
+		os.Exit(1)
+	}
 	logging.Info("Конфигурация успешно загружена", "path", configPath)
 
 	// Создаём необходимые директории
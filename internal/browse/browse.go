@@ -0,0 +1,48 @@
+// Package browse описывает теги, найденные при просмотре ПЛК или в экспорте
+// проекта, и переводит их в записи секции tags для подготовки tags.yaml.
+package browse
+
+import "plc_tsdb/internal/config"
+
+// Tag описание тега, полученное при просмотре ПЛК или из экспорта проекта
+type Tag struct {
+	Name       string // Имя для конфигурации: Tag или Program:Main.Tag
+	Program    string // Программа, для тегов контроллера — пусто
+	Type       string // Имя Logix атомарного типа или имя UDT
+	Dimensions []int  // Размерности массива, для скаляра — пусто
+	Atomic     bool   // Тип есть в реестре атомарных типов
+	Struct     bool   // Тег — экземпляр структуры
+
+	Address string // Адрес в источнике (NodeId OPC UA); для Logix — пусто
+
+	Description string // Описание (есть только в экспорте проекта)
+	Unit        string // Единица измерения (есть только в экспорте проекта)
+}
+
+// TagConfig возвращает конфигурацию тега для секции tags.
+// ok=false, если тег нельзя опрашивать (многомерный массив, массив
+// структур или неподдерживаемый тип).
+func (t Tag) TagConfig(plcName string) (string, config.TagConfig, bool) {
+	tagConfig := config.TagConfig{
+		PLC:         plcName,
+		Type:        t.Type,
+		Address:     t.Address,
+		Description: t.Description,
+		Unit:        t.Unit,
+	}
+
+	switch {
+	case len(t.Dimensions) > 1:
+		return "", tagConfig, false
+	case t.Struct:
+		if len(t.Dimensions) > 0 {
+			return "", tagConfig, false
+		}
+		tagConfig.Members = []string{"*"}
+	case !t.Atomic:
+		return "", tagConfig, false
+	case len(t.Dimensions) == 1:
+		tagConfig.Elements = t.Dimensions[0]
+	}
+	return t.Name, tagConfig, true
+}
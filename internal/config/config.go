@@ -1,46 +1,518 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"plc_tsdb/internal/datatype"
+
 	"gopkg.in/yaml.v3"
 )
 
+// Драйверы обмена с ПЛК (поле driver)
+const (
+	DriverLogix  = "logix"  // ControlLogix/CompactLogix по EtherNet/IP, по умолчанию
+	DriverModbus = "modbus" // Modbus TCP
+	DriverOPCUA  = "opcua"  // OPC UA TCP без шифрования
+	DriverSim    = "sim"    // Имитация: значения тегов от генераторов, без ПЛК
+)
+
+// Генераторы значений тегов ПЛК с driver: sim (поле sim.generator)
+const (
+	SimSine       = "sine"        // Синусоида между min и max с периодом period
+	SimRamp       = "ramp"        // Пила: рост от min до max за period
+	SimSquare     = "square"      // Меандр: max в течение доли duty периода, затем min
+	SimRandomWalk = "random_walk" // Случайное блуждание в [min, max]
+	SimNoise      = "noise"       // Независимые значения, равномерно в [min, max]
+	SimStep       = "step"        // Скачки между уровнями в среднем раз в period
+)
+
+// Порядок регистров в 32- и 64-битных значениях Modbus (поле word_order)
+const (
+	WordOrderHighFirst = "high_first" // Первый регистр — старшее слово, по умолчанию
+	WordOrderLowFirst  = "low_first"  // Первый регистр — младшее слово
+)
+
 // PLCConfig представляет конфигурацию одного ПЛК
 type PLCConfig struct {
-	Host string `yaml:"host"`
-	Slot int    `yaml:"slot"`
+	Driver string `yaml:"driver,omitempty"` // Протокол обмена, см. Driver*; пусто — logix
+
+	Host string  `yaml:"host"`           // Для opcua не используется, см. endpoint
+	Slot int     `yaml:"slot"`           // Слот процессора в шасси (маршрут 1,<slot>)
+	Path *string `yaml:"path,omitempty"` // Полный маршрут CIP, заменяет slot: "1,2,2,10.0.0.5,1,0"; "" — без маршрута
+
+	// Предел одновременных соединений к устройству host (0 — без ограничения).
+	// Записи с одинаковыми host и маршрутом используют одно соединение, но
+	// каждому процессору (слоту) за устройством нужно своё. Если процессоров
+	// больше предела, они опрашиваются по очереди: соединение открывается
+	// заново при каждом обмене, а чтение ждёт свободного места до дедлайна
+	// опроса.
+	MaxConnections int `yaml:"max_connections,omitempty"`
+
+	// Тег DINT со временем скана в мкс (заполняется в программе через GSV
+	// Task LastScanTime); пишется в ряд <ПЛК>/$diag/scan_time
+	ScanTimeTag string `yaml:"scan_time_tag,omitempty"`
+
+	// Теги DINT с типом и кодом последней серьёзной и незначительной ошибки
+	// (заполняются в программе через GSV Program/Controller MajorFaultRecord и
+	// MinorFaultRecord); пишутся в ряды <ПЛК>/$diag/major_fault_type и т.д.
+	MajorFaultTypeTag string `yaml:"major_fault_type_tag,omitempty"`
+	MajorFaultCodeTag string `yaml:"major_fault_code_tag,omitempty"`
+	MinorFaultTypeTag string `yaml:"minor_fault_type_tag,omitempty"`
+	MinorFaultCodeTag string `yaml:"minor_fault_code_tag,omitempty"`
+
+	// Параметры Modbus TCP (driver: modbus)
+	Port         int    `yaml:"port,omitempty"`          // Порт, по умолчанию 502
+	UnitID       *int   `yaml:"unit_id,omitempty"`       // Номер устройства за шлюзом, по умолчанию 1
+	WordOrder    string `yaml:"word_order,omitempty"`    // Порядок регистров: high_first (по умолчанию) или low_first
+	ByteSwap     bool   `yaml:"byte_swap,omitempty"`     // Байты в регистре переставлены
+	MaxRegisters int    `yaml:"max_registers,omitempty"` // Предел регистров в одном запросе (по умолчанию 125)
+
+	// Параметры OPC UA (driver: opcua). Без username вход анонимный.
+	Endpoint        string        `yaml:"endpoint,omitempty"`         // Адрес сервера: opc.tcp://host:4840/path
+	Username        string        `yaml:"username,omitempty"`         // Имя пользователя
+	Password        string        `yaml:"password,omitempty"`         // Пароль (передаётся без шифрования)
+	Subscribe       bool          `yaml:"subscribe,omitempty"`        // Получать значения подпиской вместо опроса
+	PublishInterval time.Duration `yaml:"publish_interval,omitempty"` // Интервал публикации подписки, по умолчанию 1s
+
+	// Параметры имитации (driver: sim). Зёрна генераторов тегов выводятся
+	// из seed и имени ряда, поэтому запуски с одним seed повторяемы.
+	Seed int64 `yaml:"seed,omitempty"`
+}
+
+// DriverName возвращает драйвер ПЛК с учётом значения по умолчанию
+func (p PLCConfig) DriverName() string {
+	if p.Driver == "" {
+		return DriverLogix
+	}
+	return strings.ToLower(p.Driver)
+}
+
+// ModbusUnitID возвращает номер устройства Modbus с учётом значения по умолчанию
+func (p PLCConfig) ModbusUnitID() uint8 {
+	if p.UnitID == nil {
+		return 1
+	}
+	return uint8(*p.UnitID)
+}
+
+// CIPPath возвращает маршрут CIP до процессора: явно заданный path
+// или объединительная плата (порт 1) и слот
+func (p PLCConfig) CIPPath() string {
+	if p.Path != nil {
+		return *p.Path
+	}
+	return fmt.Sprintf("1,%d", p.Slot)
+}
+
+// validateSimTag проверяет генератор тега имитируемого ПЛК
+func validateSimTag(tagName string, tagConfig TagConfig) error {
+	if tagConfig.IsStruct() {
+		return fmt.Errorf("тег %s: структуры не поддерживаются драйвером sim", tagName)
+	}
+	if tagConfig.Address != "" {
+		return fmt.Errorf("тег %s: address не задаётся для ПЛК с driver: sim", tagName)
+	}
+	if tagConfig.Sim == nil {
+		return fmt.Errorf("тег %s: не указан генератор sim", tagName)
+	}
+	if _, isArray, _ := ParseArrayTag(tagName, tagConfig); isArray && tagConfig.Writable {
+		return fmt.Errorf("тег %s: массив имитируемого ПЛК не записывается, задайте уставку отдельным тегом", tagName)
+	}
+	if err := tagConfig.Sim.validate(); err != nil {
+		return fmt.Errorf("тег %s: sim: %w", tagName, err)
+	}
+	return nil
+}
+
+// ValidateCIPPath проверяет маршрут CIP вида "порт,адрес,порт,адрес...".
+// Порт — номер 1..14 (1 — объединительная плата, 2 — порт Ethernet модуля),
+// адрес — слот 0..255 или IP-адрес для перехода через сетевой модуль.
+func ValidateCIPPath(path string) error {
+	path = strings.NewReplacer(" ", "", "[", "", "]", "").Replace(path)
+	if path == "" {
+		return nil
+	}
+
+	parts := strings.Split(path, ",")
+	if len(parts)%2 != 0 {
+		return fmt.Errorf("маршрут %q: нужны пары порт,адрес", path)
+	}
+	for i := 0; i < len(parts); i += 2 {
+		port, err := strconv.Atoi(parts[i])
+		if err != nil || port < 1 || port > 14 {
+			return fmt.Errorf("маршрут %q: некорректный номер порта %q (допустимо 1..14)", path, parts[i])
+		}
+		link := parts[i+1]
+		if strings.Contains(link, ".") {
+			if ip := net.ParseIP(link); ip == nil || ip.To4() == nil {
+				return fmt.Errorf("маршрут %q: некорректный IP-адрес %q", path, link)
+			}
+			continue
+		}
+		if address, err := strconv.Atoi(link); err != nil || address < 0 || address > 255 {
+			return fmt.Errorf("маршрут %q: некорректный адрес %q (слот 0..255 или IP)", path, link)
+		}
+	}
+	return nil
 }
 
 // TagConfig представляет конфигурацию тега
 type TagConfig struct {
-	PLC         string  `yaml:"plc"`                    // Имя ПЛК из секции plcs
-	Type        string  `yaml:"type"`                   // Тип данных
-	Description string  `yaml:"description"`            // Описание
-	Unit        string  `yaml:"unit,omitempty"`         // Единица измерения
-	ScaleFactor float64 `yaml:"scale_factor,omitempty"` // Коэффициент масштабирования
+	PLC         string   `yaml:"plc"`                    // Имя ПЛК из секции plcs
+	Type        string   `yaml:"type"`                   // Тип данных: имя Logix (REAL, DINT, ...) или Go (float32, int32, ...)
+	Description string   `yaml:"description"`            // Описание
+	Unit        string   `yaml:"unit,omitempty"`         // Единица измерения
+	ScaleFactor float64  `yaml:"scale_factor,omitempty"` // Коэффициент масштабирования
+	EngMin      *float64 `yaml:"eng_min,omitempty"`      // Нижняя граница инженерного диапазона
+	EngMax      *float64 `yaml:"eng_max,omitempty"`      // Верхняя граница инженерного диапазона
+	ScanClass   string   `yaml:"scan_class,omitempty"`   // Класс опроса из секции scan_classes
+	Elements    int      `yaml:"elements,omitempty"`     // Число элементов, если тег — массив
+	Members     []string `yaml:"members,omitempty"`      // Члены структуры (UDT) или "*" для всех атомарных
+	Address     string   `yaml:"address,omitempty"`      // Адрес Modbus (hr:100, ir:0, coil:5, di:7, 40101) или NodeId OPC UA (ns=2;s=Line1.Speed)
+
+	// Запись по исключению: значение сохраняется, только если изменилось
+	// больше зоны нечувствительности или истёк интервал heartbeat
+	Deadband        float64       `yaml:"deadband,omitempty"`         // Абсолютная зона нечувствительности
+	DeadbandPercent float64       `yaml:"deadband_percent,omitempty"` // Зона в % от инженерного диапазона (или от значения)
+	Heartbeat       time.Duration `yaml:"heartbeat,omitempty"`        // Максимальный интервал между записями
+
+	// Запись в ПЛК (уставки): разрешена только тегам с writable: true,
+	// значение в инженерных единицах должно лежать в [write_min, write_max]
+	Writable bool     `yaml:"writable,omitempty"`
+	WriteMin *float64 `yaml:"write_min,omitempty"`
+	WriteMax *float64 `yaml:"write_max,omitempty"`
+
+	// Генератор значений для ПЛК с driver: sim
+	Sim *SimConfig `yaml:"sim,omitempty"`
+}
+
+// SimConfig генератор значений тега имитируемого ПЛК. К значению генератора
+// добавляется шум noise, поверх — отказы: залипание, обрыв и пропадание.
+type SimConfig struct {
+	Generator string        `yaml:"generator"`        // Генератор, см. Sim*
+	Min       float64       `yaml:"min"`              // Нижняя граница значений
+	Max       float64       `yaml:"max"`              // Верхняя граница значений
+	Period    time.Duration `yaml:"period,omitempty"` // Период sine, ramp, square; средний интервал между скачками step
+	Phase     time.Duration `yaml:"phase,omitempty"`  // Сдвиг sine, ramp, square по времени
+	Duty      float64       `yaml:"duty,omitempty"`   // Доля периода square на max (0 — половина)
+	Step      float64       `yaml:"step,omitempty"`   // СКО приращения random_walk за секунду
+	Levels    []float64     `yaml:"levels,omitempty"` // Уровни step; без них — случайный уровень в [min, max]
+	Noise     float64       `yaml:"noise,omitempty"`  // СКО гауссова шума; значение с шумом не выходит за [min, max]
+	Seed      *int64        `yaml:"seed,omitempty"`   // Зерно тега вместо выведенного из seed ПЛК
+
+	Stuck    *SimFaultConfig `yaml:"stuck,omitempty"`    // Залипание: значение замирает на последнем
+	Flatline *SimFaultConfig `yaml:"flatline,omitempty"` // Обрыв датчика: значение равно value
+	Dropout  *SimFaultConfig `yaml:"dropout,omitempty"`  // Пропадание: тег не читается (comm_failure)
+}
+
+// SimFaultConfig отказ, который наступает в среднем раз в every и длится duration
+type SimFaultConfig struct {
+	Every    time.Duration `yaml:"every"`
+	Duration time.Duration `yaml:"duration"`
+	Value    float64       `yaml:"value,omitempty"` // Значение при обрыве (flatline)
+}
+
+// validate проверяет параметры генератора
+func (s SimConfig) validate() error {
+	switch s.Generator {
+	case SimSine, SimRamp, SimSquare, SimStep:
+		if s.Period <= 0 {
+			return fmt.Errorf("для генератора %s нужен положительный period", s.Generator)
+		}
+	case SimRandomWalk, SimNoise:
+	default:
+		return fmt.Errorf("неизвестный генератор %q (допустимы: %s, %s, %s, %s, %s, %s)",
+			s.Generator, SimSine, SimRamp, SimSquare, SimRandomWalk, SimNoise, SimStep)
+	}
+	if s.Min > s.Max {
+		return fmt.Errorf("min больше max")
+	}
+	if s.Period < 0 || s.Step < 0 || s.Noise < 0 {
+		return fmt.Errorf("period, step и noise не могут быть отрицательными")
+	}
+	if s.Duty < 0 || s.Duty >= 1 {
+		return fmt.Errorf("duty должен быть в [0, 1)")
+	}
+	if len(s.Levels) > 0 && s.Generator != SimStep {
+		return fmt.Errorf("levels задаются только для генератора %s", SimStep)
+	}
+	for name, fault := range map[string]*SimFaultConfig{"stuck": s.Stuck, "flatline": s.Flatline, "dropout": s.Dropout} {
+		if fault != nil && (fault.Every <= 0 || fault.Duration <= 0) {
+			return fmt.Errorf("%s: every и duration должны быть положительными", name)
+		}
+	}
+	return nil
+}
+
+// CheckWriteLimits проверяет, что значение можно записать в тег
+func (t TagConfig) CheckWriteLimits(value float64) error {
+	if t.WriteMin != nil && value < *t.WriteMin {
+		return fmt.Errorf("значение %v меньше write_min %v", value, *t.WriteMin)
+	}
+	if t.WriteMax != nil && value > *t.WriteMax {
+		return fmt.Errorf("значение %v больше write_max %v", value, *t.WriteMax)
+	}
+	return nil
+}
+
+// ReportByException сообщает, что для тега включена запись по исключению
+func (t TagConfig) ReportByException() bool {
+	return t.Deadband > 0 || t.DeadbandPercent > 0 || t.Heartbeat > 0
+}
+
+// DeadbandFor возвращает зону нечувствительности для значения относительно
+// последнего записанного last. Процентная зона считается от инженерного
+// диапазона, а если он не задан — от модуля last. Берётся большая из зон.
+func (t TagConfig) DeadbandFor(last float64) float64 {
+	deadband := t.Deadband
+	if t.DeadbandPercent > 0 {
+		base := math.Abs(last)
+		if t.EngMin != nil && t.EngMax != nil {
+			base = *t.EngMax - *t.EngMin
+		}
+		deadband = math.Max(deadband, base*t.DeadbandPercent/100)
+	}
+	return deadband
+}
+
+// IsStruct сообщает, что тег — экземпляр структуры, из которой читаются члены
+func (t TagConfig) IsStruct() bool {
+	return len(t.Members) > 0
+}
+
+// ArraySpec описывает диапазон элементов массива, читаемый одним запросом
+type ArraySpec struct {
+	Base  string // Имя массива без индекса
+	Start int    // Индекс первого элемента
+	Count int    // Число элементов
+}
+
+// ElementName возвращает имя элемента массива с индексом index
+func (a ArraySpec) ElementName(index int) string {
+	return fmt.Sprintf("%s[%d]", a.Base, index)
+}
+
+// ElementNames возвращает имена всех элементов диапазона
+func (a ArraySpec) ElementNames() []string {
+	names := make([]string, a.Count)
+	for i := range names {
+		names[i] = a.ElementName(a.Start + i)
+	}
+	return names
+}
+
+// ParseArrayTag определяет, описывает ли тег массив. Массив задаётся либо
+// диапазоном в имени (Temps[0..15]), либо полем elements (Temps с elements: 16
+// или Temps[4] с elements: 8 — восемь элементов начиная с четвёртого).
+func ParseArrayTag(tagName string, tagConfig TagConfig) (ArraySpec, bool, error) {
+	open := strings.LastIndex(tagName, "[")
+	hasIndex := open >= 0 && strings.HasSuffix(tagName, "]")
+
+	if hasIndex {
+		index := tagName[open+1 : len(tagName)-1]
+		if first, last, isRange := strings.Cut(index, ".."); isRange {
+			start, err1 := strconv.Atoi(strings.TrimSpace(first))
+			end, err2 := strconv.Atoi(strings.TrimSpace(last))
+			if err1 != nil || err2 != nil || start < 0 || end < start {
+				return ArraySpec{}, false, fmt.Errorf("тег %s: некорректный диапазон элементов", tagName)
+			}
+			if tagConfig.Elements != 0 && tagConfig.Elements != end-start+1 {
+				return ArraySpec{}, false, fmt.Errorf("тег %s: elements не совпадает с диапазоном", tagName)
+			}
+			return ArraySpec{Base: tagName[:open], Start: start, Count: end - start + 1}, true, nil
+		}
+	}
+
+	if tagConfig.Elements == 0 {
+		return ArraySpec{}, false, nil
+	}
+	if tagConfig.Elements < 0 {
+		return ArraySpec{}, false, fmt.Errorf("тег %s: отрицательное число элементов", tagName)
+	}
+
+	if !hasIndex {
+		return ArraySpec{Base: tagName, Start: 0, Count: tagConfig.Elements}, true, nil
+	}
+	start, err := strconv.Atoi(tagName[open+1 : len(tagName)-1])
+	if err != nil || start < 0 {
+		return ArraySpec{}, false, fmt.Errorf("тег %s: некорректный индекс первого элемента", tagName)
+	}
+	return ArraySpec{Base: tagName[:open], Start: start, Count: tagConfig.Elements}, true, nil
+}
+
+// TagSeries возвращает имена рядов, в которые сохраняется тег:
+// элементы массива по отдельности или сам тег. Для структур ряды зависят от
+// шаблона в контроллере и известны только после чтения, поэтому возвращается nil.
+func TagSeries(tagName string, tagConfig TagConfig) []string {
+	if tagConfig.IsStruct() {
+		return nil
+	}
+	if spec, isArray, err := ParseArrayTag(tagName, tagConfig); err == nil && isArray {
+		return spec.ElementNames()
+	}
+	return []string{tagName}
+}
+
+// InRange проверяет, что значение лежит в инженерном диапазоне тега.
+// Незаданные границы не ограничивают значение.
+func (t TagConfig) InRange(value float64) bool {
+	if t.EngMin != nil && value < *t.EngMin {
+		return false
+	}
+	if t.EngMax != nil && value > *t.EngMax {
+		return false
+	}
+	return true
 }
 
 // DatabaseConfig представляет конфигурацию БД
 type DatabaseConfig struct {
 	Type     string `yaml:"type"`
 	Database string `yaml:"database"` // Путь к БД
+
+	// Предельное время записи одного цикла; по умолчанию — таймаут из polling
+	WriteTimeout time.Duration `yaml:"write_timeout,omitempty"`
+
+	// Число циклов опроса в очереди на запись (0 — 256). Когда БД не
+	// успевает и очередь заполнена, новые циклы отбрасываются.
+	QueueSize int `yaml:"queue_size,omitempty"`
+}
+
+// GetWriteTimeout возвращает предельное время записи в БД (0 — без ограничения)
+func (c *Config) GetWriteTimeout() time.Duration {
+	if c.Database.WriteTimeout > 0 {
+		return c.Database.WriteTimeout
+	}
+	return c.Polling.Timeout
 }
 
 // PollingConfig представляет конфигурацию опроса
 type PollingConfig struct {
 	Interval time.Duration `yaml:"interval"`
 	Timeout  time.Duration `yaml:"timeout"`
+
+	StatsInterval time.Duration `yaml:"stats_interval,omitempty"` // Интервал вывода статистики опроса в лог (0 — 1m)
+
+	// Опрос на границах интервала по часам (:00.000, :00.250, ...) для всех
+	// классов опроса; значения помечаются временем по расписанию
+	Align bool `yaml:"align,omitempty"`
+
+	RecordLatency bool `yaml:"record_latency,omitempty"` // Писать ряд $scan/default/latency в каждом цикле
+}
+
+// DefaultScanClass имя класса опроса для тегов без scan_class.
+// Его интервал и таймаут берутся из секции polling.
+const DefaultScanClass = "default"
+
+// ScanClassConfig представляет класс опроса с собственной частотой
+type ScanClassConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+
+	// Писать время обмена с ПЛК рядом <ПЛК>/$scan/<класс>/latency в каждом
+	// цикле. Без него время чтения видно только в статистике опроса в логе.
+	RecordLatency bool `yaml:"record_latency,omitempty"`
+}
+
+// ReconnectConfig представляет параметры переподключения к ПЛК
+type ReconnectConfig struct {
+	InitialDelay time.Duration `yaml:"initial_delay"` // Первая задержка после ошибки
+	MaxDelay     time.Duration `yaml:"max_delay"`     // Верхняя граница задержки
+	Multiplier   float64       `yaml:"multiplier"`    // Множитель экспоненциального роста
+	Jitter       float64       `yaml:"jitter"`        // Доля случайного разброса (0..1)
+}
+
+// CircuitBreakerConfig представляет параметры отключения опроса ПЛК,
+// который подключен, но раз за разом не отвечает на чтение
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"` // Ошибок чтения подряд до размыкания (0 — 3)
+	ProbeInterval    time.Duration `yaml:"probe_interval"`    // Интервал пробных чтений разомкнутого ПЛК (0 — 30s)
+}
+
+// ClockConfig представляет параметры контроля часов контроллеров
+type ClockConfig struct {
+	Interval time.Duration `yaml:"interval"`  // Интервал чтения часов ПЛК (0 — часы не читаются)
+	MaxDrift time.Duration `yaml:"max_drift"` // Допустимое расхождение с часами хоста (0 — 1s)
+	Sync     bool          `yaml:"sync"`      // Устанавливать часы ПЛК по хосту при превышении max_drift
+}
+
+// DiagnosticsConfig представляет параметры опроса диагностики контроллеров
+type DiagnosticsConfig struct {
+	Interval time.Duration `yaml:"interval"` // Интервал опроса диагностики (0 — не опрашивается)
+}
+
+// MQTTConfig представляет источник данных MQTT: узлы Sparkplug B и/или
+// топики с JSON. Ряды называются <источник>/<группа>/<узел>[/<устройство>]/<метрика>
+// для Sparkplug и <источник>/<топик>/<поле> для JSON.
+type MQTTConfig struct {
+	Broker   string `yaml:"broker"`              // Адрес брокера: tcp://host:1883, ssl://host:8883
+	ClientID string `yaml:"client_id,omitempty"` // Идентификатор клиента, по умолчанию plc_tsdb-<источник>
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	Groups  []string `yaml:"groups,omitempty"`  // Группы Sparkplug B (group_id); "+" — все группы
+	HostID  string   `yaml:"host_id,omitempty"` // Публиковать STATE основного хоста с этим host_id
+	Rebirth *bool    `yaml:"rebirth,omitempty"` // Запрашивать перерождение узла при пропуске seq (по умолчанию да)
+	Topics  []string `yaml:"topics,omitempty"`  // Топики с JSON (допускаются + и #)
+
+	// Переименование рядов: имя без префикса источника (группа/узел/устройство/метрика
+	// или топик/поле) -> имя ряда целиком
+	Series map[string]string `yaml:"series,omitempty"`
+}
+
+// RequestsRebirth сообщает, запрашивать ли перерождение узлов Sparkplug
+func (m MQTTConfig) RequestsRebirth() bool {
+	return m.Rebirth == nil || *m.Rebirth
+}
+
+// validate проверяет параметры источника MQTT
+func (m MQTTConfig) validate() error {
+	if !strings.Contains(m.Broker, "://") {
+		return fmt.Errorf("некорректный broker %q: ожидается tcp://host:port", m.Broker)
+	}
+	if len(m.Groups) == 0 && len(m.Topics) == 0 {
+		return fmt.Errorf("не указаны groups (Sparkplug B) или topics (JSON)")
+	}
+	for _, group := range m.Groups {
+		if group == "" || group == "#" || (strings.ContainsAny(group, "+#/") && group != "+") {
+			return fmt.Errorf("некорректная группа Sparkplug %q", group)
+		}
+	}
+	for _, topic := range m.Topics {
+		if topic == "" {
+			return fmt.Errorf("пустой топик")
+		}
+	}
+	if m.HostID != "" && strings.ContainsAny(m.HostID, "+#/") {
+		return fmt.Errorf("некорректный host_id %q", m.HostID)
+	}
+	if m.Password != "" && m.Username == "" {
+		return fmt.Errorf("password задан без username")
+	}
+	return nil
 }
 
 // Config представляет полную конфигурацию
 type Config struct {
-	PLCs     map[string]PLCConfig `yaml:"plcs"` // Map ПЛК: имя -> конфиг
-	Tags     map[string]TagConfig `yaml:"tags"` // Map тегов: имя -> конфиг
-	Database DatabaseConfig       `yaml:"database"`
-	Polling  PollingConfig        `yaml:"polling"`
+	PLCs        map[string]PLCConfig       `yaml:"plcs"`         // Map ПЛК: имя -> конфиг
+	Tags        map[string]TagConfig       `yaml:"tags"`         // Map тегов: имя -> конфиг
+	ScanClasses map[string]ScanClassConfig `yaml:"scan_classes"` // Map классов опроса: имя -> конфиг
+	Database    DatabaseConfig             `yaml:"database"`
+	Polling     PollingConfig              `yaml:"polling"`
+	Reconnect   ReconnectConfig            `yaml:"reconnect"`
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Clock          ClockConfig          `yaml:"clock"`
+	Diagnostics    DiagnosticsConfig    `yaml:"diagnostics"`
+
+	MQTT map[string]MQTTConfig `yaml:"mqtt,omitempty"` // Источники MQTT: имя (префикс рядов) -> конфиг
 }
 
 // LoadConfig загружает конфигурацию из YAML файла
@@ -58,6 +530,22 @@ func LoadConfig(filename string) (*Config, error) {
 	return &config, nil
 }
 
+// MarshalTags формирует секцию tags для tags.yaml из описаний тегов
+func MarshalTags(tags map[string]TagConfig) ([]byte, error) {
+	section := struct {
+		Tags map[string]TagConfig `yaml:"tags"`
+	}{Tags: tags}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(section); err != nil {
+		return nil, fmt.Errorf("ошибка формирования YAML: %w", err)
+	}
+	encoder.Close()
+	return buf.Bytes(), nil
+}
+
 // GetPLCConfig возвращает конфигурацию ПЛК для тега
 func (c *Config) GetPLCConfig(tagName string) (*PLCConfig, error) {
 	tagConfig, exists := c.Tags[tagName]
@@ -84,15 +572,106 @@ func (c *Config) GetTagsByPLC(plcName string) map[string]TagConfig {
 	return result
 }
 
+// TagScanClass возвращает имя класса опроса тега с учётом значения по умолчанию
+func (t TagConfig) TagScanClass() string {
+	if t.ScanClass == "" {
+		return DefaultScanClass
+	}
+	return t.ScanClass
+}
+
+// GetScanClass возвращает конфигурацию класса опроса.
+// Класс default, если он не описан явно, берёт параметры из секции polling.
+func (c *Config) GetScanClass(name string) (ScanClassConfig, error) {
+	if scanClass, exists := c.ScanClasses[name]; exists {
+		if scanClass.Timeout == 0 {
+			scanClass.Timeout = c.Polling.Timeout
+		}
+		return scanClass, nil
+	}
+	if name == DefaultScanClass {
+		return ScanClassConfig{Interval: c.Polling.Interval, Timeout: c.Polling.Timeout, RecordLatency: c.Polling.RecordLatency}, nil
+	}
+	return ScanClassConfig{}, fmt.Errorf("класс опроса %s не найден", name)
+}
+
+// GetUsedScanClasses возвращает классы опроса, на которые ссылается хотя бы один тег
+func (c *Config) GetUsedScanClasses() map[string]ScanClassConfig {
+	result := make(map[string]ScanClassConfig)
+	for _, tagConfig := range c.Tags {
+		name := tagConfig.TagScanClass()
+		if _, done := result[name]; done {
+			continue
+		}
+		if scanClass, err := c.GetScanClass(name); err == nil {
+			result[name] = scanClass
+		}
+	}
+	return result
+}
+
+// GetTagsByPLCAndScanClass возвращает теги указанного ПЛК из указанного класса опроса
+func (c *Config) GetTagsByPLCAndScanClass(plcName, scanClass string) map[string]TagConfig {
+	result := make(map[string]TagConfig)
+	for tagName, tagConfig := range c.Tags {
+		if tagConfig.PLC == plcName && tagConfig.TagScanClass() == scanClass {
+			result[tagName] = tagConfig
+		}
+	}
+	return result
+}
+
 // Validate проверяет корректность конфигурации
 func (c *Config) Validate() error {
 	// Проверяем что есть ПЛК
-	if len(c.PLCs) == 0 {
-		return fmt.Errorf("не указаны ПЛК в конфигурации")
+	if len(c.PLCs) == 0 && len(c.MQTT) == 0 {
+		return fmt.Errorf("не указаны ПЛК или источники MQTT в конфигурации")
+	}
+
+	// Имя источника MQTT — префикс его рядов, поэтому не должно совпадать с ПЛК
+	for name, mqttConfig := range c.MQTT {
+		if _, exists := c.PLCs[name]; exists {
+			return fmt.Errorf("источник MQTT %s: имя совпадает с именем ПЛК", name)
+		}
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("источник MQTT %q: некорректное имя", name)
+		}
+		if err := mqttConfig.validate(); err != nil {
+			return fmt.Errorf("источник MQTT %s: %w", name, err)
+		}
+	}
+
+	// Проверяем драйверы и маршруты до процессоров
+	for plcName, plcConfig := range c.PLCs {
+		switch plcConfig.DriverName() {
+		case DriverLogix, DriverModbus:
+		case DriverOPCUA:
+			continue // Вместо host — endpoint; параметры OPC UA проверяет драйвер при создании
+		case DriverSim:
+			continue // Имитации не нужен адрес
+		default:
+			return fmt.Errorf("ПЛК %s: неизвестный драйвер %q (допустимы: %s, %s, %s, %s)",
+				plcName, plcConfig.Driver, DriverLogix, DriverModbus, DriverOPCUA, DriverSim)
+		}
+		if plcConfig.Host == "" {
+			return fmt.Errorf("ПЛК %s: не указан host", plcName)
+		}
+		if plcConfig.DriverName() == DriverModbus {
+			continue // Параметры Modbus проверяет драйвер при создании
+		}
+		if plcConfig.Path == nil && (plcConfig.Slot < 0 || plcConfig.Slot > 255) {
+			return fmt.Errorf("ПЛК %s: некорректный слот %d", plcName, plcConfig.Slot)
+		}
+		if err := ValidateCIPPath(plcConfig.CIPPath()); err != nil {
+			return fmt.Errorf("ПЛК %s: %w", plcName, err)
+		}
+		if plcConfig.MaxConnections < 0 {
+			return fmt.Errorf("ПЛК %s: отрицательный max_connections", plcName)
+		}
 	}
 
 	// Проверяем что есть теги
-	if len(c.Tags) == 0 {
+	if len(c.Tags) == 0 && len(c.PLCs) > 0 {
 		return fmt.Errorf("не указаны теги в конфигурации")
 	}
 
@@ -103,5 +682,110 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Проверяем типы данных и описания массивов
+	for tagName, tagConfig := range c.Tags {
+		switch c.PLCs[tagConfig.PLC].DriverName() {
+		case DriverModbus, DriverOPCUA:
+			// Адрес тега проверяет драйвер при создании
+		case DriverSim:
+			if err := validateSimTag(tagName, tagConfig); err != nil {
+				return err
+			}
+		default:
+			if tagConfig.Address != "" {
+				return fmt.Errorf("тег %s: address задаётся только для ПЛК с driver: modbus или opcua", tagName)
+			}
+		}
+		if tagConfig.Sim != nil && c.PLCs[tagConfig.PLC].DriverName() != DriverSim {
+			return fmt.Errorf("тег %s: sim задаётся только для ПЛК с driver: sim", tagName)
+		}
+		if tagConfig.IsStruct() {
+			// Тип структуры (имя UDT) справочный, типы членов берутся из шаблона
+			if tagConfig.Elements != 0 || strings.Contains(tagName, "..") {
+				return fmt.Errorf("тег %s: массивы структур не поддерживаются, укажите элемент явно", tagName)
+			}
+			for _, member := range tagConfig.Members {
+				if strings.TrimSpace(member) == "" {
+					return fmt.Errorf("тег %s: пустое имя члена структуры", tagName)
+				}
+			}
+			continue
+		}
+		if _, ok := datatype.Lookup(tagConfig.Type); !ok {
+			return fmt.Errorf("тег %s: неподдерживаемый тип %s (допустимы: %s)",
+				tagName, tagConfig.Type, strings.Join(datatype.Names(), ", "))
+		}
+		if _, _, err := ParseArrayTag(tagName, tagConfig); err != nil {
+			return err
+		}
+	}
+
+	// Проверяем параметры записи по исключению
+	for tagName, tagConfig := range c.Tags {
+		if tagConfig.Deadband < 0 || tagConfig.DeadbandPercent < 0 || tagConfig.Heartbeat < 0 {
+			return fmt.Errorf("тег %s: зона нечувствительности и heartbeat не могут быть отрицательными", tagName)
+		}
+		if tagConfig.DeadbandPercent > 100 {
+			return fmt.Errorf("тег %s: deadband_percent больше 100", tagName)
+		}
+	}
+
+	// Проверяем теги, доступные для записи
+	for tagName, tagConfig := range c.Tags {
+		if !tagConfig.Writable {
+			if tagConfig.WriteMin != nil || tagConfig.WriteMax != nil {
+				return fmt.Errorf("тег %s: write_min/write_max заданы, но writable не включён", tagName)
+			}
+			continue
+		}
+		if _, isArray, _ := ParseArrayTag(tagName, tagConfig); isArray || tagConfig.IsStruct() {
+			return fmt.Errorf("тег %s: запись разрешена только для скалярных тегов", tagName)
+		}
+		if tagConfig.WriteMin == nil || tagConfig.WriteMax == nil {
+			return fmt.Errorf("тег %s: для записи нужно задать write_min и write_max", tagName)
+		}
+		if *tagConfig.WriteMin > *tagConfig.WriteMax {
+			return fmt.Errorf("тег %s: write_min больше write_max", tagName)
+		}
+	}
+
+	// Проверяем классы опроса
+	for name, scanClass := range c.ScanClasses {
+		if scanClass.Interval <= 0 {
+			return fmt.Errorf("у класса опроса %s не задан интервал", name)
+		}
+	}
+	for tagName, tagConfig := range c.Tags {
+		scanClass, err := c.GetScanClass(tagConfig.TagScanClass())
+		if err != nil {
+			return fmt.Errorf("тег %s: %w", tagName, err)
+		}
+		if scanClass.Interval <= 0 {
+			return fmt.Errorf("тег %s: у класса опроса %s не задан интервал", tagName, tagConfig.TagScanClass())
+		}
+	}
+
+	if c.Database.WriteTimeout < 0 {
+		return fmt.Errorf("database: отрицательный write_timeout")
+	}
+	if c.Polling.StatsInterval < 0 {
+		return fmt.Errorf("polling: отрицательный stats_interval")
+	}
+	if c.Database.QueueSize < 0 {
+		return fmt.Errorf("database: отрицательный queue_size")
+	}
+	if c.CircuitBreaker.FailureThreshold < 0 || c.CircuitBreaker.ProbeInterval < 0 {
+		return fmt.Errorf("circuit_breaker: отрицательные параметры")
+	}
+	if c.Clock.Interval < 0 || c.Clock.MaxDrift < 0 {
+		return fmt.Errorf("clock: отрицательные параметры")
+	}
+	if c.Diagnostics.Interval < 0 {
+		return fmt.Errorf("diagnostics: отрицательный interval")
+	}
+	if c.Clock.Sync && c.Clock.Interval == 0 {
+		return fmt.Errorf("clock: для sync нужно задать interval")
+	}
+
 	return nil
 }
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quality код качества значения (по мотивам OPC DA).
+// Хранится в numeric_time_series.quality. 0 по-прежнему означает хорошее
+// качество, поэтому запросы вида quality = 0 продолжают работать.
+type Quality int
+
+const (
+	QualityGood        Quality = 0 // Значение прочитано успешно
+	QualityBad         Quality = 1 // Неуточнённая ошибка (записи старого формата)
+	QualityUncertain   Quality = 2 // Значение прочитано, но его достоверность сомнительна
+	QualityStale       Quality = 3 // Значение давно не обновлялось
+	QualityCommFailure Quality = 4 // Ошибка связи с ПЛК, значение — последнее известное или NaN
+	QualityConfigError Quality = 5 // Ошибка конфигурации: неизвестный тип, тег не найден и т.п.
+	QualityOutOfRange  Quality = 6 // Значение вне инженерного диапазона тега
+	QualityOverflow    Quality = 7 // Потеря точности при преобразовании (int64/uint64 > 2^53)
+	QualitySubstituted Quality = 8 // Значение подставлено вручную или расчётом
+)
+
+var qualityNames = map[Quality]string{
+	QualityGood:        "good",
+	QualityBad:         "bad",
+	QualityUncertain:   "uncertain",
+	QualityStale:       "stale",
+	QualityCommFailure: "comm_failure",
+	QualityConfigError: "config_error",
+	QualityOutOfRange:  "out_of_range",
+	QualityOverflow:    "overflow",
+	QualitySubstituted: "substituted",
+}
+
+func (q Quality) String() string {
+	if name, ok := qualityNames[q]; ok {
+		return name
+	}
+	return fmt.Sprintf("quality(%d)", int(q))
+}
+
+// IsGood сообщает, что значение можно использовать без оговорок
+func (q Quality) IsGood() bool {
+	return q == QualityGood
+}
+
+// IsUncertain сообщает, что значение есть, но использовать его нужно с осторожностью
+func (q Quality) IsUncertain() bool {
+	switch q {
+	case QualityUncertain, QualityStale, QualityOutOfRange, QualityOverflow, QualitySubstituted:
+		return true
+	}
+	return false
+}
+
+// IsBad сообщает, что значение недостоверно или отсутствует
+func (q Quality) IsBad() bool {
+	return !q.IsGood() && !q.IsUncertain()
+}
+
+// ParseQuality разбирает имя кода качества (good, comm_failure, ...)
+func ParseQuality(name string) (Quality, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for q, n := range qualityNames {
+		if n == name {
+			return q, nil
+		}
+	}
+	return 0, fmt.Errorf("неизвестный код качества: %s", name)
+}
+
+// QualityFilter ограничивает выборку указанными кодами качества.
+// Пустой фильтр пропускает записи любого качества.
+type QualityFilter []Quality
+
+// GoodOnly возвращает фильтр только по записям хорошего качества
+func GoodOnly() QualityFilter {
+	return QualityFilter{QualityGood}
+}
+
+// AnyQuality возвращает фильтр, пропускающий записи любого качества
+func AnyQuality() QualityFilter {
+	return nil
+}
+
+// NotBad возвращает фильтр по записям хорошего и сомнительного качества
+func NotBad() QualityFilter {
+	var f QualityFilter
+	for q := range qualityNames {
+		if !q.IsBad() {
+			f = append(f, q)
+		}
+	}
+	return f
+}
+
+// sqlClause возвращает условие для WHERE (с ведущим AND) и его аргументы
+func (f QualityFilter) sqlClause() (string, []interface{}) {
+	if len(f) == 0 {
+		return "", nil
+	}
+
+	placeholders := make([]string, len(f))
+	args := make([]interface{}, len(f))
+	for i, q := range f {
+		placeholders[i] = "?"
+		args[i] = int(q)
+	}
+	return fmt.Sprintf("AND quality IN (%s)", strings.Join(placeholders, ",")), args
+}
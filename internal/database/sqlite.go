@@ -1,14 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
 
 	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
 
 	_ "modernc.org/sqlite"
 )
@@ -22,8 +25,8 @@ type SQLiteClient struct {
 type NumericData struct {
 	Timestamp int64
 	TagName   string
-	Value     float64 // Универсальное числовое представление
-	Quality   int     // 0=good, 1=bad (ошибка чтения)
+	Value     float64 // Универсальное числовое представление (NaN, если значения нет)
+	Quality   Quality // Код качества, см. quality.go
 }
 
 func NewSQLiteClient(cfg *config.DatabaseConfig) (*SQLiteClient, error) {
@@ -64,8 +67,8 @@ func (s *SQLiteClient) initSchema() error {
 		CREATE TABLE IF NOT EXISTS numeric_time_series (
 			timestamp_ns INTEGER NOT NULL,
 			tag_name TEXT NOT NULL,
-			value REAL NOT NULL,        -- Только числовые значения
-			quality INTEGER DEFAULT 0,  -- 0=good, 1=bad
+			value REAL,                 -- Только числовые значения, NULL = нет значения (NaN)
+			quality INTEGER DEFAULT 0,  -- Код качества database.Quality, 0=good
 			PRIMARY KEY (timestamp_ns, tag_name)
 		)
 	`)
@@ -73,6 +76,27 @@ func (s *SQLiteClient) initSchema() error {
 		return err
 	}
 
+	if err := s.migrateNullableValue(); err != nil {
+		return fmt.Errorf("ошибка миграции столбца value: %w", err)
+	}
+
+	// Журнал попыток записи в ПЛК
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS write_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp_ns INTEGER NOT NULL,
+			user TEXT NOT NULL,
+			tag_name TEXT NOT NULL,
+			old_value REAL,             -- NULL, если прочитать значение не удалось
+			new_value REAL,
+			result TEXT NOT NULL        -- "ok" или текст ошибки
+		);
+		CREATE INDEX IF NOT EXISTS idx_wa_timestamp ON write_audit(timestamp_ns);
+	`)
+	if err != nil {
+		return err
+	}
+
 	// Индексы для быстрого поиска по времени и тегам
 	_, err = s.db.Exec(`
 		CREATE INDEX IF NOT EXISTS idx_nts_timestamp ON numeric_time_series(timestamp_ns);
@@ -84,30 +108,101 @@ func (s *SQLiteClient) initSchema() error {
 	return err
 }
 
-func (s *SQLiteClient) Write(data map[string]interface{}, timestamp time.Time) error {
+// migrateNullableValue снимает ограничение NOT NULL со столбца value в базах,
+// созданных до появления записей с плохим качеством. SQLite не умеет менять
+// ограничения столбца, поэтому таблица пересоздаётся с копированием данных.
+func (s *SQLiteClient) migrateNullableValue() error {
+	rows, err := s.db.Query(`PRAGMA table_info(numeric_time_series)`)
+	if err != nil {
+		return err
+	}
+
+	notNull := false
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notnull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == "value" && notnull == 1 {
+			notNull = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !notNull {
+		return nil
+	}
+
+	log.Printf("Миграция numeric_time_series: столбец value становится NULL-допустимым")
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	timestampNs := timestamp.UnixNano()
+	_, err = tx.Exec(`
+		CREATE TABLE numeric_time_series_new (
+			timestamp_ns INTEGER NOT NULL,
+			tag_name TEXT NOT NULL,
+			value REAL,
+			quality INTEGER DEFAULT 0,
+			PRIMARY KEY (timestamp_ns, tag_name)
+		);
+		INSERT INTO numeric_time_series_new (timestamp_ns, tag_name, value, quality)
+			SELECT timestamp_ns, tag_name, value, quality FROM numeric_time_series;
+		DROP TABLE numeric_time_series;
+		ALTER TABLE numeric_time_series_new RENAME TO numeric_time_series;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Write сохраняет точки одной транзакцией. Если дедлайн ctx истекает
+// до фиксации, транзакция откатывается целиком.
+func (s *SQLiteClient) Write(ctx context.Context, points []Point) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	successfulWrites := 0
 
-	for tagName, value := range data {
-		numericValue, quality, valid := s.convertToNumeric(value)
+	for _, point := range points {
+		numericValue, quality, valid := ToNumeric(point.Value)
 		if !valid {
-			log.Printf("Пропуск нечислового тега %s: тип %T", tagName, value)
-			continue
+			// Пишем NaN с ошибкой конфигурации, чтобы проблема была видна в данных
+			log.Printf("Нечисловой тег %s: тип %T, записан как ошибка конфигурации", point.Tag, point.Value)
 		}
 
-		_, err = tx.Exec(`
-			INSERT INTO numeric_time_series (timestamp_ns, tag_name, value, quality)
+		// NaN хранится как NULL: SQLite не различает их для REAL
+		dbValue := sql.NullFloat64{Float64: numericValue, Valid: !math.IsNaN(numericValue)}
+
+		// Точка с уже записанной меткой времени пропускается: источники с
+		// собственными метками (OPC UA, Sparkplug B) повторяют её, пока
+		// значение не меняется или при повторной доставке
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO numeric_time_series (timestamp_ns, tag_name, value, quality)
 			VALUES (?, ?, ?, ?)
-		`, timestampNs, tagName, numericValue, quality)
+		`, point.Timestamp.UnixNano(), point.Tag, dbValue, quality)
 
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("запись прервана: %w", ctxErr)
+		}
 		if err != nil {
-			log.Printf("Ошибка записи тега %s: %v", tagName, err)
+			log.Printf("Ошибка записи тега %s: %v", point.Tag, err)
 		} else {
 			successfulWrites++
 		}
@@ -120,42 +215,39 @@ func (s *SQLiteClient) Write(data map[string]interface{}, timestamp time.Time) e
 	return tx.Commit()
 }
 
-// convertToNumeric преобразует поддерживаемые типы в float64
-func (s *SQLiteClient) convertToNumeric(value interface{}) (float64, int, bool) {
-	switch v := value.(type) {
-	case float32:
-		return float64(v), 0, true
-	case float64:
-		return v, 0, true
-	case int:
-		return float64(v), 0, true
-	case int16:
-		return float64(v), 0, true
-	case int32:
-		return float64(v), 0, true
-	case int64:
-		if value, ok := safeInt64ToFloat(v); ok {
-			return value, 0, true
+// ToNumeric преобразует поддерживаемые типы в float64 и определяет качество.
+// Для неподдерживаемых типов возвращает ok=false, NaN и QualityConfigError.
+func ToNumeric(value interface{}) (float64, Quality, bool) {
+	if v, isSample := value.(Sample); isSample {
+		if v.Value == nil {
+			return math.NaN(), v.Quality, true
+		}
+		numericValue, quality, valid := ToNumeric(v.Value)
+		if !valid {
+			return math.NaN(), v.Quality, true
 		}
-		return 0.0, 1, false
-	case uint16:
-		return float64(v), 0, true
-	case uint32:
-		return float64(v), 0, true
-	case bool:
-		if v {
-			return 1.0, 0, true
+		if quality.IsGood() {
+			quality = v.Quality
 		}
-		return 0.0, 0, true
-	default:
-		return 0.0, 1, false // Неподдерживаемый тип
+		return numericValue, quality, true
+	}
+
+	numericValue, exact, ok := datatype.ToFloat64(value)
+	if !ok {
+		return math.NaN(), QualityConfigError, false // Неподдерживаемый тип
+	}
+	if !exact {
+		return numericValue, QualityOverflow, true // Значение приблизительное
 	}
+	return numericValue, QualityGood, true
 }
 
 // Методы для ИНС
 
-// GetNumericData возвращает числовые данные для указанных тегов и временного диапазона
-func (s *SQLiteClient) GetNumericData(tags []string, startTime, endTime time.Time) ([]NumericData, error) {
+// GetNumericData возвращает числовые данные для указанных тегов и временного диапазона.
+// filter ограничивает коды качества; с AnyQuality() возвращаются и записи
+// с ошибками связи — по ним видны пропуски (Value у таких записей может быть NaN).
+func (s *SQLiteClient) GetNumericData(tags []string, startTime, endTime time.Time, filter QualityFilter) ([]NumericData, error) {
 	if len(tags) == 0 {
 		return nil, fmt.Errorf("не указаны теги")
 	}
@@ -174,14 +266,17 @@ func (s *SQLiteClient) GetNumericData(tags []string, startTime, endTime time.Tim
 	// Добавляем временной диапазон
 	args = append(args, startTime.UnixNano(), endTime.UnixNano())
 
+	qualityClause, qualityArgs := filter.sqlClause()
+	args = append(args, qualityArgs...)
+
 	query := fmt.Sprintf(`
 		SELECT timestamp_ns, tag_name, value, quality
 		FROM numeric_time_series 
 		WHERE tag_name IN (%s)
 		AND timestamp_ns BETWEEN ? AND ?
-		AND quality = 0  -- Только данные хорошего качества
+		%s
 		ORDER BY timestamp_ns, tag_name
-	`, placeholders)
+	`, placeholders, qualityClause)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -189,26 +284,85 @@ func (s *SQLiteClient) GetNumericData(tags []string, startTime, endTime time.Tim
 	}
 	defer rows.Close()
 
+	return scanNumericRows(rows)
+}
+
+// scanNumericRows читает строки numeric_time_series, заменяя NULL на NaN
+func scanNumericRows(rows *sql.Rows) ([]NumericData, error) {
 	var results []NumericData
 	for rows.Next() {
 		var data NumericData
-		err := rows.Scan(&data.Timestamp, &data.TagName, &data.Value, &data.Quality)
+		var value sql.NullFloat64
+		err := rows.Scan(&data.Timestamp, &data.TagName, &value, &data.Quality)
 		if err != nil {
 			return nil, err
 		}
+		data.Value = math.NaN()
+		if value.Valid {
+			data.Value = value.Float64
+		}
 		results = append(results, data)
 	}
 
+	return results, rows.Err()
+}
+
+// GetValuesAt возвращает для каждого тега последнюю запись не позже момента t —
+// значение, действовавшее в этот момент. Теги с записью по исключению
+// сохраняются только при изменении, поэтому без этой записи начало
+// диапазона запроса оказалось бы пустым.
+func (s *SQLiteClient) GetValuesAt(tags []string, t time.Time, filter QualityFilter) ([]NumericData, error) {
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("не указаны теги")
+	}
+
+	qualityClause, qualityArgs := filter.sqlClause()
+	query := fmt.Sprintf(`
+		SELECT timestamp_ns, tag_name, value, quality
+		FROM numeric_time_series
+		WHERE tag_name = ?
+		AND timestamp_ns <= ?
+		%s
+		ORDER BY timestamp_ns DESC
+		LIMIT 1
+	`, qualityClause)
+
+	var results []NumericData
+	for _, tag := range tags {
+		args := append([]interface{}{tag, t.UnixNano()}, qualityArgs...)
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		data, err := scanNumericRows(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, data...)
+	}
 	return results, nil
 }
 
-// GetDataForTraining возвращает данные в формате для обучения ИНС
-func (s *SQLiteClient) GetDataForTraining(tags []string, startTime, endTime time.Time) (*TrainingData, error) {
-	numericData, err := s.GetNumericData(tags, startTime, endTime)
+// GetDataForTraining возвращает данные в формате для обучения ИНС.
+// Ряды восстанавливаются ступенчато: если в момент времени у тега нет
+// записи, берётся его последнее значение (в том числе записанное до начала
+// диапазона).
+func (s *SQLiteClient) GetDataForTraining(tags []string, startTime, endTime time.Time, filter QualityFilter) (*TrainingData, error) {
+	numericData, err := s.GetNumericData(tags, startTime, endTime, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	initialData, err := s.GetValuesAt(tags, startTime.Add(-time.Nanosecond), filter)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]float64, len(tags))
+	for _, data := range initialData {
+		current[data.TagName] = data.Value
+	}
+
 	// Группируем данные по временным меткам
 	dataByTime := make(map[int64]map[string]float64)
 	var timestamps []int64
@@ -227,9 +381,12 @@ func (s *SQLiteClient) GetDataForTraining(tags []string, startTime, endTime time
 		row := make([]float64, len(tags))
 		for j, tag := range tags {
 			if value, exists := dataByTime[ts][tag]; exists {
+				current[tag] = value
+			}
+			if value, exists := current[tag]; exists {
 				row[j] = value
 			} else {
-				row[j] = 0.0 // Заполняем нулями пропущенные значения
+				row[j] = 0.0 // Заполняем нулями значения до первой записи тега
 			}
 		}
 		features[i] = row
@@ -250,7 +407,7 @@ type TrainingData struct {
 }
 
 // GetRecentData возвращает последние N записей для указанных тегов
-func (s *SQLiteClient) GetRecentData(tags []string, limit int) ([]NumericData, error) {
+func (s *SQLiteClient) GetRecentData(tags []string, limit int, filter QualityFilter) ([]NumericData, error) {
 	if len(tags) == 0 {
 		return nil, fmt.Errorf("не указаны теги")
 	}
@@ -264,16 +421,18 @@ func (s *SQLiteClient) GetRecentData(tags []string, limit int) ([]NumericData, e
 		placeholders += "?"
 		args[i] = tag
 	}
+	qualityClause, qualityArgs := filter.sqlClause()
+	args = append(args, qualityArgs...)
 	args = append(args, limit)
 
 	query := fmt.Sprintf(`
 		SELECT timestamp_ns, tag_name, value, quality
 		FROM numeric_time_series 
 		WHERE tag_name IN (%s)
-		AND quality = 0
+		%s
 		ORDER BY timestamp_ns DESC 
 		LIMIT ?
-	`, placeholders)
+	`, placeholders, qualityClause)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -281,14 +440,9 @@ func (s *SQLiteClient) GetRecentData(tags []string, limit int) ([]NumericData, e
 	}
 	defer rows.Close()
 
-	var results []NumericData
-	for rows.Next() {
-		var data NumericData
-		err := rows.Scan(&data.Timestamp, &data.TagName, &data.Value, &data.Quality)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, data)
+	results, err := scanNumericRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
 	// Переворачиваем чтобы получить хронологический порядок
@@ -299,6 +453,60 @@ func (s *SQLiteClient) GetRecentData(tags []string, limit int) ([]NumericData, e
 	return results, nil
 }
 
+// WriteAuditRecord запись журнала попыток записи в ПЛК
+type WriteAuditRecord struct {
+	Timestamp int64
+	User      string
+	TagName   string
+	OldValue  float64 // NaN, если значение до записи неизвестно
+	NewValue  float64
+	Result    string // "ok" или текст ошибки
+}
+
+// AuditWrite сохраняет попытку записи в ПЛК в журнал write_audit
+func (s *SQLiteClient) AuditWrite(timestamp time.Time, user, tagName string, oldValue, newValue float64, result string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO write_audit (timestamp_ns, user, tag_name, old_value, new_value, result)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, timestamp.UnixNano(), user, tagName,
+		sql.NullFloat64{Float64: oldValue, Valid: !math.IsNaN(oldValue)},
+		sql.NullFloat64{Float64: newValue, Valid: !math.IsNaN(newValue)},
+		result)
+	return err
+}
+
+// GetWriteAudit возвращает журнал попыток записи за период в хронологическом порядке
+func (s *SQLiteClient) GetWriteAudit(startTime, endTime time.Time) ([]WriteAuditRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT timestamp_ns, user, tag_name, old_value, new_value, result
+		FROM write_audit
+		WHERE timestamp_ns BETWEEN ? AND ?
+		ORDER BY timestamp_ns, id
+	`, startTime.UnixNano(), endTime.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []WriteAuditRecord
+	for rows.Next() {
+		var record WriteAuditRecord
+		var oldValue, newValue sql.NullFloat64
+		if err := rows.Scan(&record.Timestamp, &record.User, &record.TagName, &oldValue, &newValue, &record.Result); err != nil {
+			return nil, err
+		}
+		record.OldValue, record.NewValue = math.NaN(), math.NaN()
+		if oldValue.Valid {
+			record.OldValue = oldValue.Float64
+		}
+		if newValue.Valid {
+			record.NewValue = newValue.Float64
+		}
+		results = append(results, record)
+	}
+	return results, rows.Err()
+}
+
 // CleanOldData удаляет данные старше указанного времени
 func (s *SQLiteClient) CleanOldData(olderThan time.Time) error {
 	_, err := s.db.Exec(`
@@ -314,12 +522,3 @@ func (s *SQLiteClient) Close() error {
 	}
 	return nil
 }
-
-// safeInt64ToFloat проверяет что int64 безопасно конвертируется в float64
-func safeInt64ToFloat(v int64) (float64, bool) {
-	// Float64 может точно представить integers до 2^53
-	if v > 1<<53 || v < -1<<53 {
-		return 0, false
-	}
-	return float64(v), true
-}
@@ -1,14 +1,62 @@
 package database // Важно: имя пакета = имени папки
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"plc_tsdb/internal/config"
 	"time"
 )
 
+// Sample значение тега с явным признаком качества.
+// Передаётся в Write вместо «сырого» значения, когда качество не хорошее
+// или источник сообщает собственную метку времени значения.
+// Value может быть nil — тогда в БД записывается NaN (NULL).
+type Sample struct {
+	Value     interface{}
+	Quality   Quality
+	Timestamp time.Time // Метка времени источника; нулевая — время опроса
+}
+
+// Point значение ряда со своей меткой времени
+type Point struct {
+	Tag       string
+	Timestamp time.Time
+	Value     interface{} // Значение или Sample с признаком качества
+}
+
+// PointsAt возвращает точки для значений, полученных в один момент времени.
+// Значение с меткой времени источника (Sample.Timestamp) получает её.
+func PointsAt(data map[string]interface{}, timestamp time.Time) []Point {
+	points := make([]Point, 0, len(data))
+	for tagName, value := range data {
+		pointTime := timestamp
+		if sourceTime := SourceTimestamp(value); !sourceTime.IsZero() {
+			pointTime = sourceTime
+		}
+		points = append(points, Point{Tag: tagName, Timestamp: pointTime, Value: value})
+	}
+	return points
+}
+
+// SourceTimestamp возвращает метку времени источника значения, в том
+// числе вложенного Sample; нулевую, если источник её не сообщил
+func SourceTimestamp(value interface{}) time.Time {
+	for {
+		sample, isSample := value.(Sample)
+		if !isSample {
+			return time.Time{}
+		}
+		if !sample.Timestamp.IsZero() {
+			return sample.Timestamp
+		}
+		value = sample.Value
+	}
+}
+
 type TSDBClient interface {
-	Write(data map[string]interface{}, timestamp time.Time) error
+	// Write сохраняет точки, у каждой своя метка времени; ожидание ограничено ctx
+	Write(ctx context.Context, points []Point) error
 	Close() error
 }
 
@@ -26,8 +74,13 @@ func NewTSDBClient(cfg *config.DatabaseConfig) (TSDBClient, error) {
 // Mock клиент для тестов
 type MockTSDBClient struct{}
 
-func (m *MockTSDBClient) Write(data map[string]interface{}, timestamp time.Time) error {
-	log.Printf("[MOCK] Запись данных: %+v", data)
+func (m *MockTSDBClient) Write(ctx context.Context, points []Point) error {
+	log.Printf("[MOCK] Запись данных: %+v", points)
+	return nil
+}
+
+func (m *MockTSDBClient) AuditWrite(timestamp time.Time, user, tagName string, oldValue, newValue float64, result string) error {
+	log.Printf("[MOCK] Запись в ПЛК: %s %s %v -> %v: %s", user, tagName, oldValue, newValue, result)
 	return nil
 }
 
@@ -0,0 +1,175 @@
+// Package datatype — единый реестр атомарных типов данных Logix.
+// Используется и при чтении тегов (plc), и при преобразовании значений
+// для хранения (database), чтобы списки поддерживаемых типов не расходились.
+package datatype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Type описывает атомарный тип данных Logix
+type Type struct {
+	Name   string // Каноническое имя Logix: SINT, DINT, REAL, ...
+	GoName string // Имя соответствующего Go-типа, допустимое в поле type YAML
+	Size   int    // Размер в байтах
+	Code   uint8  // Код типа CIP в ответах контроллера
+
+	Min, Max float64 // Допустимый диапазон значений при записи (LINT/ULINT — до 2^53)
+
+	zero   func() interface{}
+	decode func(b []byte) interface{}
+	encode func(v float64) interface{}
+}
+
+// Zero возвращает нулевое значение Go-типа, соответствующего типу Logix.
+// По нему gologix определяет, какой тип запрашивать у контроллера.
+func (t Type) Zero() interface{} {
+	return t.zero()
+}
+
+// Decode разбирает одно значение из данных контроллера (little-endian).
+// Длина b должна быть не меньше Size.
+func (t Type) Decode(b []byte) interface{} {
+	return t.decode(b)
+}
+
+// FromFloat64 преобразует число в значение Go-типа для записи в контроллер.
+// Для целых типов значение должно быть целым и помещаться в диапазон,
+// для BOOL — равным 0 или 1.
+func (t Type) FromFloat64(v float64) (interface{}, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("значение %v нельзя записать в %s", v, t.Name)
+	}
+	if t.Name != "REAL" && t.Name != "LREAL" && v != math.Trunc(v) {
+		return nil, fmt.Errorf("значение %v не целое, тип %s", v, t.Name)
+	}
+	if v < t.Min || v > t.Max {
+		return nil, fmt.Errorf("значение %v вне диапазона типа %s", v, t.Name)
+	}
+	return t.encode(v), nil
+}
+
+var le = binary.LittleEndian
+
+var registry = []Type{
+	{Name: "BOOL", GoName: "bool", Size: 1, Code: 0xC1, Min: 0, Max: 1,
+		zero:   func() interface{} { return false },
+		decode: func(b []byte) interface{} { return b[0] != 0 },
+		encode: func(v float64) interface{} { return v != 0 }},
+	{Name: "SINT", GoName: "int8", Size: 1, Code: 0xC2, Min: math.MinInt8, Max: math.MaxInt8,
+		zero:   func() interface{} { return int8(0) },
+		decode: func(b []byte) interface{} { return int8(b[0]) },
+		encode: func(v float64) interface{} { return int8(v) }},
+	{Name: "INT", GoName: "int16", Size: 2, Code: 0xC3, Min: math.MinInt16, Max: math.MaxInt16,
+		zero:   func() interface{} { return int16(0) },
+		decode: func(b []byte) interface{} { return int16(le.Uint16(b)) },
+		encode: func(v float64) interface{} { return int16(v) }},
+	{Name: "DINT", GoName: "int32", Size: 4, Code: 0xC4, Min: math.MinInt32, Max: math.MaxInt32,
+		zero:   func() interface{} { return int32(0) },
+		decode: func(b []byte) interface{} { return int32(le.Uint32(b)) },
+		encode: func(v float64) interface{} { return int32(v) }},
+	{Name: "LINT", GoName: "int64", Size: 8, Code: 0xC5, Min: -maxExactInt, Max: maxExactInt,
+		zero:   func() interface{} { return int64(0) },
+		decode: func(b []byte) interface{} { return int64(le.Uint64(b)) },
+		encode: func(v float64) interface{} { return int64(v) }},
+	{Name: "USINT", GoName: "uint8", Size: 1, Code: 0xC6, Min: 0, Max: math.MaxUint8,
+		zero:   func() interface{} { return uint8(0) },
+		decode: func(b []byte) interface{} { return b[0] },
+		encode: func(v float64) interface{} { return uint8(v) }},
+	{Name: "UINT", GoName: "uint16", Size: 2, Code: 0xC7, Min: 0, Max: math.MaxUint16,
+		zero:   func() interface{} { return uint16(0) },
+		decode: func(b []byte) interface{} { return le.Uint16(b) },
+		encode: func(v float64) interface{} { return uint16(v) }},
+	{Name: "UDINT", GoName: "uint32", Size: 4, Code: 0xC8, Min: 0, Max: math.MaxUint32,
+		zero:   func() interface{} { return uint32(0) },
+		decode: func(b []byte) interface{} { return le.Uint32(b) },
+		encode: func(v float64) interface{} { return uint32(v) }},
+	{Name: "ULINT", GoName: "uint64", Size: 8, Code: 0xC9, Min: 0, Max: maxExactInt,
+		zero:   func() interface{} { return uint64(0) },
+		decode: func(b []byte) interface{} { return le.Uint64(b) },
+		encode: func(v float64) interface{} { return uint64(v) }},
+	{Name: "REAL", GoName: "float32", Size: 4, Code: 0xCA, Min: -math.MaxFloat32, Max: math.MaxFloat32,
+		zero:   func() interface{} { return float32(0) },
+		decode: func(b []byte) interface{} { return math.Float32frombits(le.Uint32(b)) },
+		encode: func(v float64) interface{} { return float32(v) }},
+	{Name: "LREAL", GoName: "float64", Size: 8, Code: 0xCB, Min: -math.MaxFloat64, Max: math.MaxFloat64,
+		zero:   func() interface{} { return float64(0) },
+		decode: func(b []byte) interface{} { return math.Float64frombits(le.Uint64(b)) },
+		encode: func(v float64) interface{} { return v }},
+}
+
+// Lookup находит тип по имени Logix (REAL) или имени Go-типа (float32).
+// Регистр не учитывается.
+func Lookup(name string) (Type, bool) {
+	name = strings.TrimSpace(name)
+	for _, t := range registry {
+		if strings.EqualFold(name, t.Name) || strings.EqualFold(name, t.GoName) {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// LookupCode находит тип по коду типа CIP
+func LookupCode(code uint8) (Type, bool) {
+	for _, t := range registry {
+		if t.Code == code {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// Names возвращает канонические имена всех поддерживаемых типов
+func Names() []string {
+	names := make([]string, len(registry))
+	for i, t := range registry {
+		names[i] = t.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxExactInt наибольшее целое, которое float64 представляет точно (2^53)
+const maxExactInt = 1 << 53
+
+// ToFloat64 преобразует значение атомарного типа в float64.
+// exact=false означает потерю точности (целые по модулю больше 2^53),
+// ok=false — тип не поддерживается.
+func ToFloat64(value interface{}) (result float64, exact bool, ok bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1.0, true, true
+		}
+		return 0.0, true, true
+	case int8:
+		return float64(v), true, true
+	case int16:
+		return float64(v), true, true
+	case int32:
+		return float64(v), true, true
+	case int64:
+		return float64(v), v <= maxExactInt && v >= -maxExactInt, true
+	case int:
+		return float64(v), v <= maxExactInt && v >= -maxExactInt, true
+	case uint8:
+		return float64(v), true, true
+	case uint16:
+		return float64(v), true, true
+	case uint32:
+		return float64(v), true, true
+	case uint64:
+		return float64(v), v <= maxExactInt, true
+	case float32:
+		return float64(v), true, true
+	case float64:
+		return v, true, true
+	default:
+		return 0, false, false
+	}
+}
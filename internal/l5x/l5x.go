@@ -0,0 +1,204 @@
+// Package l5x разбирает экспорт проекта Logix (L5X) и извлекает из него
+// теги контроллера и программ для подготовки tags.yaml без подключения к ПЛК.
+package l5x
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/datatype"
+)
+
+// Минимальное подмножество схемы L5X: только то, что нужно для списка тегов
+type project struct {
+	Controller struct {
+		Name     string    `xml:"Name,attr"`
+		Tags     []tagElem `xml:"Tags>Tag"`
+		Programs []struct {
+			Name string    `xml:"Name,attr"`
+			Tags []tagElem `xml:"Tags>Tag"`
+		} `xml:"Programs>Program"`
+	} `xml:"Controller"`
+}
+
+type tagElem struct {
+	Name        string          `xml:"Name,attr"`
+	TagType     string          `xml:"TagType,attr"` // Base, Alias, Produced, Consumed
+	DataType    string          `xml:"DataType,attr"`
+	Dimensions  string          `xml:"Dimensions,attr"`
+	AliasFor    string          `xml:"AliasFor,attr"`
+	Description descriptionElem `xml:"Description"`
+	Units       []operandElem   `xml:"EngineeringUnits>EngineeringUnit"`
+	Comments    []operandElem   `xml:"Comments>Comment"`
+}
+
+type descriptionElem struct {
+	Text      string `xml:",chardata"`
+	Localized []struct {
+		Lang string `xml:"Lang,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"LocalizedDescription"`
+}
+
+type operandElem struct {
+	Operand string `xml:"Operand,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Load читает L5X-файл и возвращает его теги
+func Load(filename string) ([]browse.Tag, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия L5X: %w", err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse разбирает L5X и возвращает теги контроллера и программ.
+// Алиасы получают тип базового тега, если он описан в том же файле.
+func Parse(r io.Reader) ([]browse.Tag, error) {
+	var p project
+	decoder := xml.NewDecoder(r)
+	// Экспорт бывает в UTF-8 с BOM или с объявлением другой кодировки — читаем как есть
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("ошибка разбора L5X: %w", err)
+	}
+	if p.Controller.Name == "" {
+		return nil, fmt.Errorf("в файле нет описания контроллера")
+	}
+
+	var tags []browse.Tag
+	controllerTags := make(map[string]tagElem)
+	for _, t := range p.Controller.Tags {
+		controllerTags[strings.ToLower(t.Name)] = t
+	}
+
+	for _, t := range p.Controller.Tags {
+		tags = append(tags, convertTag(t, "", controllerTags, nil))
+	}
+	for _, program := range p.Controller.Programs {
+		programTags := make(map[string]tagElem)
+		for _, t := range program.Tags {
+			programTags[strings.ToLower(t.Name)] = t
+		}
+		for _, t := range program.Tags {
+			tags = append(tags, convertTag(t, program.Name, programTags, controllerTags))
+		}
+	}
+	return tags, nil
+}
+
+// convertTag переводит тег L5X в browse.Tag. scope — теги той же области
+// видимости, outer — теги контроллера (для алиасов в программах).
+func convertTag(t tagElem, program string, scope, outer map[string]tagElem) browse.Tag {
+	tag := browse.Tag{
+		Name:    t.Name,
+		Program: program,
+		Type:    t.DataType,
+	}
+	if program != "" {
+		tag.Name = fmt.Sprintf("Program:%s.%s", program, t.Name)
+	}
+
+	if strings.EqualFold(t.TagType, "Alias") && tag.Type == "" {
+		tag.Type, tag.Dimensions = resolveAlias(t.AliasFor, scope, outer)
+	} else {
+		tag.Dimensions = parseDimensions(t.Dimensions)
+	}
+
+	if dataType, ok := datatype.Lookup(tag.Type); ok {
+		tag.Type = dataType.Name
+		tag.Atomic = true
+	} else if tag.Type != "" {
+		// Всё, что не атомарный тип, — структура: UDT, AOI, STRING, TIMER и т.п.
+		tag.Struct = true
+	}
+
+	tag.Description, tag.Unit = splitUnit(description(t))
+	for _, u := range t.Units {
+		if u.Operand == "" && strings.TrimSpace(u.Text) != "" {
+			tag.Unit = strings.TrimSpace(u.Text)
+		}
+	}
+	return tag
+}
+
+// resolveAlias определяет тип алиаса по базовому тегу. Поддерживаются
+// алиасы на тег целиком и на элемент массива; алиасы на члены структур
+// и модули ввода-вывода остаются без типа.
+func resolveAlias(aliasFor string, scope, outer map[string]tagElem) (string, []int) {
+	base := strings.ToLower(aliasFor)
+	element := false
+	if i := strings.Index(base, "["); i >= 0 && strings.HasSuffix(base, "]") {
+		base, element = base[:i], true
+	}
+	if strings.ContainsAny(base, ".:") {
+		return "", nil
+	}
+
+	target, ok := scope[base]
+	if !ok {
+		target, ok = outer[base]
+	}
+	if !ok || target.DataType == "" {
+		return "", nil
+	}
+	if element {
+		return target.DataType, nil
+	}
+	return target.DataType, parseDimensions(target.Dimensions)
+}
+
+// description возвращает описание тега; из локализованных берётся первое непустое
+func description(t tagElem) string {
+	if text := strings.TrimSpace(t.Description.Text); text != "" {
+		return text
+	}
+	for _, l := range t.Description.Localized {
+		if text := strings.TrimSpace(l.Text); text != "" {
+			return text
+		}
+	}
+	for _, c := range t.Comments {
+		if c.Operand == "" && strings.TrimSpace(c.Text) != "" {
+			return strings.TrimSpace(c.Text)
+		}
+	}
+	return ""
+}
+
+// splitUnit отделяет единицу измерения в квадратных скобках в конце
+// описания: "Давление на выходе [bar]" -> "Давление на выходе", "bar"
+func splitUnit(text string) (string, string) {
+	text = strings.Join(strings.Fields(text), " ")
+	if !strings.HasSuffix(text, "]") {
+		return text, ""
+	}
+	open := strings.LastIndex(text, "[")
+	if open < 0 {
+		return text, ""
+	}
+	unit := strings.TrimSpace(text[open+1 : len(text)-1])
+	if unit == "" {
+		return text, ""
+	}
+	return strings.TrimSpace(text[:open]), unit
+}
+
+// parseDimensions разбирает атрибут Dimensions ("16", "4 4")
+func parseDimensions(dims string) []int {
+	var result []int
+	for _, field := range strings.Fields(dims) {
+		if n, err := strconv.Atoi(field); err == nil && n > 0 {
+			result = append(result, n)
+		}
+	}
+	return result
+}
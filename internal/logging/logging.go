@@ -59,18 +59,9 @@ func Init(logDir string, levelStr string) error {
 	var handler slog.Handler
 
 	// Преобразуем уровень в slog.Level
-	var lvl slog.Level
-	switch strings.ToLower(levelStr) {
-	case "debug":
-		lvl = slog.LevelDebug
-	case "info":
-		lvl = slog.LevelInfo
-	case "warn", "warning":
-		lvl = slog.LevelWarn
-	case "error":
-		lvl = slog.LevelError
-	default:
-		return fmt.Errorf("неизвестный уровень логирования: %s", levelStr)
+	lvl, err := parseLevel(levelStr)
+	if err != nil {
+		return err
 	}
 
 	if logDir == "" {
@@ -90,6 +81,34 @@ func Init(logDir string, levelStr string) error {
 	return nil
 }
 
+// InitStderr инициализирует логгер с выводом в stderr.
+// Используется подкомандами, которые пишут результат в stdout.
+func InitStderr(levelStr string) error {
+	lvl, err := parseLevel(levelStr)
+	if err != nil {
+		return err
+	}
+	Logger = slog.New(NewSimpleHandler(lvl, os.Stderr))
+	slog.SetDefault(Logger)
+	return nil
+}
+
+// parseLevel преобразует имя уровня в slog.Level
+func parseLevel(levelStr string) (slog.Level, error) {
+	switch strings.ToLower(levelStr) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("неизвестный уровень логирования: %s", levelStr)
+	}
+}
+
 // Упрощённые функции
 func Info(msg string, args ...any)  { Logger.Info(msg, args...) }
 func Warn(msg string, args ...any)  { Logger.Warn(msg, args...) }
@@ -0,0 +1,246 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout таймаут обмена, если у запроса нет дедлайна
+const DefaultTimeout = 5 * time.Second
+
+// mbapHeaderSize размер заголовка MBAP: транзакция, протокол, длина, unit ID
+const mbapHeaderSize = 7
+
+// Client клиент Modbus TCP. Запросы выполняются по одному; при сетевой
+// ошибке или таймауте соединение закрывается, исключения устройства его
+// не закрывают.
+type Client struct {
+	address string // host:port
+	unitID  uint8
+	Timeout time.Duration // Таймаут обмена без учёта дедлайна запроса
+
+	mu   sync.Mutex // Сериализует обмен через conn
+	conn net.Conn
+	txID uint16
+}
+
+// NewClient создаёт клиент устройства address (host:port) с номером unitID
+func NewClient(address string, unitID uint8) *Client {
+	return &Client{address: address, unitID: unitID, Timeout: DefaultTimeout}
+}
+
+// String возвращает адрес устройства для сообщений в лог
+func (c *Client) String() string {
+	return fmt.Sprintf("%s, unit %d", c.address, c.unitID)
+}
+
+// Connect открывает соединение
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	conn, err := net.DialTimeout("tcp", c.address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// Close закрывает соединение
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Connected сообщает, открыто ли соединение
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// ReadRegisters читает count регистров таблицы InputRegisters или HoldingRegisters
+func (c *Client) ReadRegisters(ctx context.Context, table Table, offset, count uint16) ([]uint16, error) {
+	fc := byte(fcReadHoldingRegisters)
+	switch {
+	case table == InputRegisters:
+		fc = fcReadInputRegisters
+	case table != HoldingRegisters:
+		return nil, fmt.Errorf("таблица %s не хранит регистры", table)
+	}
+	if count < 1 || count > MaxReadRegisters {
+		return nil, fmt.Errorf("некорректное число регистров: %d", count)
+	}
+
+	data, err := c.request(ctx, fc, binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, offset), count))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1 || int(data[0]) != 2*int(count) || len(data) < 1+2*int(count) {
+		return nil, fmt.Errorf("некорректная длина ответа: %d байт на %d регистров", len(data), count)
+	}
+
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(data[1+2*i:])
+	}
+	return regs, nil
+}
+
+// ReadBits читает count бит таблицы Coils или DiscreteInputs
+func (c *Client) ReadBits(ctx context.Context, table Table, offset, count uint16) ([]bool, error) {
+	fc := byte(fcReadCoils)
+	switch {
+	case table == DiscreteInputs:
+		fc = fcReadDiscreteInputs
+	case table != Coils:
+		return nil, fmt.Errorf("таблица %s не хранит биты", table)
+	}
+	if count < 1 || count > MaxReadBits {
+		return nil, fmt.Errorf("некорректное число бит: %d", count)
+	}
+
+	data, err := c.request(ctx, fc, binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, offset), count))
+	if err != nil {
+		return nil, err
+	}
+	size := (int(count) + 7) / 8
+	if len(data) < 1 || int(data[0]) != size || len(data) < 1+size {
+		return nil, fmt.Errorf("некорректная длина ответа: %d байт на %d бит", len(data), count)
+	}
+	return unpackBits(data[1:], int(count)), nil
+}
+
+// WriteRegisters записывает регистры хранения начиная с offset.
+// Один регистр пишется функцией 0x06: её поддерживают все устройства.
+func (c *Client) WriteRegisters(ctx context.Context, offset uint16, values []uint16) error {
+	if len(values) < 1 || len(values) > MaxWriteRegisters {
+		return fmt.Errorf("некорректное число регистров: %d", len(values))
+	}
+
+	request := binary.BigEndian.AppendUint16(nil, offset)
+	if len(values) == 1 {
+		request = binary.BigEndian.AppendUint16(request, values[0])
+		_, err := c.request(ctx, fcWriteSingleRegister, request)
+		return err
+	}
+
+	request = binary.BigEndian.AppendUint16(request, uint16(len(values)))
+	request = append(request, byte(2*len(values)))
+	for _, v := range values {
+		request = binary.BigEndian.AppendUint16(request, v)
+	}
+	_, err := c.request(ctx, fcWriteMultipleRegisters, request)
+	return err
+}
+
+// WriteCoils записывает дискретные выходы начиная с offset
+func (c *Client) WriteCoils(ctx context.Context, offset uint16, values []bool) error {
+	if len(values) < 1 || len(values) > MaxWriteBits {
+		return fmt.Errorf("некорректное число бит: %d", len(values))
+	}
+
+	request := binary.BigEndian.AppendUint16(nil, offset)
+	if len(values) == 1 {
+		var value uint16
+		if values[0] {
+			value = 0xFF00
+		}
+		_, err := c.request(ctx, fcWriteSingleCoil, binary.BigEndian.AppendUint16(request, value))
+		return err
+	}
+
+	packed := packBits(values)
+	request = binary.BigEndian.AppendUint16(request, uint16(len(values)))
+	request = append(request, byte(len(packed)))
+	_, err := c.request(ctx, fcWriteMultipleCoils, append(request, packed...))
+	return err
+}
+
+// request отправляет PDU с функцией fc и возвращает данные ответа без кода функции
+func (c *Client) request(ctx context.Context, fc byte, data []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil, fmt.Errorf("нет соединения с %s", c.address)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	c.txID++
+	frame := make([]byte, mbapHeaderSize, mbapHeaderSize+1+len(data))
+	binary.BigEndian.PutUint16(frame[0:], c.txID)
+	binary.BigEndian.PutUint16(frame[4:], uint16(2+len(data)))
+	frame[6] = c.unitID
+	frame = append(append(frame, fc), data...)
+
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, c.fail(err)
+	}
+
+	header := make([]byte, mbapHeaderSize)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, c.fail(err)
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 254 {
+		return nil, c.fail(fmt.Errorf("некорректная длина кадра: %d", length))
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return nil, c.fail(err)
+	}
+	if txID := binary.BigEndian.Uint16(header[0:]); txID != c.txID {
+		return nil, c.fail(fmt.Errorf("ответ на чужую транзакцию: %d вместо %d", txID, c.txID))
+	}
+
+	switch pdu[0] {
+	case fc:
+		return pdu[1:], nil
+	case fc | 0x80:
+		if len(pdu) < 2 {
+			return nil, fmt.Errorf("короткий ответ с исключением")
+		}
+		return nil, &Exception{Function: fc, Code: pdu[1]}
+	default:
+		return nil, c.fail(fmt.Errorf("ответ с функцией 0x%02X на запрос 0x%02X", pdu[0], fc))
+	}
+}
+
+// fail закрывает соединение после ошибки обмена: поток кадров рассинхронизирован
+func (c *Client) fail(err error) error {
+	c.conn.Close()
+	c.conn = nil
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("нет ответа от %s: %w", c.address, err)
+	}
+	return fmt.Errorf("ошибка обмена с %s: %w", c.address, err)
+}
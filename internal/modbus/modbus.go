@@ -0,0 +1,225 @@
+// Package modbus — клиент и сервер Modbus TCP. Клиент используется драйвером
+// modbus пакета plc, сервер с таблицами в памяти — для проверки опроса без
+// реального устройства.
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort стандартный порт Modbus TCP
+const DefaultPort = 502
+
+// Пределы одного запроса по спецификации Modbus
+const (
+	MaxReadRegisters  = 125
+	MaxWriteRegisters = 123
+	MaxReadBits       = 2000
+	MaxWriteBits      = 1968
+)
+
+// Коды функций
+const (
+	fcReadCoils              = 0x01
+	fcReadDiscreteInputs     = 0x02
+	fcReadHoldingRegisters   = 0x03
+	fcReadInputRegisters     = 0x04
+	fcWriteSingleCoil        = 0x05
+	fcWriteSingleRegister    = 0x06
+	fcWriteMultipleCoils     = 0x0F
+	fcWriteMultipleRegisters = 0x10
+)
+
+// Коды исключений
+const (
+	ExceptionIllegalFunction    = 0x01
+	ExceptionIllegalAddress     = 0x02
+	ExceptionIllegalValue       = 0x03
+	ExceptionServerDeviceFailed = 0x04
+)
+
+// Table область данных устройства
+type Table int
+
+const (
+	Coils            Table = iota // Дискретные выходы, чтение и запись (0xxxx)
+	DiscreteInputs                // Дискретные входы, только чтение (1xxxx)
+	InputRegisters                // Входные регистры, только чтение (3xxxx)
+	HoldingRegisters              // Регистры хранения, чтение и запись (4xxxx)
+)
+
+func (t Table) String() string {
+	switch t {
+	case Coils:
+		return "coil"
+	case DiscreteInputs:
+		return "di"
+	case InputRegisters:
+		return "ir"
+	case HoldingRegisters:
+		return "hr"
+	default:
+		return "unknown"
+	}
+}
+
+// IsBits сообщает, что таблица хранит биты, а не 16-битные регистры
+func (t Table) IsBits() bool {
+	return t == Coils || t == DiscreteInputs
+}
+
+// Writable сообщает, что таблицу можно записывать
+func (t Table) Writable() bool {
+	return t == Coils || t == HoldingRegisters
+}
+
+// Address адрес в таблице устройства; Offset считается от нуля
+type Address struct {
+	Table  Table
+	Offset uint16
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("%s:%d", a.Table, a.Offset)
+}
+
+// ParseAddress разбирает адрес тега: таблица и смещение от нуля (hr:100,
+// ir:0, coil:5, di:7) или номер Modicon с единицы (40101 — hr:100, 300001 — ir:0)
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if table, offset, ok := strings.Cut(s, ":"); ok {
+		var a Address
+		switch strings.ToLower(strings.TrimSpace(table)) {
+		case "coil", "co":
+			a.Table = Coils
+		case "di":
+			a.Table = DiscreteInputs
+		case "ir":
+			a.Table = InputRegisters
+		case "hr":
+			a.Table = HoldingRegisters
+		default:
+			return Address{}, fmt.Errorf("некорректный адрес Modbus %q: неизвестная таблица %q (coil, di, ir, hr)", s, table)
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(offset), 10, 16)
+		if err != nil {
+			return Address{}, fmt.Errorf("некорректный адрес Modbus %q: смещение 0..65535", s)
+		}
+		a.Offset = uint16(n)
+		return a, nil
+	}
+
+	// Номер Modicon: первая цифра — таблица, остальные — номер с единицы
+	if len(s) != 5 && len(s) != 6 {
+		return Address{}, fmt.Errorf("некорректный адрес Modbus %q: ожидается hr:100 или 40101", s)
+	}
+	n, err := strconv.ParseUint(s[1:], 10, 32)
+	if err != nil || n < 1 || n > 65536 {
+		return Address{}, fmt.Errorf("некорректный адрес Modbus %q", s)
+	}
+	a := Address{Offset: uint16(n - 1)}
+	switch s[0] {
+	case '0':
+		a.Table = Coils
+	case '1':
+		a.Table = DiscreteInputs
+	case '3':
+		a.Table = InputRegisters
+	case '4':
+		a.Table = HoldingRegisters
+	default:
+		return Address{}, fmt.Errorf("некорректный адрес Modbus %q: неизвестная таблица %c", s, s[0])
+	}
+	return a, nil
+}
+
+// Encoding порядок слов и байт в значениях из нескольких регистров.
+// По спецификации регистр передаётся старшим байтом вперёд, а порядок
+// регистров в 32- и 64-битных значениях у каждого производителя свой.
+type Encoding struct {
+	LowWordFirst bool // Первый регистр — младшее слово (word swap)
+	ByteSwap     bool // Младший байт регистра передаётся первым
+}
+
+// Bytes переводит регистры значения в байты little-endian
+func (e Encoding) Bytes(regs []uint16) []byte {
+	b := make([]byte, 2*len(regs))
+	for i, reg := range regs {
+		if e.ByteSwap {
+			reg = reg<<8 | reg>>8
+		}
+		word := len(regs) - 1 - i // Номер слова от младшего
+		if e.LowWordFirst {
+			word = i
+		}
+		binary.LittleEndian.PutUint16(b[2*word:], reg)
+	}
+	return b
+}
+
+// Registers переводит байты little-endian в регистры; обратное к Bytes.
+// Нечётная длина дополняется нулевым старшим байтом.
+func (e Encoding) Registers(b []byte) []uint16 {
+	if len(b)%2 == 1 {
+		b = append(b[:len(b):len(b)], 0)
+	}
+	regs := make([]uint16, len(b)/2)
+	for i := range regs {
+		word := len(regs) - 1 - i
+		if e.LowWordFirst {
+			word = i
+		}
+		reg := binary.LittleEndian.Uint16(b[2*word:])
+		if e.ByteSwap {
+			reg = reg<<8 | reg>>8
+		}
+		regs[i] = reg
+	}
+	return regs
+}
+
+// Exception ответ устройства с кодом исключения
+type Exception struct {
+	Function byte
+	Code     byte
+}
+
+func (e *Exception) Error() string {
+	var text string
+	switch e.Code {
+	case ExceptionIllegalFunction:
+		text = "функция не поддерживается"
+	case ExceptionIllegalAddress:
+		text = "недопустимый адрес"
+	case ExceptionIllegalValue:
+		text = "недопустимое значение"
+	case ExceptionServerDeviceFailed:
+		text = "ошибка устройства"
+	default:
+		text = "исключение"
+	}
+	return fmt.Sprintf("Modbus: %s (код 0x%02X, функция 0x%02X)", text, e.Code, e.Function)
+}
+
+// packBits упаковывает биты по 8 в байт, младший бит первым
+func packBits(bits []bool) []byte {
+	b := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// unpackBits распаковывает count бит из b
+func unpackBits(b []byte, count int) []bool {
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = b[i/8]&(1<<(i%8)) != 0
+	}
+	return bits
+}
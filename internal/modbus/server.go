@@ -0,0 +1,275 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Server сервер Modbus TCP с таблицами в памяти. Отвечает на любой unit ID;
+// используется вместо устройства при проверке опроса.
+type Server struct {
+	mu       sync.Mutex // Защищает таблицы
+	coils    []bool
+	discrete []bool
+	input    []uint16
+	holding  []uint16
+	requests int // Число выполненных запросов
+
+	listener net.Listener
+	conns    map[net.Conn]struct{} // Под mu
+	wg       sync.WaitGroup
+}
+
+// NewServer создаёт сервер, в каждой таблице которого size адресов
+func NewServer(size int) *Server {
+	return &Server{
+		coils:    make([]bool, size),
+		discrete: make([]bool, size),
+		input:    make([]uint16, size),
+		holding:  make([]uint16, size),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen начинает принимать соединения на address (127.0.0.1:0 — свободный порт)
+func (s *Server) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func(conn net.Conn) {
+				defer s.wg.Done()
+				s.serve(conn)
+			}(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr возвращает адрес, на котором сервер принимает соединения
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close закрывает сервер и все соединения
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// SetRegisters записывает регистры таблицы InputRegisters или HoldingRegisters
+func (s *Server) SetRegisters(table Table, offset uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.registers(table)[offset:], values)
+}
+
+// Registers возвращает count регистров таблицы
+func (s *Server) Registers(table Table, offset, count uint16) []uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint16(nil), s.registers(table)[offset:offset+count]...)
+}
+
+// SetBits записывает биты таблицы Coils или DiscreteInputs
+func (s *Server) SetBits(table Table, offset uint16, values ...bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.bits(table)[offset:], values)
+}
+
+// Bits возвращает count бит таблицы
+func (s *Server) Bits(table Table, offset, count uint16) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bool(nil), s.bits(table)[offset:offset+count]...)
+}
+
+// Requests возвращает число запросов, полученных сервером, включая
+// отклонённые исключением
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) registers(table Table) []uint16 {
+	if table == InputRegisters {
+		return s.input
+	}
+	return s.holding
+}
+
+func (s *Server) bits(table Table) []bool {
+	if table == DiscreteInputs {
+		return s.discrete
+	}
+	return s.coils
+}
+
+// serve обрабатывает кадры одного соединения до его закрытия
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	header := make([]byte, mbapHeaderSize)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > 254 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		response := s.handle(pdu)
+		frame := make([]byte, mbapHeaderSize, mbapHeaderSize+len(response))
+		copy(frame, header)
+		binary.BigEndian.PutUint16(frame[4:], uint16(1+len(response)))
+		if _, err := conn.Write(append(frame, response...)); err != nil {
+			return
+		}
+	}
+}
+
+// errException ответ исключением с кодом
+type errException byte
+
+func (e errException) Error() string { return "exception" }
+
+// handle выполняет запрос и возвращает PDU ответа
+func (s *Server) handle(pdu []byte) []byte {
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+
+	fc := pdu[0]
+	data, err := s.execute(fc, pdu[1:])
+	var code errException
+	if errors.As(err, &code) {
+		return []byte{fc | 0x80, byte(code)}
+	}
+	return append([]byte{fc}, data...)
+}
+
+func (s *Server) execute(fc byte, req []byte) ([]byte, error) {
+	if len(req) < 4 {
+		return nil, errException(ExceptionIllegalValue)
+	}
+	offset := int(binary.BigEndian.Uint16(req[0:]))
+	value := binary.BigEndian.Uint16(req[2:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch fc {
+	case fcReadCoils, fcReadDiscreteInputs:
+		table := s.bits(Coils)
+		if fc == fcReadDiscreteInputs {
+			table = s.bits(DiscreteInputs)
+		}
+		count := int(value)
+		if count < 1 || count > MaxReadBits {
+			return nil, errException(ExceptionIllegalValue)
+		}
+		if offset+count > len(table) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		packed := packBits(table[offset : offset+count])
+		return append([]byte{byte(len(packed))}, packed...), nil
+
+	case fcReadHoldingRegisters, fcReadInputRegisters:
+		table := s.registers(HoldingRegisters)
+		if fc == fcReadInputRegisters {
+			table = s.registers(InputRegisters)
+		}
+		count := int(value)
+		if count < 1 || count > MaxReadRegisters {
+			return nil, errException(ExceptionIllegalValue)
+		}
+		if offset+count > len(table) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		response := []byte{byte(2 * count)}
+		for _, reg := range table[offset : offset+count] {
+			response = binary.BigEndian.AppendUint16(response, reg)
+		}
+		return response, nil
+
+	case fcWriteSingleCoil:
+		if value != 0 && value != 0xFF00 {
+			return nil, errException(ExceptionIllegalValue)
+		}
+		if offset >= len(s.coils) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		s.coils[offset] = value == 0xFF00
+		return req[:4], nil
+
+	case fcWriteSingleRegister:
+		if offset >= len(s.holding) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		s.holding[offset] = value
+		return req[:4], nil
+
+	case fcWriteMultipleCoils:
+		count := int(value)
+		if count < 1 || count > MaxWriteBits || len(req) < 5+(count+7)/8 {
+			return nil, errException(ExceptionIllegalValue)
+		}
+		if offset+count > len(s.coils) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		copy(s.coils[offset:], unpackBits(req[5:], count))
+		return req[:4], nil
+
+	case fcWriteMultipleRegisters:
+		count := int(value)
+		if count < 1 || count > MaxWriteRegisters || len(req) < 5+2*count {
+			return nil, errException(ExceptionIllegalValue)
+		}
+		if offset+count > len(s.holding) {
+			return nil, errException(ExceptionIllegalAddress)
+		}
+		for i := 0; i < count; i++ {
+			s.holding[offset+i] = binary.BigEndian.Uint16(req[5+2*i:])
+		}
+		return req[:4], nil
+
+	default:
+		return nil, errException(ExceptionIllegalFunction)
+	}
+}
@@ -0,0 +1,88 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"plc_tsdb/internal/database"
+)
+
+// Поля JSON с меткой времени значения (мс Unix или RFC 3339)
+var jsonTimestampFields = []string{"timestamp", "ts"}
+
+// decodeJSON разбирает сообщение JSON в значения по путям полей: члены
+// объектов через точку, элементы массивов — [i], как у структур ПЛК.
+// Число или логическое значение вне объекта получает пустой путь.
+// Строки пропускаются, null записывается без значения с плохим качеством.
+func decodeJSON(b []byte) (map[string]interface{}, time.Time, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var timestamp time.Time
+	if object, isObject := document.(map[string]interface{}); isObject {
+		for _, field := range jsonTimestampFields {
+			raw, exists := object[field]
+			if !exists {
+				continue
+			}
+			parsed, err := parseJSONTime(raw)
+			if err != nil {
+				return nil, time.Time{}, fmt.Errorf("поле %s: %w", field, err)
+			}
+			timestamp = parsed
+			delete(object, field)
+			break
+		}
+	}
+
+	values := make(map[string]interface{})
+	flattenJSON("", document, values)
+	return values, timestamp, nil
+}
+
+func flattenJSON(path string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, member := range v {
+			name := key
+			if path != "" {
+				name = path + "." + key
+			}
+			flattenJSON(name, member, out)
+		}
+	case []interface{}:
+		for i, element := range v {
+			flattenJSON(fmt.Sprintf("%s[%d]", path, i), element, out)
+		}
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			out[path] = integer
+		} else if real, err := v.Float64(); err == nil {
+			out[path] = real
+		}
+	case bool:
+		out[path] = v
+	case nil:
+		out[path] = database.Sample{Quality: database.QualityBad}
+	}
+}
+
+func parseJSONTime(raw interface{}) (time.Time, error) {
+	switch v := raw.(type) {
+	case json.Number:
+		ms, err := v.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("ожидаются миллисекунды Unix: %s", v)
+		}
+		return time.UnixMilli(ms), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	return time.Time{}, fmt.Errorf("неподдерживаемая метка времени %v", raw)
+}
@@ -0,0 +1,523 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/plc"
+)
+
+// Параметры подключения к брокеру
+const (
+	connectTimeout       = 10 * time.Second
+	keepAlive            = 30 * time.Second
+	maxReconnectInterval = time.Minute
+	publishTimeout       = 5 * time.Second
+	disconnectQuiesce    = 250 // мс на завершение отправки при отключении
+)
+
+// rebirthInterval минимальный интервал между запросами перерождения одного узла
+const rebirthInterval = 10 * time.Second
+
+// Source источник данных MQTT. Значения каждого сообщения передаются в emit
+// одной пачкой точек; emit вызывается последовательно, под блокировкой.
+type Source struct {
+	name   string
+	config config.MQTTConfig
+	emit   func([]database.Point)
+	client paho.Client
+
+	mu      sync.Mutex
+	nodes   map[string]*node // Узлы Sparkplug: группа/узел -> состояние
+	stopped bool
+}
+
+// node состояние узла Sparkplug B между NBIRTH и NDEATH
+type node struct {
+	group, id   string
+	bdSeq       int64 // bdSeq из NBIRTH; -1 — неизвестен
+	seq         int64 // Номер последнего сообщения узла; -1 — неизвестен
+	aliases     map[uint64]string
+	self        *endpoint
+	devices     map[string]*endpoint
+	lastRebirth time.Time
+}
+
+// endpoint узел или устройство: признак «в сети», типы метрик из
+// BIRTH и последние записанные значения рядов
+type endpoint struct {
+	online bool
+	lost   bool // Вне сети из-за потери связи с брокером, а не по DEATH
+	types  map[string]uint32
+	values map[string]interface{}
+}
+
+func newEndpoint() *endpoint {
+	return &endpoint{types: make(map[string]uint32), values: make(map[string]interface{})}
+}
+
+// NewSource создаёт источник; подключение выполняет Start
+func NewSource(name string, cfg config.MQTTConfig, emit func([]database.Point)) *Source {
+	return &Source{
+		name:   name,
+		config: cfg,
+		emit:   emit,
+		nodes:  make(map[string]*node),
+	}
+}
+
+// Start подключается к брокеру. Подключение и переподключение идут в
+// фоне, поэтому недоступный брокер не задерживает запуск сборщика.
+func (s *Source) Start() {
+	clientID := s.config.ClientID
+	if clientID == "" {
+		clientID = "plc_tsdb-" + s.name
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(s.config.Broker).
+		SetClientID(clientID).
+		SetUsername(s.config.Username).
+		SetPassword(s.config.Password).
+		SetCleanSession(true).
+		SetKeepAlive(keepAlive).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(maxReconnectInterval).
+		SetOnConnectHandler(s.onConnect).
+		SetConnectionLostHandler(s.onConnectionLost)
+
+	// Основной хост объявляет себя через STATE; завещание брокер
+	// публикует сам, если сборщик пропадёт без отключения
+	if s.config.HostID != "" {
+		opts.SetBinaryWill(s.stateTopic(), statePayload(false, time.Now()), 1, true)
+	}
+
+	s.client = paho.NewClient(opts)
+	s.client.Connect()
+	logging.Info("Подключение к брокеру MQTT", "источник", s.name, "broker", s.config.Broker)
+}
+
+// Stop отключается от брокера. После возврата emit больше не вызывается.
+func (s *Source) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	if s.client == nil {
+		return
+	}
+	if s.config.HostID != "" && s.client.IsConnected() {
+		s.client.Publish(s.stateTopic(), 1, true, statePayload(false, time.Now())).WaitTimeout(publishTimeout)
+	}
+	s.client.Disconnect(disconnectQuiesce)
+}
+
+func (s *Source) onConnect(client paho.Client) {
+	logging.Info("Подключено к брокеру MQTT", "источник", s.name, "broker", s.config.Broker)
+
+	filters := make(map[string]byte)
+	for _, group := range s.config.Groups {
+		filters[fmt.Sprintf("%s/%s/#", sparkplugNamespace, group)] = 1
+	}
+	if len(filters) > 0 {
+		if token := client.SubscribeMultiple(filters, s.handleSparkplug); token.WaitTimeout(publishTimeout) && token.Error() != nil {
+			logging.Error("Ошибка подписки MQTT", "источник", s.name, "error", token.Error())
+		}
+	}
+	for _, filter := range s.config.Topics {
+		if token := client.Subscribe(filter, 1, s.handleJSON); token.WaitTimeout(publishTimeout) && token.Error() != nil {
+			logging.Error("Ошибка подписки MQTT", "источник", s.name, "топик", filter, "error", token.Error())
+		}
+	}
+
+	if s.config.HostID != "" {
+		client.Publish(s.stateTopic(), 1, true, statePayload(true, time.Now()))
+	}
+
+	// Пока связи не было, узлы могли переродиться: состояние
+	// восстанавливается по их новым NBIRTH
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range s.nodes {
+		s.requestRebirth(n, "переподключение к брокеру")
+	}
+}
+
+// onConnectionLost помечает все узлы как вне сети: пока связи с брокером
+// нет, их значения неизвестны. Состояние из BIRTH сохраняется, чтобы после
+// переподключения принять данные узла без нового NBIRTH, см. resume.
+func (s *Source) onConnectionLost(_ paho.Client, err error) {
+	logging.Error("Потеряна связь с брокером MQTT", "источник", s.name, "error", err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	values := make(map[string]interface{})
+	for _, n := range s.nodes {
+		n.self.lost = n.self.online
+		for _, device := range n.devices {
+			device.lost = device.online
+		}
+		s.nodeOffline(n, values)
+	}
+	s.emitValues(values, now)
+}
+
+// handleSparkplug обрабатывает сообщение Sparkplug B
+func (s *Source) handleSparkplug(_ paho.Client, msg paho.Message) {
+	received := time.Now()
+	t, ok := parseTopic(msg.Topic())
+	if !ok {
+		return // STATE и прочие топики пространства имён
+	}
+	switch t.kind {
+	case msgNodeBirth, msgNodeDeath, msgNodeData, msgDevBirth, msgDevDeath, msgDevData:
+	default:
+		return // Команды NCMD/DCMD, в том числе свои запросы перерождения
+	}
+
+	p, err := decodePayload(msg.Payload())
+	if err != nil {
+		logging.Warn("Некорректное сообщение Sparkplug B", "источник", s.name, "топик", msg.Topic(), "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	key := t.group + "/" + t.node
+	n := s.nodes[key]
+	values := make(map[string]interface{})
+
+	switch t.kind {
+	case msgNodeBirth:
+		n = &node{group: t.group, id: t.node, bdSeq: -1, seq: -1, aliases: make(map[uint64]string), self: newEndpoint(), devices: make(map[string]*endpoint)}
+		if previous := s.nodes[key]; previous != nil {
+			n.lastRebirth = previous.lastRebirth
+		}
+		s.nodes[key] = n
+		if bdSeq, found := findMetric(p, metricBdSeq); found {
+			n.bdSeq = int64(bdSeq.intValue)
+		}
+		n.seq = int64(p.seq)
+		s.birth(n, n.self, t, p, values)
+		logging.Info("Узел Sparkplug в сети", "источник", s.name, "группа", t.group, "узел", t.node, "метрик", len(n.self.types))
+
+	case msgNodeDeath:
+		if n == nil || !(n.self.online || n.self.lost) {
+			break
+		}
+		// NDEATH прошлой сессии узла (завещание) приходит и после его
+		// нового NBIRTH; такой death отличается bdSeq
+		if bdSeq, found := findMetric(p, metricBdSeq); found && n.bdSeq >= 0 && int64(bdSeq.intValue) != n.bdSeq {
+			logging.Debug("NDEATH прошлой сессии узла пропущен", "источник", s.name, "группа", t.group, "узел", t.node)
+			break
+		}
+		n.self.lost = false
+		s.nodeOffline(n, values)
+		logging.Warn("Узел Sparkplug вне сети", "источник", s.name, "группа", t.group, "узел", t.node)
+
+	default:
+		if n != nil && n.self.lost {
+			s.resume(n, p, values)
+		}
+		if n == nil || !n.self.online {
+			n = s.unknownNode(key, t)
+			s.requestRebirth(n, "сообщение от узла без NBIRTH")
+			break
+		}
+		s.checkSeq(n, p)
+
+		switch t.kind {
+		case msgDevBirth:
+			device := newEndpoint()
+			n.devices[t.device] = device
+			s.birth(n, device, t, p, values)
+			logging.Info("Устройство Sparkplug в сети", "источник", s.name, "группа", t.group, "узел", t.node, "устройство", t.device, "метрик", len(device.types))
+
+		case msgDevDeath:
+			if device := n.devices[t.device]; device != nil && device.online {
+				s.offline(device, t, values)
+				logging.Warn("Устройство Sparkplug вне сети", "источник", s.name, "группа", t.group, "узел", t.node, "устройство", t.device)
+			}
+
+		case msgNodeData:
+			s.data(n, n.self, t, p, values)
+
+		case msgDevData:
+			device := n.devices[t.device]
+			if device == nil || !device.online {
+				s.requestRebirth(n, "данные устройства без DBIRTH")
+				break
+			}
+			s.data(n, device, t, p, values)
+		}
+	}
+
+	s.emitValues(values, received)
+}
+
+// unknownNode возвращает состояние узла, от которого не было NBIRTH;
+// оно нужно, чтобы ограничить частоту запросов перерождения
+func (s *Source) unknownNode(key string, t topic) *node {
+	n := s.nodes[key]
+	if n == nil {
+		n = &node{group: t.group, id: t.node, bdSeq: -1, seq: -1, aliases: make(map[uint64]string), self: newEndpoint(), devices: make(map[string]*endpoint)}
+		s.nodes[key] = n
+	}
+	return n
+}
+
+// resume возвращает в сеть узел и его устройства, выпавшие из-за потери
+// связи с брокером, если seq сообщения продолжает последовательность: узел
+// за это время ничего не публиковал, и метрики из BIRTH действительны.
+// Иначе сообщения пропущены, и узел остаётся вне сети до NBIRTH.
+func (s *Source) resume(n *node, p payload, values map[string]interface{}) {
+	if !p.hasSeq || n.seq < 0 || int64(p.seq) != (n.seq+1)%256 {
+		return
+	}
+	for deviceID, device := range n.devices {
+		if device.lost {
+			device.online, device.lost = true, false
+			values[plc.DiagSeries(s.prefix(topic{group: n.group, node: n.id, device: deviceID}), "connected")] = 1
+		}
+	}
+	n.self.online, n.self.lost = true, false
+	values[plc.DiagSeries(s.prefix(topic{group: n.group, node: n.id}), "connected")] = 1
+	logging.Info("Узел Sparkplug снова в сети после переподключения", "источник", s.name, "группа", n.group, "узел", n.id)
+}
+
+// checkSeq проверяет непрерывность номеров сообщений узла (0..255 по кругу);
+// пропуск означает потерю сообщений, и узел просят переродиться
+func (s *Source) checkSeq(n *node, p payload) {
+	if !p.hasSeq {
+		return
+	}
+	if n.seq >= 0 && int64(p.seq) != (n.seq+1)%256 {
+		logging.Warn("Пропуск сообщений Sparkplug", "источник", s.name, "группа", n.group, "узел", n.id, "ожидался seq", (n.seq+1)%256, "получен", p.seq)
+		s.requestRebirth(n, "пропуск seq")
+	}
+	n.seq = int64(p.seq)
+}
+
+// birth регистрирует метрики из NBIRTH/DBIRTH и записывает их значения
+func (s *Source) birth(n *node, e *endpoint, t topic, p payload, values map[string]interface{}) {
+	e.online = true
+	for _, m := range p.metrics {
+		if m.name == "" {
+			continue
+		}
+		e.types[m.name] = m.datatype
+		if m.hasAlias {
+			n.aliases[m.alias] = m.name
+		}
+		if m.name == metricBdSeq || strings.HasPrefix(m.name, "Node Control/") {
+			continue
+		}
+		s.addValue(e, t, m.name, m, m.datatype, p, values)
+	}
+	values[plc.DiagSeries(s.prefix(t), "connected")] = 1
+}
+
+// data записывает значения из NDATA/DDATA. Метрика может прийти только
+// с псевдонимом и без типа — они берутся из BIRTH.
+func (s *Source) data(n *node, e *endpoint, t topic, p payload, values map[string]interface{}) {
+	for _, m := range p.metrics {
+		name := m.name
+		if name == "" && m.hasAlias {
+			name = n.aliases[m.alias]
+		}
+		datatype, known := e.types[name]
+		if name == "" || !known {
+			s.requestRebirth(n, "метрика не объявлена в BIRTH")
+			continue
+		}
+		if m.datatype != 0 {
+			datatype = m.datatype
+		}
+		s.addValue(e, t, name, m, datatype, p, values)
+	}
+}
+
+// addValue добавляет значение метрики в пачку и запоминает его для
+// записи с признаком потери связи. Нечисловые метрики пропускаются.
+func (s *Source) addValue(e *endpoint, t topic, name string, m metric, datatype uint32, p payload, values map[string]interface{}) {
+	var timestamp time.Time
+	switch {
+	case m.timestamp != 0:
+		timestamp = time.UnixMilli(int64(m.timestamp))
+	case p.timestamp != 0:
+		timestamp = time.UnixMilli(int64(p.timestamp))
+	}
+
+	sample := database.Sample{Quality: database.QualityGood, Timestamp: timestamp}
+	if m.isNull {
+		sample.Quality = database.QualityBad
+	} else {
+		value, ok := m.value(datatype)
+		if !ok {
+			return
+		}
+		sample.Value = value
+		if m.quality >= 0 {
+			sample.Quality = daQuality(m.quality)
+		}
+	}
+
+	series := s.series(t, name)
+	values[series] = sample
+	e.values[series] = sample
+}
+
+// nodeOffline помечает узел и все его устройства как вне сети
+func (s *Source) nodeOffline(n *node, values map[string]interface{}) {
+	for deviceID, device := range n.devices {
+		if device.online {
+			s.offline(device, topic{group: n.group, node: n.id, device: deviceID}, values)
+		}
+	}
+	if n.self.online {
+		s.offline(n.self, topic{group: n.group, node: n.id}, values)
+	}
+}
+
+// offline записывает последние значения узла или устройства с признаком
+// потери связи, как сборщик делает для непрочитанных тегов ПЛК
+func (s *Source) offline(e *endpoint, t topic, values map[string]interface{}) {
+	e.online = false
+	for series, lastValue := range e.values {
+		if sample, isSample := lastValue.(database.Sample); isSample {
+			lastValue = sample.Value // Качество и метка времени прошлого значения не переносятся
+		}
+		values[series] = database.Sample{Value: lastValue, Quality: database.QualityCommFailure}
+	}
+	values[plc.DiagSeries(s.prefix(t), "connected")] = 0
+}
+
+// requestRebirth просит узел повторить NBIRTH и DBIRTH (NCMD Node
+// Control/Rebirth), не чаще rebirthInterval
+func (s *Source) requestRebirth(n *node, reason string) {
+	if !s.config.RequestsRebirth() || time.Since(n.lastRebirth) < rebirthInterval {
+		return
+	}
+	n.lastRebirth = time.Now()
+	logging.Info("Запрос перерождения узла Sparkplug", "источник", s.name, "группа", n.group, "узел", n.id, "причина", reason)
+
+	cmdTopic := fmt.Sprintf("%s/%s/%s/%s", sparkplugNamespace, n.group, msgNodeCommand, n.id)
+	s.client.Publish(cmdTopic, 0, false, encodeRebirth(time.Now()))
+}
+
+// handleJSON обрабатывает сообщение с JSON: ряды <источник>/<топик>[/<поле>]
+func (s *Source) handleJSON(_ paho.Client, msg paho.Message) {
+	received := time.Now()
+	fields, timestamp, err := decodeJSON(msg.Payload())
+	if err != nil {
+		logging.Warn("Некорректный JSON в сообщении MQTT", "источник", s.name, "топик", msg.Topic(), "error", err)
+		return
+	}
+	if timestamp.IsZero() {
+		timestamp = received
+	}
+
+	values := make(map[string]interface{}, len(fields))
+	for path, value := range fields {
+		name := msg.Topic()
+		switch {
+		case path == "":
+		case strings.HasPrefix(path, "["):
+			name += path
+		default:
+			name += "/" + path
+		}
+		values[s.rename(name)] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.emitValues(values, timestamp)
+	}
+}
+
+// emitValues передаёт значения сборщику; вызывается под s.mu
+func (s *Source) emitValues(values map[string]interface{}, timestamp time.Time) {
+	if len(values) == 0 || s.stopped {
+		return
+	}
+	s.emit(database.PointsAt(values, timestamp))
+}
+
+// prefix возвращает префикс рядов узла или устройства:
+// источник/группа/узел[/устройство]
+func (s *Source) prefix(t topic) string {
+	prefix := fmt.Sprintf("%s/%s/%s", s.name, t.group, t.node)
+	if t.device != "" {
+		prefix += "/" + t.device
+	}
+	return prefix
+}
+
+// series возвращает имя ряда метрики с учётом переименований
+func (s *Source) series(t topic, metricName string) string {
+	name := t.group + "/" + t.node
+	if t.device != "" {
+		name += "/" + t.device
+	}
+	return s.rename(name + "/" + metricName)
+}
+
+// rename возвращает имя ряда: переименованное в конфигурации или с префиксом источника
+func (s *Source) rename(name string) string {
+	if renamed, ok := s.config.Series[name]; ok {
+		return renamed
+	}
+	return s.name + "/" + name
+}
+
+func (s *Source) stateTopic() string {
+	return fmt.Sprintf("%s/STATE/%s", sparkplugNamespace, s.config.HostID)
+}
+
+// statePayload сообщение STATE основного хоста (Sparkplug B 3.0)
+func statePayload(online bool, timestamp time.Time) []byte {
+	b, _ := json.Marshal(struct {
+		Online    bool  `json:"online"`
+		Timestamp int64 `json:"timestamp"`
+	}{online, timestamp.UnixMilli()})
+	return b
+}
+
+// findMetric ищет метрику по имени
+func findMetric(p payload, name string) (metric, bool) {
+	for _, m := range p.metrics {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return metric{}, false
+}
+
+// daQuality переводит код качества OPC DA (свойство Quality метрики) в
+// код качества сборщика: 192 и выше — хорошее, 64..191 — сомнительное
+func daQuality(code int64) database.Quality {
+	switch {
+	case code >= 192:
+		return database.QualityGood
+	case code >= 64:
+		return database.QualityUncertain
+	}
+	return database.QualityBad
+}
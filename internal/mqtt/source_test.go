@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/plc"
+)
+
+// fakeMessage сообщение MQTT, доставленное брокером
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 1 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+// sparkplugMessage кодирует сообщение узла с одной метрикой INT32
+func sparkplugMessage(kind string, seq uint64, name string, value int32) fakeMessage {
+	m := &writer{}
+	m.bytes(1, []byte(name))
+	m.varint(4, typeInt32)
+	m.varint(10, uint64(uint32(value)))
+
+	p := &writer{}
+	p.bytes(2, m.b)
+	p.varint(3, seq)
+	return fakeMessage{topic: sparkplugNamespace + "/Plant/" + kind + "/Edge1", payload: p.b}
+}
+
+// newTestSource создаёт источник без запросов перерождения, собирающий
+// переданные точки по именам рядов
+func newTestSource(points map[string]interface{}) *Source {
+	rebirth := false
+	cfg := config.MQTTConfig{Broker: "tcp://127.0.0.1:1883", Groups: []string{"Plant"}, Rebirth: &rebirth}
+	return NewSource("mqtt", cfg, func(batch []database.Point) {
+		for _, point := range batch {
+			points[point.Tag] = point.Value
+		}
+	})
+}
+
+func TestSparkplugDataAfterReconnect(t *testing.T) {
+	const series = "mqtt/Plant/Edge1/Speed"
+	connected := plc.DiagSeries("mqtt/Plant/Edge1", "connected")
+
+	tests := []struct {
+		name    string
+		seq     uint64
+		resumed bool
+	}{
+		{"seq продолжается", 1, true},
+		{"пропуск seq", 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := make(map[string]interface{})
+			s := newTestSource(points)
+
+			s.handleSparkplug(nil, sparkplugMessage(msgNodeBirth, 0, "Speed", 10))
+			s.onConnectionLost(nil, errors.New("EOF"))
+			if sample, _ := points[series].(database.Sample); sample.Quality != database.QualityCommFailure || points[connected] != 0 {
+				t.Fatalf("после потери связи %s = %v, %s = %v", series, points[series], connected, points[connected])
+			}
+
+			clear(points)
+			s.handleSparkplug(nil, sparkplugMessage(msgNodeData, tt.seq, "Speed", 20))
+
+			sample, written := points[series].(database.Sample)
+			if !tt.resumed {
+				if written || len(points) != 0 {
+					t.Errorf("данные при пропуске seq записаны: %v", points)
+				}
+				return
+			}
+			if !written || sample.Value != int32(20) || sample.Quality != database.QualityGood {
+				t.Errorf("%s = %v, ожидалось 20 с хорошим качеством", series, points[series])
+			}
+			if points[connected] != 1 {
+				t.Errorf("%s = %v, ожидалось 1", connected, points[connected])
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+// Package mqtt — источник данных MQTT: подписка на узлы Sparkplug B и на
+// топики с JSON. Значения метрик передаются сборщику рядами в том же виде,
+// что и значения тегов ПЛК.
+package mqtt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Пространство имён топиков Sparkplug B:
+// spBv1.0/<группа>/<тип сообщения>/<узел>[/<устройство>]
+const sparkplugNamespace = "spBv1.0"
+
+// Типы сообщений Sparkplug B
+const (
+	msgNodeBirth   = "NBIRTH"
+	msgNodeDeath   = "NDEATH"
+	msgNodeData    = "NDATA"
+	msgNodeCommand = "NCMD"
+	msgDevBirth    = "DBIRTH"
+	msgDevDeath    = "DDEATH"
+	msgDevData     = "DDATA"
+)
+
+// Служебные метрики узла
+const (
+	metricBdSeq   = "bdSeq"
+	metricRebirth = "Node Control/Rebirth"
+)
+
+// Типы данных метрик Sparkplug B (sparkplug_b.proto, DataType)
+const (
+	typeInt8     = 1
+	typeInt16    = 2
+	typeInt32    = 3
+	typeInt64    = 4
+	typeUInt8    = 5
+	typeUInt16   = 6
+	typeUInt32   = 7
+	typeUInt64   = 8
+	typeFloat    = 9
+	typeDouble   = 10
+	typeBoolean  = 11
+	typeString   = 12
+	typeDateTime = 13
+	typeText     = 14
+)
+
+// Типы полей protobuf
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// topic разобранный топик Sparkplug B
+type topic struct {
+	group, kind, node, device string
+}
+
+// parseTopic разбирает топик spBv1.0/...; ok=false для прочих топиков
+// и для STATE основного хоста
+func parseTopic(name string) (topic, bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) < 4 || len(parts) > 5 || parts[0] != sparkplugNamespace {
+		return topic{}, false
+	}
+	t := topic{group: parts[1], kind: parts[2], node: parts[3]}
+	if len(parts) == 5 {
+		t.device = parts[4]
+	}
+	return t, true
+}
+
+// payload сообщение Sparkplug B (Payload)
+type payload struct {
+	timestamp uint64 // мс Unix; 0 — не задано
+	metrics   []metric
+	seq       uint64
+	hasSeq    bool
+}
+
+// metric метрика Sparkplug B. Значение приводится к типу Go по datatype;
+// строковые и прочие нечисловые значения не разбираются.
+type metric struct {
+	name      string
+	alias     uint64
+	hasAlias  bool
+	timestamp uint64
+	datatype  uint32
+	isNull    bool
+	quality   int64 // Свойство Quality (коды OPC DA); -1 — не задано
+
+	intValue    uint64 // int_value или long_value
+	hasInt      bool
+	floatValue  float64 // float_value или double_value
+	hasFloat    bool
+	boolValue   bool
+	hasBool     bool
+	stringValue string
+}
+
+// value возвращает значение метрики по её типу; ok=false, если метрика
+// не числовая или значение не передано
+func (m metric) value(datatype uint32) (interface{}, bool) {
+	switch datatype {
+	case typeInt8:
+		return int8(m.intValue), m.hasInt
+	case typeInt16:
+		return int16(m.intValue), m.hasInt
+	case typeInt32:
+		return int32(m.intValue), m.hasInt
+	case typeInt64:
+		return int64(m.intValue), m.hasInt
+	case typeUInt8:
+		return uint8(m.intValue), m.hasInt
+	case typeUInt16:
+		return uint16(m.intValue), m.hasInt
+	case typeUInt32:
+		return uint32(m.intValue), m.hasInt
+	case typeUInt64, typeDateTime:
+		return m.intValue, m.hasInt
+	case typeFloat:
+		return float32(m.floatValue), m.hasFloat
+	case typeDouble:
+		return m.floatValue, m.hasFloat
+	case typeBoolean:
+		return m.boolValue, m.hasBool
+	}
+	return nil, false
+}
+
+// reader разбирает сообщение protobuf; ошибка «залипает», как в декодере OPC UA
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+	r.b = nil
+}
+
+func (r *reader) varint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail("некорректный varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) fixed(size int) []byte {
+	if len(r.b) < size {
+		r.fail("неожиданный конец сообщения")
+		return make([]byte, size)
+	}
+	v := r.b[:size]
+	r.b = r.b[size:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	size := r.varint()
+	if size > uint64(len(r.b)) {
+		r.fail("длина поля %d больше остатка сообщения", size)
+		return nil
+	}
+	return r.fixed(int(size))
+}
+
+// field читает ключ следующего поля; ok=false в конце сообщения
+func (r *reader) field() (num int, wire int, ok bool) {
+	if len(r.b) == 0 || r.err != nil {
+		return 0, 0, false
+	}
+	key := r.varint()
+	return int(key >> 3), int(key & 7), r.err == nil
+}
+
+// skip пропускает значение неразбираемого поля
+func (r *reader) skip(wire int) {
+	switch wire {
+	case wireVarint:
+		r.varint()
+	case wireFixed64:
+		r.fixed(8)
+	case wireBytes:
+		r.bytes()
+	case wireFixed32:
+		r.fixed(4)
+	default:
+		r.fail("неподдерживаемый тип поля %d", wire)
+	}
+}
+
+// decodePayload разбирает Payload Sparkplug B
+func decodePayload(b []byte) (payload, error) {
+	var p payload
+	r := &reader{b: b}
+	for {
+		num, wire, ok := r.field()
+		if !ok {
+			break
+		}
+		switch {
+		case num == 1 && wire == wireVarint:
+			p.timestamp = r.varint()
+		case num == 2 && wire == wireBytes:
+			m, err := decodeMetric(r.bytes())
+			if err != nil {
+				return p, fmt.Errorf("метрика %d: %w", len(p.metrics), err)
+			}
+			p.metrics = append(p.metrics, m)
+		case num == 3 && wire == wireVarint:
+			p.seq, p.hasSeq = r.varint(), true
+		default:
+			r.skip(wire)
+		}
+	}
+	return p, r.err
+}
+
+func decodeMetric(b []byte) (metric, error) {
+	m := metric{quality: -1}
+	r := &reader{b: b}
+	for {
+		num, wire, ok := r.field()
+		if !ok {
+			break
+		}
+		switch {
+		case num == 1 && wire == wireBytes:
+			m.name = string(r.bytes())
+		case num == 2 && wire == wireVarint:
+			m.alias, m.hasAlias = r.varint(), true
+		case num == 3 && wire == wireVarint:
+			m.timestamp = r.varint()
+		case num == 4 && wire == wireVarint:
+			m.datatype = uint32(r.varint())
+		case num == 7 && wire == wireVarint:
+			m.isNull = r.varint() != 0
+		case num == 9 && wire == wireBytes:
+			m.quality = decodeQualityProperty(r.bytes())
+		case (num == 10 || num == 11) && wire == wireVarint:
+			m.intValue, m.hasInt = r.varint(), true
+		case num == 12 && wire == wireFixed32:
+			m.floatValue, m.hasFloat = float64(math.Float32frombits(binary.LittleEndian.Uint32(r.fixed(4)))), true
+		case num == 13 && wire == wireFixed64:
+			m.floatValue, m.hasFloat = math.Float64frombits(binary.LittleEndian.Uint64(r.fixed(8))), true
+		case num == 14 && wire == wireVarint:
+			m.boolValue, m.hasBool = r.varint() != 0, true
+		case num == 15 && wire == wireBytes:
+			m.stringValue = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return m, r.err
+}
+
+// decodeQualityProperty ищет в PropertySet свойство Quality (целое, коды
+// OPC DA: 192 — Good) и возвращает его значение; -1, если свойства нет
+func decodeQualityProperty(b []byte) int64 {
+	var keys []string
+	var values []int64
+	r := &reader{b: b}
+	for {
+		num, wire, ok := r.field()
+		if !ok {
+			break
+		}
+		switch {
+		case num == 1 && wire == wireBytes:
+			keys = append(keys, string(r.bytes()))
+		case num == 2 && wire == wireBytes:
+			values = append(values, decodePropertyInt(r.bytes()))
+		default:
+			r.skip(wire)
+		}
+	}
+	for i, key := range keys {
+		if strings.EqualFold(key, "Quality") && i < len(values) {
+			return values[i]
+		}
+	}
+	return -1
+}
+
+// decodePropertyInt возвращает целое значение PropertyValue; -1 для прочих
+func decodePropertyInt(b []byte) int64 {
+	value := int64(-1)
+	r := &reader{b: b}
+	for {
+		num, wire, ok := r.field()
+		if !ok {
+			break
+		}
+		if (num == 3 || num == 4) && wire == wireVarint {
+			value = int64(int32(r.varint()))
+			continue
+		}
+		r.skip(wire)
+	}
+	return value
+}
+
+// writer кодирует сообщение protobuf
+type writer struct {
+	b []byte
+}
+
+func (w *writer) key(num, wire int) { w.b = binary.AppendUvarint(w.b, uint64(num<<3|wire)) }
+
+func (w *writer) varint(num int, v uint64) {
+	w.key(num, wireVarint)
+	w.b = binary.AppendUvarint(w.b, v)
+}
+
+func (w *writer) bytes(num int, v []byte) {
+	w.key(num, wireBytes)
+	w.b = binary.AppendUvarint(w.b, uint64(len(v)))
+	w.b = append(w.b, v...)
+}
+
+// encodeRebirth кодирует NCMD с запросом перерождения узла
+func encodeRebirth(now time.Time) []byte {
+	m := &writer{}
+	m.bytes(1, []byte(metricRebirth))
+	m.varint(3, uint64(now.UnixMilli()))
+	m.varint(4, typeBoolean)
+	m.varint(14, 1)
+
+	p := &writer{}
+	p.varint(1, uint64(now.UnixMilli()))
+	p.bytes(2, m.b)
+	return p.b
+}
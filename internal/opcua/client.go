@@ -0,0 +1,825 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout таймаут обмена, если у запроса нет дедлайна
+const DefaultTimeout = 5 * time.Second
+
+// DefaultPort порт OPC UA TCP по умолчанию
+const DefaultPort = 4840
+
+// Запрашиваемые время жизни канала и сессии; сервер может их сократить.
+// Канал продлевается по истечении 3/4 срока.
+const (
+	channelLifetime = time.Hour
+	sessionTimeout  = time.Hour
+)
+
+// Client клиент OPC UA TCP. Канал открывается без шифрования (SecurityPolicy
+// None), сессия активируется анонимно или по имени и паролю. Запросы из
+// нескольких горутин выполняются одновременно: ответы сопоставляются по
+// номеру запроса, поэтому ожидание Publish не задерживает чтение. При сетевой
+// ошибке или таймауте соединение закрывается, ошибки служб его не закрывают.
+type Client struct {
+	endpoint string // opc.tcp://host:port/path
+	username string // Пустое имя — анонимный вход
+	password string
+	Timeout  time.Duration // Таймаут запроса без учёта дедлайна контекста
+
+	sendMu sync.Mutex // Сериализует запись фрагментов в conn
+
+	mu         sync.Mutex // Защищает поля ниже
+	conn       net.Conn
+	done       chan struct{} // Закрывается при разрыве соединения
+	chunkSize  int           // Предел фрагмента, объявленный сервером
+	channelID  uint32
+	tokenID    uint32
+	sequence   uint32
+	requestID  uint32
+	handle     uint32
+	authToken  NodeID
+	pending    map[uint32]chan reply
+	handlers   map[uint32]func(handle uint32, value DataValue) // Обработчики подписок по их номерам
+	publishing bool
+}
+
+// reply собранный ответ на запрос или ошибка соединения
+type reply struct {
+	body []byte
+	err  error
+}
+
+// NewClient создаёт клиент сервера endpoint (opc.tcp://host:port). Пустое
+// username — анонимный вход.
+func NewClient(endpoint, username, password string) *Client {
+	return &Client{endpoint: endpoint, username: username, password: password, Timeout: DefaultTimeout}
+}
+
+// String возвращает адрес сервера для сообщений в лог
+func (c *Client) String() string {
+	if c.username == "" {
+		return c.endpoint
+	}
+	return fmt.Sprintf("%s, пользователь %s", c.endpoint, c.username)
+}
+
+// Connect открывает канал и активирует сессию
+func (c *Client) Connect() error {
+	c.Close()
+
+	endpointURL, err := url.Parse(c.endpoint)
+	if err != nil || endpointURL.Scheme != "opc.tcp" || endpointURL.Hostname() == "" {
+		return fmt.Errorf("некорректный адрес сервера %q: ожидается opc.tcp://host:port", c.endpoint)
+	}
+	host := endpointURL.Host
+	if endpointURL.Port() == "" {
+		host = net.JoinHostPort(endpointURL.Hostname(), fmt.Sprint(DefaultPort))
+	}
+
+	conn, err := net.DialTimeout("tcp", host, c.Timeout)
+	if err != nil {
+		return err
+	}
+	chunkSize, err := c.hello(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.done = make(chan struct{})
+	c.chunkSize = chunkSize
+	c.channelID, c.tokenID, c.authToken = 0, 0, NodeID{}
+	c.pending = make(map[uint32]chan reply)
+	c.handlers = make(map[uint32]func(uint32, DataValue))
+	c.publishing = false
+	done := c.done
+	c.mu.Unlock()
+	go c.receive(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*c.Timeout)
+	defer cancel()
+	lifetime, err := c.openChannel(ctx, false)
+	if err == nil {
+		err = c.createSession(ctx)
+	}
+	if err != nil {
+		c.fail(conn, err)
+		return err
+	}
+	go c.renewChannel(done, lifetime)
+	return nil
+}
+
+// hello обменивается сообщениями Hello/Acknowledge и возвращает предел
+// размера фрагмента, который принимает сервер
+func (c *Client) hello(conn net.Conn) (int, error) {
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	request := hello{receiveBuffer: bufferSize, sendBuffer: bufferSize, maxMessage: maxMessageSize, endpoint: c.endpoint}
+	if err := writeMessage(conn, "HEL", chunkFinal, request.encode(true)); err != nil {
+		return 0, err
+	}
+	msg, err := readMessage(conn)
+	if err != nil {
+		return 0, err
+	}
+	switch msg.kind {
+	case "ACK":
+		ack, err := decodeHello(msg.body, false)
+		if err != nil {
+			return 0, fmt.Errorf("некорректное сообщение ACK: %w", err)
+		}
+		if ack.receiveBuffer < 8192 {
+			return 0, fmt.Errorf("сервер принимает слишком короткие фрагменты: %d байт", ack.receiveBuffer)
+		}
+		return int(min(ack.receiveBuffer, bufferSize)), nil
+	case "ERR":
+		return 0, decodeTransportError(msg.body)
+	default:
+		return 0, fmt.Errorf("неожиданное сообщение %s в ответ на Hello", msg.kind)
+	}
+}
+
+// openChannel открывает (renew=false) или продлевает защищённый канал и
+// возвращает время жизни токена
+func (c *Client) openChannel(ctx context.Context, renew bool) (time.Duration, error) {
+	d, err := c.call(ctx, idOpenSecureChannelRequest, func(e *encoder) {
+		e.uint32(protocolVersion)
+		e.uint32(uint32(boolByte(renew))) // RequestType: 0 — Issue, 1 — Renew
+		e.uint32(1)                       // MessageSecurityMode None
+		e.bytes(nil)                      // ClientNonce
+		e.uint32(uint32(channelLifetime / time.Millisecond))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка открытия канала: %w", err)
+	}
+	d.uint32() // ServerProtocolVersion
+	channelID, tokenID := d.uint32(), d.uint32()
+	d.time()
+	lifetime := time.Duration(d.uint32()) * time.Millisecond
+	d.bytes()
+	if d.err != nil {
+		return 0, fmt.Errorf("ошибка открытия канала: %w", d.err)
+	}
+
+	c.mu.Lock()
+	c.channelID, c.tokenID = channelID, tokenID
+	c.mu.Unlock()
+	return lifetime, nil
+}
+
+// renewChannel продлевает канал до разрыва соединения
+func (c *Client) renewChannel(done chan struct{}, lifetime time.Duration) {
+	for {
+		if lifetime <= 0 {
+			lifetime = channelLifetime
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(lifetime * 3 / 4):
+		}
+		var err error
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		lifetime, err = c.openChannel(ctx, true)
+		cancel()
+		if err != nil {
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			c.fail(conn, err)
+			return
+		}
+	}
+}
+
+// createSession создаёт и активирует сессию
+func (c *Client) createSession(ctx context.Context) error {
+	d, err := c.call(ctx, idCreateSessionRequest, func(e *encoder) {
+		e.applicationDescription("urn:plc_tsdb:collector", "plc_tsdb", 1, "")
+		e.string("") // ServerUri
+		e.string(c.endpoint)
+		e.string("plc_tsdb")
+		e.bytes(make([]byte, 32)) // ClientNonce: без шифрования не проверяется, но должен быть не короче 32 байт
+		e.bytes(nil)              // ClientCertificate
+		e.double(float64(sessionTimeout / time.Millisecond))
+		e.uint32(0) // MaxResponseMessageSize: без ограничения
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка создания сессии: %w", err)
+	}
+	d.nodeID() // SessionId
+	authToken := d.nodeID()
+	d.double()
+	d.bytes()
+	d.bytes()
+	policyID, policyURI, found := "", "", false
+	wantType := uint32(tokenAnonymous)
+	if c.username != "" {
+		wantType = tokenUserName
+	}
+	for i, n := 0, d.count(); i < n; i++ {
+		d.string() // EndpointUrl
+		d.applicationDescription()
+		d.bytes()
+		securityMode := d.uint32()
+		securityPolicy := d.string()
+		for j, m := 0, d.count(); j < m; j++ {
+			id, tokenType := d.string(), d.uint32()
+			d.string()
+			d.string()
+			uri := d.string()
+			if !found && securityMode == 1 && securityPolicy == securityPolicyNone && tokenType == wantType {
+				policyID, policyURI, found = id, uri, true
+			}
+		}
+		d.string()
+		d.byte()
+	}
+	if d.err != nil {
+		return fmt.Errorf("ошибка создания сессии: %w", d.err)
+	}
+	if !found {
+		if c.username != "" {
+			return fmt.Errorf("сервер не принимает вход по имени пользователя без шифрования")
+		}
+		return fmt.Errorf("сервер не принимает анонимный вход без шифрования")
+	}
+	if c.username != "" && policyURI != "" && policyURI != securityPolicyNone {
+		return fmt.Errorf("сервер требует шифрования пароля (%s), поддерживается только передача без шифрования", policyURI)
+	}
+
+	c.mu.Lock()
+	c.authToken = authToken
+	c.mu.Unlock()
+
+	d, err = c.call(ctx, idActivateSessionRequest, func(e *encoder) {
+		e.signatureData()
+		e.int32(-1)    // ClientSoftwareCertificates
+		e.strings(nil) // LocaleIds
+		token := &encoder{}
+		token.string(policyID)
+		if c.username == "" {
+			e.extensionObject(idAnonymousIdentityToken, token.b)
+		} else {
+			token.string(c.username)
+			token.bytes([]byte(c.password))
+			token.string("") // EncryptionAlgorithm: пароль не шифруется
+			e.extensionObject(idUserNameIdentityToken, token.b)
+		}
+		e.signatureData()
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка активации сессии: %w", err)
+	}
+	return d.err
+}
+
+// Close закрывает сессию и соединение
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	active := !c.authToken.IsNull()
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	if active {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		c.call(ctx, idCloseSessionRequest, func(e *encoder) { e.bool(true) })
+		cancel()
+		e := &encoder{}
+		e.nodeID(NumericNodeID(0, idCloseSecureChannelRequest))
+		e.requestHeader(NodeID{}, 0, 0)
+		c.send(conn, "CLO", e.b)
+	}
+	c.fail(conn, net.ErrClosed)
+	return nil
+}
+
+// Connected сообщает, открыто ли соединение
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// fail закрывает соединение conn (если оно ещё текущее) и завершает
+// ожидающие запросы с ошибкой err
+func (c *Client) fail(conn net.Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn == nil || c.conn != conn {
+		return
+	}
+	conn.Close()
+	c.conn = nil
+	c.authToken = NodeID{}
+	close(c.done)
+	for id, ch := range c.pending {
+		ch <- reply{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// receive читает фрагменты ответов, собирает сообщения и передаёт их
+// ожидающим запросам
+func (c *Client) receive(conn net.Conn) {
+	partial := make(map[uint32][]byte)
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			c.fail(conn, fmt.Errorf("ошибка обмена с %s: %w", c.endpoint, err))
+			return
+		}
+
+		d := &decoder{b: msg.body}
+		switch msg.kind {
+		case "ERR":
+			c.fail(conn, decodeTransportError(msg.body))
+			return
+		case "OPN":
+			d.uint32() // SecureChannelId
+			d.string() // SecurityPolicyUri
+			d.bytes()
+			d.bytes()
+		case "MSG":
+			d.uint32()
+			d.uint32() // TokenId
+		default:
+			c.fail(conn, fmt.Errorf("неожиданное сообщение %s", msg.kind))
+			return
+		}
+		d.uint32() // SequenceNumber
+		requestID := d.uint32()
+		if d.err != nil {
+			c.fail(conn, fmt.Errorf("некорректный заголовок сообщения: %w", d.err))
+			return
+		}
+
+		body := append(partial[requestID], d.b...)
+		switch msg.chunk {
+		case chunkIntermediate:
+			if len(body) > maxMessageSize {
+				c.fail(conn, fmt.Errorf("слишком длинный ответ на запрос %d", requestID))
+				return
+			}
+			partial[requestID] = body
+			continue
+		case chunkAbort:
+			delete(partial, requestID)
+			ad := &decoder{b: d.b}
+			c.deliver(requestID, reply{err: fmt.Errorf("сервер прервал ответ: %s", ad.status())})
+			continue
+		}
+		delete(partial, requestID)
+		c.deliver(requestID, reply{body: body})
+	}
+}
+
+func (c *Client) deliver(requestID uint32, r reply) {
+	c.mu.Lock()
+	ch, ok := c.pending[requestID]
+	delete(c.pending, requestID)
+	c.mu.Unlock()
+	if ok {
+		ch <- r
+	}
+}
+
+// call выполняет запрос службы requestType: body кодирует поля после
+// RequestHeader. Возвращает разбор ответа после ResponseHeader; ServiceFault
+// и плохой ServiceResult возвращаются ошибкой StatusCode.
+func (c *Client) call(ctx context.Context, requestType uint32, body func(e *encoder)) (*decoder, error) {
+	timeout := c.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	authToken := c.authToken
+	if requestType == idOpenSecureChannelRequest {
+		authToken = NodeID{}
+	}
+	c.handle++
+	handle := c.handle
+	c.mu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("нет соединения с %s", c.endpoint)
+	}
+
+	e := &encoder{}
+	e.nodeID(NumericNodeID(0, requestType))
+	e.requestHeader(authToken, handle, uint32(timeout/time.Millisecond))
+	body(e)
+
+	kind := "MSG"
+	if requestType == idOpenSecureChannelRequest {
+		kind = "OPN"
+	}
+	requestID, ch, err := c.send(conn, kind, e.b)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var r reply
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, requestID)
+		c.mu.Unlock()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.fail(conn, fmt.Errorf("нет ответа от %s", c.endpoint))
+		}
+		return nil, ctx.Err()
+	case <-timer.C:
+		err := fmt.Errorf("нет ответа от %s", c.endpoint)
+		c.fail(conn, err)
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	d := &decoder{b: r.body}
+	responseType, _ := d.nodeID().Numeric()
+	if responseType == idServiceFault {
+		status := d.responseHeader()
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, status
+	}
+	if responseType != requestType+3 {
+		return nil, fmt.Errorf("ответ типа %d на запрос типа %d", responseType, requestType)
+	}
+	if status := d.responseHeader(); status.IsBad() {
+		return nil, status
+	}
+	return d, d.err
+}
+
+// send отправляет сообщение, разбивая его на фрагменты по пределу сервера.
+// Для OPN и MSG регистрирует ожидание ответа.
+func (c *Client) send(conn net.Conn, kind string, payload []byte) (uint32, chan reply, error) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.mu.Lock()
+	if c.conn != conn {
+		c.mu.Unlock()
+		return 0, nil, fmt.Errorf("нет соединения с %s", c.endpoint)
+	}
+	c.requestID++
+	requestID := c.requestID
+	var ch chan reply
+	if kind != "CLO" {
+		ch = make(chan reply, 1)
+		c.pending[requestID] = ch
+	}
+	channelID, tokenID, chunkSize := c.channelID, c.tokenID, c.chunkSize
+	c.mu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	for first := true; first || len(payload) > 0; first = false {
+		header := &encoder{}
+		header.uint32(channelID)
+		if kind == "OPN" {
+			header.string(securityPolicyNone)
+			header.bytes(nil) // SenderCertificate
+			header.bytes(nil) // ReceiverCertificateThumbprint
+		} else {
+			header.uint32(tokenID)
+		}
+		c.mu.Lock()
+		c.sequence++
+		sequence := c.sequence
+		c.mu.Unlock()
+		header.uint32(sequence)
+		header.uint32(requestID)
+
+		room := chunkSize - headerSize - len(header.b)
+		piece := payload
+		chunk := byte(chunkFinal)
+		if len(piece) > room {
+			if kind != "MSG" {
+				return 0, nil, fmt.Errorf("сообщение %s не помещается в один фрагмент", kind)
+			}
+			piece, chunk = payload[:room], chunkIntermediate
+		}
+		payload = payload[len(piece):]
+
+		if err := writeMessage(conn, kind, chunk, append(header.b, piece...)); err != nil {
+			c.fail(conn, fmt.Errorf("ошибка обмена с %s: %w", c.endpoint, err))
+			return 0, nil, err
+		}
+	}
+	return requestID, ch, nil
+}
+
+// Read читает атрибут Value узлов. Коды состояния отдельных узлов
+// возвращаются в DataValue.Status, ошибка — только при сбое запроса.
+func (c *Client) Read(ctx context.Context, nodes []NodeID) ([]DataValue, error) {
+	return c.readAttribute(ctx, nodes, attributeValue)
+}
+
+func (c *Client) readAttribute(ctx context.Context, nodes []NodeID, attribute uint32) ([]DataValue, error) {
+	d, err := c.call(ctx, idReadRequest, func(e *encoder) {
+		e.double(0) // MaxAge: свежее значение
+		e.uint32(2) // TimestampsToReturn: Both
+		e.int32(int32(len(nodes)))
+		for _, node := range nodes {
+			e.readValueID(node, attribute)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	values := make([]DataValue, d.count())
+	for i := range values {
+		values[i] = d.dataValue()
+	}
+	if d.err == nil && len(values) != len(nodes) {
+		return nil, fmt.Errorf("сервер вернул %d значений на %d узлов", len(values), len(nodes))
+	}
+	return values, d.err
+}
+
+func (e *encoder) readValueID(node NodeID, attribute uint32) {
+	e.nodeID(node)
+	e.uint32(attribute)
+	e.string("")           // IndexRange
+	e.qualifiedName(0, "") // DataEncoding
+}
+
+// Write записывает атрибут Value узлов. Возвращает коды результата по узлам.
+func (c *Client) Write(ctx context.Context, nodes []NodeID, values []interface{}) ([]StatusCode, error) {
+	var encodeErr error
+	d, err := c.call(ctx, idWriteRequest, func(e *encoder) {
+		e.int32(int32(len(nodes)))
+		for i, node := range nodes {
+			e.nodeID(node)
+			e.uint32(attributeValue)
+			e.string("")
+			// Метки времени не передаются: многие серверы отклоняют запись с ними
+			if err := e.dataValue(DataValue{Value: values[i]}); err != nil && encodeErr == nil {
+				encodeErr = fmt.Errorf("узел %s: %w", node, err)
+			}
+		}
+	})
+	if encodeErr != nil {
+		return nil, encodeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	results := make([]StatusCode, d.count())
+	for i := range results {
+		results[i] = d.status()
+	}
+	return results, d.err
+}
+
+// Reference ссылка, найденная при просмотре адресного пространства
+type Reference struct {
+	NodeID      NodeID
+	BrowseName  string
+	DisplayName string
+	NodeClass   uint32
+}
+
+// IsVariable сообщает, что узел — переменная (имеет значение)
+func (r Reference) IsVariable() bool { return r.NodeClass == nodeClassVariable }
+
+// IsObject сообщает, что узел — объект (папка, устройство)
+func (r Reference) IsObject() bool { return r.NodeClass == nodeClassObject }
+
+// Browse возвращает иерархические ссылки вперёд от узла node
+func (c *Client) Browse(ctx context.Context, node NodeID) ([]Reference, error) {
+	d, err := c.call(ctx, idBrowseRequest, func(e *encoder) {
+		e.nodeID(NodeID{}) // View: всё адресное пространство
+		e.time(time.Time{})
+		e.uint32(0)
+		e.uint32(0) // RequestedMaxReferencesPerNode: без ограничения
+		e.int32(1)
+		e.nodeID(node)
+		e.uint32(0) // BrowseDirection: Forward
+		e.nodeID(hierarchicalReferences)
+		e.bool(true)   // IncludeSubtypes
+		e.uint32(0)    // NodeClassMask: все классы
+		e.uint32(0x3F) // ResultMask: все поля
+	})
+	if err != nil {
+		return nil, err
+	}
+	var refs []Reference
+	for {
+		if d.count() != 1 {
+			return nil, fmt.Errorf("некорректный ответ Browse")
+		}
+		status := d.status()
+		continuation := d.bytes()
+		for i, n := 0, d.count(); i < n; i++ {
+			d.nodeID() // ReferenceTypeId
+			d.bool()
+			ref := Reference{NodeID: d.nodeID(), BrowseName: d.qualifiedName(), DisplayName: d.localizedText(), NodeClass: d.uint32()}
+			d.nodeID() // TypeDefinition
+			refs = append(refs, ref)
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+		if status.IsBad() {
+			return nil, status
+		}
+		if continuation == nil {
+			return refs, nil
+		}
+
+		d, err = c.call(ctx, idBrowseNextRequest, func(e *encoder) {
+			e.bool(false)
+			e.int32(1)
+			e.bytes(continuation)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DataTypes читает атрибут DataType переменных. Возвращает идентификаторы
+// типов в стандартной записи (i=11 — Double); для узлов с ошибкой — пусто.
+func (c *Client) DataTypes(ctx context.Context, nodes []NodeID) ([]string, error) {
+	values, err := c.readAttribute(ctx, nodes, attributeDataType)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(values))
+	for i, value := range values {
+		if s, ok := value.Value.(string); ok && value.Status.IsGood() {
+			types[i] = s
+		}
+	}
+	return types, nil
+}
+
+// Subscribe создаёт подписку с интервалом публикации interval и
+// отслеживаемые элементы узлов nodes. notify вызывается из горутины
+// публикации на каждое изменение: handle — индекс узла в nodes. Возвращает
+// коды результата создания элементов по узлам.
+func (c *Client) Subscribe(ctx context.Context, interval time.Duration, nodes []NodeID, notify func(handle uint32, value DataValue)) ([]StatusCode, error) {
+	const keepAliveCount = 10
+	d, err := c.call(ctx, idCreateSubscriptionRequest, func(e *encoder) {
+		e.double(float64(interval) / float64(time.Millisecond))
+		e.uint32(3 * keepAliveCount) // RequestedLifetimeCount
+		e.uint32(keepAliveCount)
+		e.uint32(0) // MaxNotificationsPerPublish: без ограничения
+		e.bool(true)
+		e.byte(0)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания подписки: %w", err)
+	}
+	subscriptionID := d.uint32()
+	revised := time.Duration(d.double() * float64(time.Millisecond))
+	d.uint32()
+	revisedKeepAlive := d.uint32()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	c.mu.Lock()
+	if c.handlers == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("нет соединения с %s", c.endpoint)
+	}
+	c.handlers[subscriptionID] = notify
+	start := !c.publishing
+	c.publishing = true
+	done := c.done
+	c.mu.Unlock()
+	if start {
+		// Ответ на Publish приходит не позже keep-alive: интервал × число
+		go c.publish(done, max(revised, interval)*time.Duration(max(revisedKeepAlive, 1)))
+	}
+
+	d, err = c.call(ctx, idCreateMonitoredItemsRequest, func(e *encoder) {
+		e.uint32(subscriptionID)
+		e.uint32(2) // TimestampsToReturn: Both
+		e.int32(int32(len(nodes)))
+		for i, node := range nodes {
+			e.readValueID(node, attributeValue)
+			e.uint32(2) // MonitoringMode: Reporting
+			e.uint32(uint32(i))
+			e.double(-1) // SamplingInterval: как у подписки
+			e.extensionObject(0, nil)
+			e.uint32(1) // QueueSize: только последнее значение
+			e.bool(true)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания элементов подписки: %w", err)
+	}
+	results := make([]StatusCode, d.count())
+	for i := range results {
+		results[i] = d.status()
+		d.uint32()
+		d.double()
+		d.uint32()
+		d.extensionObject()
+	}
+	return results, d.err
+}
+
+// publish запрашивает уведомления подписок до разрыва соединения.
+// keepAlive — наибольший ожидаемый интервал между ответами сервера.
+func (c *Client) publish(done chan struct{}, keepAlive time.Duration) {
+	type ack struct{ subscription, sequence uint32 }
+	var acks []ack
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), keepAlive+c.Timeout)
+		d, err := c.call(ctx, idPublishRequest, func(e *encoder) {
+			e.int32(int32(len(acks)))
+			for _, a := range acks {
+				e.uint32(a.subscription)
+				e.uint32(a.sequence)
+			}
+		})
+		cancel()
+		acks = acks[:0]
+
+		var status StatusCode
+		switch {
+		case errors.As(err, &status) && status.Code() == StatusBadTooManyPublishRequests:
+			time.Sleep(keepAlive / 10)
+			continue
+		case errors.As(err, &status) && status.Code() == StatusBadNoSubscription:
+			return
+		case err != nil:
+			// Без уведомлений подписка бесполезна: соединение переоткрывается
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			c.fail(conn, fmt.Errorf("ошибка получения уведомлений: %w", err))
+			return
+		}
+
+		subscriptionID := d.uint32()
+		for i, n := 0, d.count(); i < n; i++ {
+			d.uint32() // AvailableSequenceNumbers
+		}
+		d.bool() // MoreNotifications
+		sequence := d.uint32()
+		d.time()
+		c.mu.Lock()
+		notify := c.handlers[subscriptionID]
+		c.mu.Unlock()
+
+		notifications := d.count()
+		for i := 0; i < notifications; i++ {
+			typeID, body := d.extensionObject()
+			if id, _ := typeID.Numeric(); id != idDataChangeNotification || notify == nil {
+				continue
+			}
+			nd := &decoder{b: body}
+			for j, m := 0, nd.count(); j < m; j++ {
+				handle := nd.uint32()
+				value := nd.dataValue()
+				if nd.err == nil {
+					notify(handle, value)
+				}
+			}
+		}
+		if d.err != nil {
+			continue
+		}
+		if notifications > 0 { // Keep-alive не подтверждается
+			acks = append(acks, ack{subscriptionID, sequence})
+		}
+	}
+}
@@ -0,0 +1,727 @@
+package opcua
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encoder буфер для кодирования в OPC UA Binary (little-endian)
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) byte(v byte)      { e.b = append(e.b, v) }
+func (e *encoder) bool(v bool)      { e.byte(boolByte(v)) }
+func (e *encoder) uint16(v uint16)  { e.b = binary.LittleEndian.AppendUint16(e.b, v) }
+func (e *encoder) uint32(v uint32)  { e.b = binary.LittleEndian.AppendUint32(e.b, v) }
+func (e *encoder) int32(v int32)    { e.uint32(uint32(v)) }
+func (e *encoder) uint64(v uint64)  { e.b = binary.LittleEndian.AppendUint64(e.b, v) }
+func (e *encoder) double(v float64) { e.uint64(math.Float64bits(v)) }
+func (e *encoder) time(t time.Time) { e.uint64(uint64(toDateTime(t))) }
+
+func (e *encoder) string(s string) {
+	if s == "" {
+		e.int32(-1) // Пустые строки передаются как null
+		return
+	}
+	e.int32(int32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// strings кодирует массив строк
+func (e *encoder) strings(list []string) {
+	if list == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(list)))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) nodeID(id NodeID) {
+	switch {
+	case id.kind == kindNumeric && id.Namespace == 0 && id.numeric <= 0xFF:
+		e.byte(0x00)
+		e.byte(byte(id.numeric))
+	case id.kind == kindNumeric && id.Namespace <= 0xFF && id.numeric <= 0xFFFF:
+		e.byte(0x01)
+		e.byte(byte(id.Namespace))
+		e.uint16(uint16(id.numeric))
+	case id.kind == kindNumeric:
+		e.byte(0x02)
+		e.uint16(id.Namespace)
+		e.uint32(id.numeric)
+	case id.kind == kindString:
+		e.byte(0x03)
+		e.uint16(id.Namespace)
+		e.string(id.text)
+	case id.kind == kindGUID:
+		e.byte(0x04)
+		e.uint16(id.Namespace)
+		e.b = append(e.b, id.text...)
+	default:
+		e.byte(0x05)
+		e.uint16(id.Namespace)
+		e.bytes([]byte(id.text))
+	}
+}
+
+// extensionObject кодирует объект с телом в двоичном виде; typeID — NodeId кодировки типа
+func (e *encoder) extensionObject(typeID uint32, body []byte) {
+	if body == nil {
+		e.nodeID(NodeID{})
+		e.byte(0x00)
+		return
+	}
+	e.nodeID(NumericNodeID(0, typeID))
+	e.byte(0x01)
+	e.bytes(body)
+}
+
+func (e *encoder) qualifiedName(ns uint16, name string) {
+	e.uint16(ns)
+	e.string(name)
+}
+
+func (e *encoder) localizedText(text string) {
+	if text == "" {
+		e.byte(0x00)
+		return
+	}
+	e.byte(0x02)
+	e.string(text)
+}
+
+func (e *encoder) variant(v interface{}) error {
+	if list, ok := asList(v); ok {
+		if len(list) == 0 {
+			e.byte(0x80 | variantBoolean)
+			e.int32(0)
+			return nil
+		}
+		typeID, ok := variantType(list[0])
+		if !ok {
+			return fmt.Errorf("неподдерживаемый тип значения %T", list[0])
+		}
+		e.byte(0x80 | typeID)
+		e.int32(int32(len(list)))
+		for _, item := range list {
+			if itemType, _ := variantType(item); itemType != typeID {
+				return fmt.Errorf("элементы массива разных типов")
+			}
+			e.scalar(item)
+		}
+		return nil
+	}
+
+	if v == nil {
+		e.byte(0x00)
+		return nil
+	}
+	typeID, ok := variantType(v)
+	if !ok {
+		return fmt.Errorf("неподдерживаемый тип значения %T", v)
+	}
+	e.byte(typeID)
+	e.scalar(v)
+	return nil
+}
+
+func (e *encoder) scalar(v interface{}) {
+	switch v := v.(type) {
+	case bool:
+		e.bool(v)
+	case int8:
+		e.byte(byte(v))
+	case uint8:
+		e.byte(v)
+	case int16:
+		e.uint16(uint16(v))
+	case uint16:
+		e.uint16(v)
+	case int32:
+		e.int32(v)
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.uint64(uint64(v))
+	case uint64:
+		e.uint64(v)
+	case float32:
+		e.uint32(math.Float32bits(v))
+	case float64:
+		e.double(v)
+	case string:
+		e.string(v)
+	case time.Time:
+		e.time(v)
+	case []byte:
+		e.bytes(v)
+	case StatusCode:
+		e.uint32(uint32(v))
+	case NodeID:
+		e.nodeID(v)
+	}
+}
+
+// asList возвращает элементы массива: []interface{} или срез встроенного
+// типа ([]float32, []int32, ...). []byte — скаляр ByteString, не массив.
+func asList(v interface{}) ([]interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, true
+	case []byte, nil:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// dataValue кодирует DataValue с заданными полями
+func (e *encoder) dataValue(dv DataValue) error {
+	mask := byte(0)
+	if dv.Value != nil {
+		mask |= 0x01
+	}
+	if dv.Status != StatusGood {
+		mask |= 0x02
+	}
+	if !dv.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !dv.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+	e.byte(mask)
+	if mask&0x01 != 0 {
+		if err := e.variant(dv.Value); err != nil {
+			return err
+		}
+	}
+	if mask&0x02 != 0 {
+		e.uint32(uint32(dv.Status))
+	}
+	if mask&0x04 != 0 {
+		e.time(dv.SourceTimestamp)
+	}
+	if mask&0x08 != 0 {
+		e.time(dv.ServerTimestamp)
+	}
+	return nil
+}
+
+// Коды типов Variant (встроенные типы OPC UA)
+const (
+	variantBoolean         = 1
+	variantSByte           = 2
+	variantByte            = 3
+	variantInt16           = 4
+	variantUInt16          = 5
+	variantInt32           = 6
+	variantUInt32          = 7
+	variantInt64           = 8
+	variantUInt64          = 9
+	variantFloat           = 10
+	variantDouble          = 11
+	variantString          = 12
+	variantDateTime        = 13
+	variantGUID            = 14
+	variantByteString      = 15
+	variantXMLElement      = 16
+	variantNodeID          = 17
+	variantExpandedNodeID  = 18
+	variantStatusCode      = 19
+	variantQualifiedName   = 20
+	variantLocalizedText   = 21
+	variantExtensionObject = 22
+	variantDataValue       = 23
+	variantVariant         = 24
+	variantDiagnosticInfo  = 25
+)
+
+// variantType возвращает код типа Variant для значения Go
+func variantType(v interface{}) (byte, bool) {
+	switch v.(type) {
+	case bool:
+		return variantBoolean, true
+	case int8:
+		return variantSByte, true
+	case uint8:
+		return variantByte, true
+	case int16:
+		return variantInt16, true
+	case uint16:
+		return variantUInt16, true
+	case int32:
+		return variantInt32, true
+	case uint32:
+		return variantUInt32, true
+	case int64:
+		return variantInt64, true
+	case uint64:
+		return variantUInt64, true
+	case float32:
+		return variantFloat, true
+	case float64:
+		return variantDouble, true
+	case string:
+		return variantString, true
+	case time.Time:
+		return variantDateTime, true
+	case []byte:
+		return variantByteString, true
+	case StatusCode:
+		return variantStatusCode, true
+	case NodeID:
+		return variantNodeID, true
+	default:
+		return 0, false
+	}
+}
+
+// decoder разбор OPC UA Binary. Первая ошибка запоминается, после неё
+// все методы возвращают нулевые значения.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = fmt.Errorf("короткое сообщение: нужно %d байт, осталось %d", n, len(d.b))
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) bool() bool { return d.byte() != 0 }
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 { return int32(d.uint32()) }
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) double() float64    { return math.Float64frombits(d.uint64()) }
+func (d *decoder) time() time.Time    { return fromDateTime(int64(d.uint64())) }
+func (d *decoder) status() StatusCode { return StatusCode(d.uint32()) }
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n <= 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// count читает длину массива; null (-1) — пустой массив
+func (d *decoder) count() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) && d.err == nil {
+		d.err = fmt.Errorf("некорректная длина массива: %d", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) strings() []string {
+	list := make([]string, d.count())
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) nodeID() NodeID {
+	encoding := d.byte()
+	id := d.nodeIDBody(encoding & 0x3F)
+	// Флаги ExpandedNodeId: URI пространства имён и индекс сервера
+	if encoding&0x80 != 0 {
+		d.string()
+	}
+	if encoding&0x40 != 0 {
+		d.uint32()
+	}
+	return id
+}
+
+func (d *decoder) nodeIDBody(encoding byte) NodeID {
+	switch encoding {
+	case 0x00:
+		return NumericNodeID(0, uint32(d.byte()))
+	case 0x01:
+		ns := d.byte()
+		return NumericNodeID(uint16(ns), uint32(d.uint16()))
+	case 0x02:
+		ns := d.uint16()
+		return NumericNodeID(ns, d.uint32())
+	case 0x03:
+		ns := d.uint16()
+		return StringNodeID(ns, d.string())
+	case 0x04:
+		ns := d.uint16()
+		return NodeID{Namespace: ns, kind: kindGUID, text: string(d.take(16))}
+	case 0x05:
+		ns := d.uint16()
+		return NodeID{Namespace: ns, kind: kindOpaque, text: string(d.bytes())}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("неизвестная кодировка NodeId 0x%02X", encoding)
+		}
+		return NodeID{}
+	}
+}
+
+// extensionObject возвращает идентификатор кодировки и тело объекта
+func (d *decoder) extensionObject() (NodeID, []byte) {
+	typeID := d.nodeID()
+	switch d.byte() {
+	case 0x00:
+		return typeID, nil
+	default:
+		return typeID, d.bytes()
+	}
+}
+
+func (d *decoder) qualifiedName() string {
+	d.uint16()
+	return d.string()
+}
+
+func (d *decoder) localizedText() string {
+	mask := d.byte()
+	if mask&0x01 != 0 {
+		d.string()
+	}
+	if mask&0x02 != 0 {
+		return d.string()
+	}
+	return ""
+}
+
+// diagnosticInfo пропускает DiagnosticInfo
+func (d *decoder) diagnosticInfo() {
+	mask := d.byte()
+	for bit := byte(0x01); bit <= 0x08; bit <<= 1 {
+		if mask&bit != 0 {
+			d.int32()
+		}
+	}
+	if mask&0x10 != 0 {
+		d.string()
+	}
+	if mask&0x20 != 0 {
+		d.uint32()
+	}
+	if mask&0x40 != 0 {
+		d.diagnosticInfo()
+	}
+}
+
+func (d *decoder) diagnosticInfos() {
+	for i, n := 0, d.count(); i < n; i++ {
+		d.diagnosticInfo()
+	}
+}
+
+func (d *decoder) variant() interface{} {
+	mask := d.byte()
+	typeID := mask & 0x3F
+	if mask&0x80 == 0 {
+		return d.scalar(typeID)
+	}
+
+	list := make([]interface{}, d.count())
+	for i := range list {
+		list[i] = d.scalar(typeID)
+	}
+	if mask&0x40 != 0 {
+		for i, n := 0, d.count(); i < n; i++ { // Размерности многомерного массива
+			d.int32()
+		}
+	}
+	return list
+}
+
+// scalar разбирает значение встроенного типа. Нечисловые составные типы
+// разбираются, чтобы не сбить позицию, и возвращаются как строка или nil.
+func (d *decoder) scalar(typeID byte) interface{} {
+	switch typeID {
+	case 0:
+		return nil
+	case variantBoolean:
+		return d.bool()
+	case variantSByte:
+		return int8(d.byte())
+	case variantByte:
+		return d.byte()
+	case variantInt16:
+		return int16(d.uint16())
+	case variantUInt16:
+		return d.uint16()
+	case variantInt32:
+		return d.int32()
+	case variantUInt32:
+		return d.uint32()
+	case variantInt64:
+		return int64(d.uint64())
+	case variantUInt64:
+		return d.uint64()
+	case variantFloat:
+		return math.Float32frombits(d.uint32())
+	case variantDouble:
+		return d.double()
+	case variantString, variantXMLElement:
+		return d.string()
+	case variantDateTime:
+		return d.time()
+	case variantGUID:
+		return hex.EncodeToString(d.take(16))
+	case variantByteString:
+		return d.bytes()
+	case variantNodeID, variantExpandedNodeID:
+		return d.nodeID().String()
+	case variantStatusCode:
+		return d.status()
+	case variantQualifiedName:
+		return d.qualifiedName()
+	case variantLocalizedText:
+		return d.localizedText()
+	case variantExtensionObject:
+		d.extensionObject()
+		return nil
+	case variantDataValue:
+		return d.dataValue().Value
+	case variantVariant:
+		return d.variant()
+	case variantDiagnosticInfo:
+		d.diagnosticInfo()
+		return nil
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("неизвестный тип Variant %d", typeID)
+		}
+		return nil
+	}
+}
+
+// DataValue значение узла с кодом состояния и метками времени
+type DataValue struct {
+	Value           interface{}
+	Status          StatusCode
+	SourceTimestamp time.Time // Время изменения значения в источнике; нулевое — не передано
+	ServerTimestamp time.Time // Время получения значения сервером; нулевое — не передано
+}
+
+func (d *decoder) dataValue() DataValue {
+	var dv DataValue
+	mask := d.byte()
+	if mask&0x01 != 0 {
+		dv.Value = d.variant()
+	}
+	if mask&0x02 != 0 {
+		dv.Status = d.status()
+	}
+	if mask&0x04 != 0 {
+		dv.SourceTimestamp = d.time()
+	}
+	if mask&0x10 != 0 {
+		d.uint16() // Пикосекунды
+	}
+	if mask&0x08 != 0 {
+		dv.ServerTimestamp = d.time()
+	}
+	if mask&0x20 != 0 {
+		d.uint16()
+	}
+	return dv
+}
+
+// Эпоха DateTime OPC UA — 1601-01-01, единица — 100 нс
+const dateTimeEpochOffset = 116444736000000000
+
+func toDateTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()/100 + dateTimeEpochOffset
+}
+
+func fromDateTime(v int64) time.Time {
+	if v <= 0 || v == math.MaxInt64 {
+		return time.Time{}
+	}
+	return time.Unix(0, (v-dateTimeEpochOffset)*100).UTC()
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// Виды идентификаторов NodeId
+const (
+	kindNumeric = iota
+	kindString
+	kindGUID
+	kindOpaque
+)
+
+// NodeID идентификатор узла адресного пространства
+type NodeID struct {
+	Namespace uint16
+	kind      int
+	numeric   uint32
+	text      string // Строковый идентификатор, 16 байт GUID или непрозрачные байты
+}
+
+// NumericNodeID создаёт числовой идентификатор узла (ns=2;i=1001)
+func NumericNodeID(ns uint16, id uint32) NodeID {
+	return NodeID{Namespace: ns, kind: kindNumeric, numeric: id}
+}
+
+// StringNodeID создаёт строковый идентификатор узла (ns=2;s=Line1.Speed)
+func StringNodeID(ns uint16, id string) NodeID {
+	return NodeID{Namespace: ns, kind: kindString, text: id}
+}
+
+// IsNull сообщает, что идентификатор пустой (ns=0;i=0)
+func (id NodeID) IsNull() bool {
+	return id.kind == kindNumeric && id.Namespace == 0 && id.numeric == 0
+}
+
+// Numeric возвращает числовой идентификатор; ok=false для других видов
+func (id NodeID) Numeric() (uint32, bool) {
+	return id.numeric, id.kind == kindNumeric
+}
+
+// String возвращает идентификатор в стандартной записи: ns=2;s=Line1.Speed
+func (id NodeID) String() string {
+	var prefix string
+	if id.Namespace != 0 {
+		prefix = fmt.Sprintf("ns=%d;", id.Namespace)
+	}
+	switch id.kind {
+	case kindString:
+		return prefix + "s=" + id.text
+	case kindGUID:
+		g := hex.EncodeToString([]byte(id.text))
+		return prefix + "g=" + g[0:8] + "-" + g[8:12] + "-" + g[12:16] + "-" + g[16:20] + "-" + g[20:]
+	case kindOpaque:
+		return prefix + "b=" + base64.StdEncoding.EncodeToString([]byte(id.text))
+	default:
+		return prefix + "i=" + strconv.FormatUint(uint64(id.numeric), 10)
+	}
+}
+
+// ParseNodeID разбирает идентификатор узла в стандартной записи:
+// i=85, ns=2;s=Line1.Speed, ns=3;g=..., ns=4;b=<base64>
+func ParseNodeID(s string) (NodeID, error) {
+	s = strings.TrimSpace(s)
+	var id NodeID
+	if rest, ok := strings.CutPrefix(s, "ns="); ok {
+		nsText, body, found := strings.Cut(rest, ";")
+		if !found {
+			return NodeID{}, fmt.Errorf("некорректный NodeId %q", s)
+		}
+		ns, err := strconv.ParseUint(nsText, 10, 16)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("некорректное пространство имён в NodeId %q", s)
+		}
+		id.Namespace = uint16(ns)
+		s = body
+	}
+
+	kind, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return NodeID{}, fmt.Errorf("некорректный NodeId %q: ожидается ns=<n>;i|s|g|b=<id>", s)
+	}
+	switch kind {
+	case "i":
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("некорректный числовой NodeId %q", s)
+		}
+		id.kind, id.numeric = kindNumeric, uint32(n)
+	case "s":
+		id.kind, id.text = kindString, value
+	case "g":
+		raw, err := hex.DecodeString(strings.ReplaceAll(value, "-", ""))
+		if err != nil || len(raw) != 16 {
+			return NodeID{}, fmt.Errorf("некорректный GUID в NodeId %q", s)
+		}
+		id.kind, id.text = kindGUID, string(raw)
+	case "b":
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("некорректный ByteString в NodeId %q", s)
+		}
+		id.kind, id.text = kindOpaque, string(raw)
+	default:
+		return NodeID{}, fmt.Errorf("некорректный NodeId %q: неизвестный вид идентификатора %q", s, kind)
+	}
+	return id, nil
+}
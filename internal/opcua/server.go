@@ -0,0 +1,928 @@
+package opcua
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server сервер OPC UA TCP с переменными в памяти: без шифрования, с
+// анонимным входом или входом по имени и паролю. Поддерживает чтение,
+// запись, просмотр папки Objects и подписки; используется вместо
+// оборудования при проверке опроса.
+type Server struct {
+	mu        sync.Mutex // Защищает поля ниже
+	variables map[NodeID]*variable
+	order     []NodeID          // Порядок добавления переменных для Browse
+	users     map[string]string // Пароли по именам; пусто — только анонимный вход
+	conns     map[*serverConn]struct{}
+	lastID    uint32
+
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// variable переменная адресного пространства
+type variable struct {
+	name  string
+	value DataValue
+	items map[*monitoredItem]struct{} // Отслеживаемые элементы подписок
+}
+
+// NewServer создаёт сервер без переменных с анонимным входом
+func NewServer() *Server {
+	return &Server{
+		variables: make(map[NodeID]*variable),
+		users:     make(map[string]string),
+		conns:     make(map[*serverConn]struct{}),
+	}
+}
+
+// AddUser разрешает вход по имени и паролю. После первого вызова
+// анонимный вход запрещается.
+func (s *Server) AddUser(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = password
+}
+
+// AddVariable добавляет в папку Objects переменную с именем name и
+// начальным значением value. Тип значения определяет DataType переменной:
+// запись значения другого типа отклоняется с BadTypeMismatch. Значение,
+// которое нельзя передать в Variant, возвращает ошибку.
+func (s *Server) AddVariable(id NodeID, name string, value interface{}) error {
+	if err := (&encoder{}).variant(value); err != nil {
+		return fmt.Errorf("переменная %s: %w", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.variables[id]; !exists {
+		s.order = append(s.order, id)
+	}
+	now := time.Now()
+	s.variables[id] = &variable{
+		name:  name,
+		value: DataValue{Value: value, SourceTimestamp: now, ServerTimestamp: now},
+		items: make(map[*monitoredItem]struct{}),
+	}
+	return nil
+}
+
+// SetValue меняет значение переменной и уведомляет подписки. Нулевая
+// SourceTimestamp заменяется текущим временем.
+func (s *Server) SetValue(id NodeID, value DataValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.variables[id]
+	if !ok {
+		return
+	}
+	s.setValue(v, value)
+}
+
+func (s *Server) setValue(v *variable, value DataValue) {
+	now := time.Now()
+	if value.SourceTimestamp.IsZero() {
+		value.SourceTimestamp = now
+	}
+	value.ServerTimestamp = now
+	v.value = value
+	for item := range v.items {
+		item.changed = true
+	}
+}
+
+// Value возвращает текущее значение переменной
+func (s *Server) Value(id NodeID) DataValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.variables[id]; ok {
+		return v.value
+	}
+	return DataValue{Status: StatusBadNodeIDUnknown}
+}
+
+// Listen начинает принимать соединения на address (127.0.0.1:0 — свободный порт)
+func (s *Server) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			sc := &serverConn{server: s, conn: conn, chunkSize: bufferSize, subscriptions: make(map[uint32]*subscription)}
+			s.mu.Lock()
+			s.conns[sc] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				sc.serve()
+			}()
+		}
+	}()
+	return nil
+}
+
+// Endpoint возвращает адрес сервера для клиента: opc.tcp://host:port
+func (s *Server) Endpoint() string {
+	return "opc.tcp://" + s.listener.Addr().String()
+}
+
+// Close закрывает сервер и все соединения
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for sc := range s.conns {
+		sc.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) nextID() uint32 {
+	s.lastID++
+	return s.lastID
+}
+
+// serverConn соединение клиента: канал, сессия и подписки
+type serverConn struct {
+	server    *Server
+	conn      net.Conn
+	chunkSize int // Предел фрагмента, объявленный клиентом
+
+	sendMu   sync.Mutex // Сериализует запись в conn
+	sequence uint32     // Под sendMu
+
+	// Под server.mu
+	channelID     uint32
+	authToken     NodeID
+	activated     bool
+	subscriptions map[uint32]*subscription
+	publishQueue  []pendingPublish
+}
+
+// subscription подписка: элементы, проверяемые с интервалом публикации
+type subscription struct {
+	id        uint32
+	interval  time.Duration
+	keepAlive uint32
+	sequence  uint32
+	idle      uint32 // Интервалы без уведомлений
+	items     []*monitoredItem
+	stop      chan struct{}
+}
+
+// monitoredItem отслеживаемая переменная подписки
+type monitoredItem struct {
+	variable *variable
+	handle   uint32 // ClientHandle
+	changed  bool   // Значение не отправлено клиенту
+}
+
+// pendingPublish запрос Publish, ожидающий уведомлений
+type pendingPublish struct {
+	requestID uint32
+	handle    uint32
+}
+
+// serve обрабатывает сообщения соединения до его закрытия
+func (sc *serverConn) serve() {
+	defer sc.close()
+
+	msg, err := readMessage(sc.conn)
+	if err != nil || msg.kind != "HEL" {
+		return
+	}
+	request, err := decodeHello(msg.body, true)
+	if err != nil {
+		return
+	}
+	if request.receiveBuffer >= 8192 {
+		sc.chunkSize = int(min(request.receiveBuffer, bufferSize))
+	}
+	ack := hello{receiveBuffer: bufferSize, sendBuffer: bufferSize, maxMessage: maxMessageSize}
+	if err := writeMessage(sc.conn, "ACK", chunkFinal, ack.encode(false)); err != nil {
+		return
+	}
+
+	partial := make(map[uint32][]byte)
+	for {
+		msg, err := readMessage(sc.conn)
+		if err != nil {
+			return
+		}
+
+		d := &decoder{b: msg.body}
+		switch msg.kind {
+		case "OPN":
+			d.uint32()
+			if policy := d.string(); policy != securityPolicyNone {
+				sc.sendError(StatusBadSecurityPolicyRejected, "поддерживается только SecurityPolicy None")
+				return
+			}
+			d.bytes()
+			d.bytes()
+		case "MSG":
+			d.uint32()
+			d.uint32()
+		case "CLO":
+			return
+		default:
+			sc.sendError(StatusBadTCPMessageTypeInvalid, msg.kind)
+			return
+		}
+		d.uint32() // SequenceNumber
+		requestID := d.uint32()
+		if d.err != nil {
+			return
+		}
+
+		body := append(partial[requestID], d.b...)
+		if msg.chunk == chunkIntermediate {
+			partial[requestID] = body
+			continue
+		}
+		delete(partial, requestID)
+		if msg.chunk == chunkAbort {
+			continue
+		}
+
+		if msg.kind == "OPN" {
+			if err := sc.openChannel(requestID, body); err != nil {
+				return
+			}
+			continue
+		}
+		sc.handle(requestID, body)
+	}
+}
+
+// close освобождает подписки соединения
+func (sc *serverConn) close() {
+	sc.conn.Close()
+	s := sc.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc.deleteSubscriptions()
+	delete(s.conns, sc)
+}
+
+func (sc *serverConn) sendError(status StatusCode, reason string) {
+	e := &encoder{}
+	e.uint32(uint32(status))
+	e.string(reason)
+	sc.sendMu.Lock()
+	defer sc.sendMu.Unlock()
+	writeMessage(sc.conn, "ERR", chunkFinal, e.b)
+}
+
+// openChannel отвечает на OpenSecureChannel: выдаёт новый токен канала
+func (sc *serverConn) openChannel(requestID uint32, body []byte) error {
+	d := &decoder{b: body}
+	d.nodeID()
+	_, handle := d.requestHeader()
+	d.uint32()
+	d.uint32() // RequestType
+	if mode := d.uint32(); mode != 1 {
+		sc.sendError(StatusBadSecurityPolicyRejected, "поддерживается только режим None")
+		return fmt.Errorf("режим безопасности %d", mode)
+	}
+	d.bytes()
+	lifetime := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+
+	s := sc.server
+	s.mu.Lock()
+	if sc.channelID == 0 {
+		sc.channelID = s.nextID()
+	}
+	channelID, tokenID := sc.channelID, s.nextID()
+	s.mu.Unlock()
+
+	e := &encoder{}
+	e.nodeID(NumericNodeID(0, idOpenSecureChannelRequest+3))
+	e.responseHeader(handle, StatusGood)
+	e.uint32(protocolVersion)
+	e.uint32(channelID)
+	e.uint32(tokenID)
+	e.time(time.Now())
+	e.uint32(lifetime)
+	e.bytes(nil)
+	return sc.send("OPN", channelID, requestID, e.b)
+}
+
+// send отправляет ответ на запрос requestID, разбивая его на фрагменты
+func (sc *serverConn) send(kind string, channelID, requestID uint32, payload []byte) error {
+	sc.sendMu.Lock()
+	defer sc.sendMu.Unlock()
+
+	for first := true; first || len(payload) > 0; first = false {
+		header := &encoder{}
+		header.uint32(channelID)
+		if kind == "OPN" {
+			header.string(securityPolicyNone)
+			header.bytes(nil)
+			header.bytes(nil)
+		} else {
+			header.uint32(0) // TokenId
+		}
+		sc.sequence++
+		header.uint32(sc.sequence)
+		header.uint32(requestID)
+
+		room := sc.chunkSize - headerSize - len(header.b)
+		piece, chunk := payload, byte(chunkFinal)
+		if len(piece) > room && kind == "MSG" {
+			piece, chunk = payload[:room], chunkIntermediate
+		}
+		payload = payload[len(piece):]
+		if err := writeMessage(sc.conn, kind, chunk, append(header.b, piece...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reply отправляет ответ службы; fields кодирует поля после ResponseHeader
+func (sc *serverConn) reply(requestID, requestType, handle uint32, fields func(e *encoder)) {
+	e := &encoder{}
+	e.nodeID(NumericNodeID(0, requestType+3))
+	e.responseHeader(handle, StatusGood)
+	fields(e)
+	sc.send("MSG", sc.channel(), requestID, e.b)
+}
+
+// fault отправляет ServiceFault с кодом status
+func (sc *serverConn) fault(requestID, handle uint32, status StatusCode) {
+	e := &encoder{}
+	e.nodeID(NumericNodeID(0, idServiceFault))
+	e.responseHeader(handle, status)
+	sc.send("MSG", sc.channel(), requestID, e.b)
+}
+
+func (sc *serverConn) channel() uint32 {
+	sc.server.mu.Lock()
+	defer sc.server.mu.Unlock()
+	return sc.channelID
+}
+
+// handle выполняет запрос службы
+func (sc *serverConn) handle(requestID uint32, body []byte) {
+	d := &decoder{b: body}
+	requestType, _ := d.nodeID().Numeric()
+	authToken, handle := d.requestHeader()
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	if requestType != idCreateSessionRequest {
+		s.mu.Lock()
+		valid := !sc.authToken.IsNull() && authToken == sc.authToken
+		activated := sc.activated
+		s.mu.Unlock()
+		switch {
+		case !valid:
+			sc.fault(requestID, handle, StatusBadSessionIDInvalid)
+			return
+		case !activated && requestType != idActivateSessionRequest:
+			sc.fault(requestID, handle, StatusBadSessionNotActivated)
+			return
+		}
+	}
+
+	switch requestType {
+	case idCreateSessionRequest:
+		sc.createSession(requestID, handle, d)
+	case idActivateSessionRequest:
+		sc.activateSession(requestID, handle, d)
+	case idCloseSessionRequest:
+		s.mu.Lock()
+		sc.deleteSubscriptions()
+		sc.activated = false
+		sc.authToken = NodeID{}
+		s.mu.Unlock()
+		sc.reply(requestID, requestType, handle, func(e *encoder) {})
+	case idReadRequest:
+		sc.read(requestID, handle, d)
+	case idWriteRequest:
+		sc.write(requestID, handle, d)
+	case idBrowseRequest:
+		sc.browse(requestID, handle, d)
+	case idCreateSubscriptionRequest:
+		sc.createSubscription(requestID, handle, d)
+	case idCreateMonitoredItemsRequest:
+		sc.createMonitoredItems(requestID, handle, d)
+	case idPublishRequest:
+		s.mu.Lock()
+		if len(sc.subscriptions) == 0 {
+			s.mu.Unlock()
+			sc.fault(requestID, handle, StatusBadNoSubscription)
+			return
+		}
+		sc.publishQueue = append(sc.publishQueue, pendingPublish{requestID: requestID, handle: handle})
+		s.mu.Unlock()
+	case idDeleteSubscriptionsRequest:
+		ids := make([]uint32, d.count())
+		for i := range ids {
+			ids[i] = d.uint32()
+		}
+		results := make([]StatusCode, len(ids))
+		s.mu.Lock()
+		for i, id := range ids {
+			sub, ok := sc.subscriptions[id]
+			if !ok {
+				results[i] = StatusBadSubscriptionIDInvalid
+				continue
+			}
+			sc.deleteSubscription(sub)
+		}
+		s.mu.Unlock()
+		sc.reply(requestID, requestType, handle, func(e *encoder) {
+			e.int32(int32(len(results)))
+			for _, r := range results {
+				e.uint32(uint32(r))
+			}
+			e.int32(-1)
+		})
+	default:
+		sc.fault(requestID, handle, StatusBadServiceUnsupported)
+	}
+}
+
+func (sc *serverConn) createSession(requestID, handle uint32, d *decoder) {
+	d.applicationDescription()
+	d.string()
+	endpoint := d.string()
+	d.string()
+	d.bytes()
+	d.bytes()
+	timeout := d.double()
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	s.mu.Lock()
+	sc.deleteSubscriptions()
+	sessionID := NumericNodeID(1, s.nextID())
+	sc.authToken = NumericNodeID(1, s.nextID())
+	sc.activated = false
+	authToken := sc.authToken
+	anonymous := len(s.users) == 0
+	s.mu.Unlock()
+
+	sc.reply(requestID, idCreateSessionRequest, handle, func(e *encoder) {
+		e.nodeID(sessionID)
+		e.nodeID(authToken)
+		e.double(timeout)
+		e.bytes(make([]byte, 32)) // ServerNonce
+		e.bytes(nil)              // ServerCertificate
+		e.int32(1)                // ServerEndpoints
+		e.string(endpoint)
+		e.applicationDescription("urn:plc_tsdb:test-server", "plc_tsdb test server", 0, endpoint)
+		e.bytes(nil)
+		e.uint32(1) // MessageSecurityMode None
+		e.string(securityPolicyNone)
+		e.int32(1)
+		if anonymous {
+			e.string("anonymous")
+			e.uint32(tokenAnonymous)
+		} else {
+			e.string("username")
+			e.uint32(tokenUserName)
+		}
+		e.string("")
+		e.string("")
+		e.string("")
+		e.string("http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary")
+		e.byte(0)
+		e.int32(-1) // ServerSoftwareCertificates
+		e.signatureData()
+		e.uint32(0) // MaxRequestMessageSize
+	})
+}
+
+func (sc *serverConn) activateSession(requestID, handle uint32, d *decoder) {
+	d.signatureData()
+	for i, n := 0, d.count(); i < n; i++ {
+		d.bytes()
+		d.bytes()
+	}
+	d.strings()
+	tokenType, token := d.extensionObject()
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	s.mu.Lock()
+	accepted := false
+	switch id, _ := tokenType.Numeric(); id {
+	case idAnonymousIdentityToken:
+		accepted = len(s.users) == 0
+	case idUserNameIdentityToken:
+		td := &decoder{b: token}
+		td.string()
+		username, password := td.string(), string(td.bytes())
+		expected, known := s.users[username]
+		accepted = td.err == nil && known && expected == password
+	}
+	sc.activated = accepted
+	s.mu.Unlock()
+
+	if !accepted {
+		sc.fault(requestID, handle, StatusBadIdentityTokenRejected)
+		return
+	}
+	sc.reply(requestID, idActivateSessionRequest, handle, func(e *encoder) {
+		e.bytes(make([]byte, 32))
+		e.int32(-1)
+		e.int32(-1)
+	})
+}
+
+func (sc *serverConn) read(requestID, handle uint32, d *decoder) {
+	d.double()
+	d.uint32()
+	type item struct {
+		node      NodeID
+		attribute uint32
+	}
+	items := make([]item, d.count())
+	for i := range items {
+		items[i] = item{node: d.nodeID(), attribute: d.uint32()}
+		d.string()
+		d.qualifiedName()
+	}
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+	if len(items) == 0 {
+		sc.fault(requestID, handle, StatusBadNothingToDo)
+		return
+	}
+
+	s := sc.server
+	results := make([]DataValue, len(items))
+	s.mu.Lock()
+	for i, it := range items {
+		v, ok := s.variables[it.node]
+		switch {
+		case it.node == serverStateNode && it.attribute == attributeValue:
+			results[i] = DataValue{Value: int32(0), ServerTimestamp: time.Now()} // Running
+		case !ok:
+			results[i] = DataValue{Status: StatusBadNodeIDUnknown}
+		case it.attribute == attributeValue:
+			results[i] = v.value
+		case it.attribute == attributeDataType:
+			results[i] = DataValue{Value: dataTypeOf(v.value.Value)}
+		case it.attribute == attributeBrowseName, it.attribute == attributeDisplayName:
+			results[i] = DataValue{Value: v.name}
+		case it.attribute == attributeNodeClass:
+			results[i] = DataValue{Value: int32(nodeClassVariable)}
+		default:
+			results[i] = DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+	}
+	s.mu.Unlock()
+
+	sc.reply(requestID, idReadRequest, handle, func(e *encoder) {
+		e.int32(int32(len(results)))
+		for _, r := range results {
+			encodeDataValue(e, r)
+		}
+		e.int32(-1)
+	})
+}
+
+// encodeDataValue кодирует значение переменной. Значение, которое нельзя
+// передать в Variant (его задал SetValue), заменяется кодом BadInternalError:
+// иначе ответ был бы обрезан посередине.
+func encodeDataValue(e *encoder, dv DataValue) {
+	value := &encoder{}
+	if err := value.dataValue(dv); err != nil {
+		e.dataValue(DataValue{Status: StatusBadInternalError, ServerTimestamp: dv.ServerTimestamp})
+		return
+	}
+	e.b = append(e.b, value.b...)
+}
+
+// dataTypeOf возвращает NodeId встроенного типа значения (i=11 — Double)
+func dataTypeOf(value interface{}) NodeID {
+	if list, ok := asList(value); ok && len(list) > 0 {
+		value = list[0]
+	}
+	typeID, _ := variantType(value)
+	return NumericNodeID(0, uint32(typeID))
+}
+
+func (sc *serverConn) write(requestID, handle uint32, d *decoder) {
+	type item struct {
+		node      NodeID
+		attribute uint32
+		value     DataValue
+	}
+	items := make([]item, d.count())
+	for i := range items {
+		items[i].node = d.nodeID()
+		items[i].attribute = d.uint32()
+		d.string()
+		items[i].value = d.dataValue()
+	}
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	results := make([]StatusCode, len(items))
+	s.mu.Lock()
+	for i, it := range items {
+		v, ok := s.variables[it.node]
+		switch {
+		case !ok:
+			results[i] = StatusBadNodeIDUnknown
+		case it.attribute != attributeValue:
+			results[i] = StatusBadNotWritable
+		case dataTypeOf(it.value.Value) != dataTypeOf(v.value.Value):
+			results[i] = StatusBadTypeMismatch
+		default:
+			s.setValue(v, DataValue{Value: it.value.Value, Status: it.value.Status, SourceTimestamp: it.value.SourceTimestamp})
+		}
+	}
+	s.mu.Unlock()
+
+	sc.reply(requestID, idWriteRequest, handle, func(e *encoder) {
+		e.int32(int32(len(results)))
+		for _, r := range results {
+			e.uint32(uint32(r))
+		}
+		e.int32(-1)
+	})
+}
+
+func (sc *serverConn) browse(requestID, handle uint32, d *decoder) {
+	d.nodeID()
+	d.time()
+	d.uint32()
+	d.uint32()
+	nodes := make([]NodeID, d.count())
+	for i := range nodes {
+		nodes[i] = d.nodeID()
+		d.uint32()
+		d.nodeID()
+		d.bool()
+		d.uint32()
+		d.uint32()
+	}
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	s.mu.Lock()
+	order := append([]NodeID(nil), s.order...)
+	names := make([]string, len(order))
+	for i, id := range order {
+		names[i] = s.variables[id].name
+	}
+	results := make([]StatusCode, len(nodes))
+	for i, node := range nodes {
+		if _, ok := s.variables[node]; !ok && node != objectsFolder {
+			results[i] = StatusBadNodeIDUnknown
+		}
+	}
+	s.mu.Unlock()
+
+	sc.reply(requestID, idBrowseRequest, handle, func(e *encoder) {
+		e.int32(int32(len(nodes)))
+		for i, node := range nodes {
+			switch {
+			case results[i] != StatusGood:
+				e.uint32(uint32(results[i]))
+				e.bytes(nil)
+				e.int32(0)
+			case node == objectsFolder:
+				e.uint32(uint32(StatusGood))
+				e.bytes(nil)
+				e.int32(int32(len(order)))
+				for i, id := range order {
+					e.nodeID(organizesReference)
+					e.bool(true)
+					e.nodeID(id)
+					e.qualifiedName(id.Namespace, names[i])
+					e.localizedText(names[i])
+					e.uint32(nodeClassVariable)
+					e.nodeID(baseDataVariableType)
+				}
+			default:
+				// Переменные не содержат вложенных узлов
+				e.uint32(uint32(StatusGood))
+				e.bytes(nil)
+				e.int32(0)
+			}
+		}
+		e.int32(-1)
+	})
+}
+
+func (sc *serverConn) createSubscription(requestID, handle uint32, d *decoder) {
+	interval := time.Duration(d.double() * float64(time.Millisecond))
+	lifetime := d.uint32()
+	keepAlive := d.uint32()
+	d.uint32()
+	d.bool()
+	d.byte()
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+	interval = max(interval, 10*time.Millisecond)
+	keepAlive = max(keepAlive, 1)
+
+	s := sc.server
+	s.mu.Lock()
+	sub := &subscription{id: s.nextID(), interval: interval, keepAlive: keepAlive, stop: make(chan struct{})}
+	sc.subscriptions[sub.id] = sub
+	s.mu.Unlock()
+	go sc.runSubscription(sub)
+
+	sc.reply(requestID, idCreateSubscriptionRequest, handle, func(e *encoder) {
+		e.uint32(sub.id)
+		e.double(float64(interval) / float64(time.Millisecond))
+		e.uint32(lifetime)
+		e.uint32(keepAlive)
+	})
+}
+
+func (sc *serverConn) createMonitoredItems(requestID, handle uint32, d *decoder) {
+	subscriptionID := d.uint32()
+	d.uint32()
+	type request struct {
+		node      NodeID
+		attribute uint32
+		handle    uint32
+	}
+	requests := make([]request, d.count())
+	for i := range requests {
+		requests[i].node = d.nodeID()
+		requests[i].attribute = d.uint32()
+		d.string()
+		d.qualifiedName()
+		d.uint32() // MonitoringMode
+		requests[i].handle = d.uint32()
+		d.double()
+		d.extensionObject()
+		d.uint32()
+		d.bool()
+	}
+	if d.err != nil {
+		sc.fault(requestID, handle, StatusBadDecodingError)
+		return
+	}
+
+	s := sc.server
+	s.mu.Lock()
+	sub, ok := sc.subscriptions[subscriptionID]
+	if !ok {
+		s.mu.Unlock()
+		sc.fault(requestID, handle, StatusBadSubscriptionIDInvalid)
+		return
+	}
+	results := make([]StatusCode, len(requests))
+	ids := make([]uint32, len(requests))
+	for i, r := range requests {
+		v, ok := s.variables[r.node]
+		switch {
+		case !ok:
+			results[i] = StatusBadNodeIDUnknown
+		case r.attribute != attributeValue:
+			results[i] = StatusBadAttributeIDInvalid
+		default:
+			// Первое уведомление содержит текущее значение
+			item := &monitoredItem{variable: v, handle: r.handle, changed: true}
+			v.items[item] = struct{}{}
+			sub.items = append(sub.items, item)
+			ids[i] = s.nextID()
+		}
+	}
+	interval := sub.interval
+	s.mu.Unlock()
+
+	sc.reply(requestID, idCreateMonitoredItemsRequest, handle, func(e *encoder) {
+		e.int32(int32(len(results)))
+		for i, r := range results {
+			e.uint32(uint32(r))
+			e.uint32(ids[i])
+			e.double(float64(interval) / float64(time.Millisecond))
+			e.uint32(1)
+			e.extensionObject(0, nil)
+		}
+		e.int32(-1)
+	})
+}
+
+// runSubscription раз в интервал публикации отправляет изменения или
+// keep-alive в ответ на ожидающий Publish
+func (sc *serverConn) runSubscription(sub *subscription) {
+	ticker := time.NewTicker(sub.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s := sc.server
+		s.mu.Lock()
+		var changes []monitoredValue
+		for _, item := range sub.items {
+			if item.changed {
+				changes = append(changes, monitoredValue{handle: item.handle, value: item.variable.value})
+			}
+		}
+		sub.idle++
+		if (len(changes) == 0 && sub.idle < sub.keepAlive) || len(sc.publishQueue) == 0 {
+			s.mu.Unlock()
+			continue
+		}
+		request := sc.publishQueue[0]
+		sc.publishQueue = sc.publishQueue[1:]
+		for _, item := range sub.items {
+			item.changed = false
+		}
+		sub.idle = 0
+		sequence := sub.sequence + 1
+		if len(changes) > 0 {
+			sub.sequence = sequence
+		}
+		s.mu.Unlock()
+
+		sc.reply(request.requestID, idPublishRequest, request.handle, func(e *encoder) {
+			e.uint32(sub.id)
+			e.int32(-1) // AvailableSequenceNumbers
+			e.bool(false)
+			e.uint32(sequence)
+			e.time(time.Now())
+			if len(changes) == 0 {
+				e.int32(0) // Keep-alive
+			} else {
+				notification := &encoder{}
+				notification.int32(int32(len(changes)))
+				for _, c := range changes {
+					notification.uint32(c.handle)
+					encodeDataValue(notification, c.value)
+				}
+				notification.int32(-1)
+				e.int32(1)
+				e.extensionObject(idDataChangeNotification, notification.b)
+			}
+			e.int32(-1) // Results
+			e.int32(-1)
+		})
+	}
+}
+
+// monitoredValue значение для уведомления
+type monitoredValue struct {
+	handle uint32
+	value  DataValue
+}
+
+// deleteSubscriptions удаляет все подписки соединения. Вызывается под server.mu.
+func (sc *serverConn) deleteSubscriptions() {
+	for _, sub := range sc.subscriptions {
+		sc.deleteSubscription(sub)
+	}
+}
+
+// deleteSubscription удаляет подписку. Вызывается под server.mu.
+func (sc *serverConn) deleteSubscription(sub *subscription) {
+	close(sub.stop)
+	for _, item := range sub.items {
+		delete(item.variable.items, item)
+	}
+	delete(sc.subscriptions, sub.id)
+}
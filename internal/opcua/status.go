@@ -0,0 +1,138 @@
+package opcua
+
+import "fmt"
+
+// StatusCode код состояния OPC UA. Старшие два бита — важность:
+// 00 — Good, 01 — Uncertain, 10 — Bad.
+type StatusCode uint32
+
+// Коды состояния, которые различает сборщик (OPC UA Part 6, StatusCode.csv)
+const (
+	StatusGood                          StatusCode = 0x00000000
+	StatusGoodLocalOverride             StatusCode = 0x00960000
+	StatusUncertain                     StatusCode = 0x40000000
+	StatusUncertainLastUsableValue      StatusCode = 0x40900000
+	StatusUncertainSubstituteValue      StatusCode = 0x40910000
+	StatusUncertainEngineeringUnits     StatusCode = 0x40940000
+	StatusBad                           StatusCode = 0x80000000
+	StatusBadUnexpectedError            StatusCode = 0x80010000
+	StatusBadInternalError              StatusCode = 0x80020000
+	StatusBadCommunicationError         StatusCode = 0x80050000
+	StatusBadTimeout                    StatusCode = 0x800A0000
+	StatusBadServiceUnsupported         StatusCode = 0x800B0000
+	StatusBadShutdown                   StatusCode = 0x800C0000
+	StatusBadServerNotConnected         StatusCode = 0x800D0000
+	StatusBadNothingToDo                StatusCode = 0x800F0000
+	StatusBadTooManyOperations          StatusCode = 0x80100000
+	StatusBadDecodingError              StatusCode = 0x80070000
+	StatusBadIdentityTokenInvalid       StatusCode = 0x80200000
+	StatusBadIdentityTokenRejected      StatusCode = 0x80210000
+	StatusBadUserAccessDenied           StatusCode = 0x801F0000
+	StatusBadSecureChannelIDInvalid     StatusCode = 0x80220000
+	StatusBadSessionIDInvalid           StatusCode = 0x80250000
+	StatusBadSessionClosed              StatusCode = 0x80260000
+	StatusBadSessionNotActivated        StatusCode = 0x80270000
+	StatusBadSubscriptionIDInvalid      StatusCode = 0x80280000
+	StatusBadNoCommunication            StatusCode = 0x80310000
+	StatusBadWaitingForInitialData      StatusCode = 0x80320000
+	StatusBadNodeIDInvalid              StatusCode = 0x80330000
+	StatusBadNodeIDUnknown              StatusCode = 0x80340000
+	StatusBadAttributeIDInvalid         StatusCode = 0x80350000
+	StatusBadIndexRangeInvalid          StatusCode = 0x80360000
+	StatusBadIndexRangeNoData           StatusCode = 0x80370000
+	StatusBadNotReadable                StatusCode = 0x803A0000
+	StatusBadNotWritable                StatusCode = 0x803B0000
+	StatusBadOutOfRange                 StatusCode = 0x803C0000
+	StatusBadNotSupported               StatusCode = 0x803D0000
+	StatusBadTypeMismatch               StatusCode = 0x80740000
+	StatusBadNoSubscription             StatusCode = 0x80790000
+	StatusBadTooManyPublishRequests     StatusCode = 0x80780000
+	StatusBadNotConnected               StatusCode = 0x808A0000
+	StatusBadDeviceFailure              StatusCode = 0x808B0000
+	StatusBadSensorFailure              StatusCode = 0x808C0000
+	StatusBadOutOfService               StatusCode = 0x808D0000
+	StatusBadConfigurationError         StatusCode = 0x80890000
+	StatusBadTCPMessageTypeInvalid      StatusCode = 0x807E0000
+	StatusBadSecurityPolicyRejected     StatusCode = 0x80550000
+	StatusBadRequestTooLarge            StatusCode = 0x80B80000
+	StatusBadResponseTooLarge           StatusCode = 0x80B90000
+	StatusBadProtocolVersionUnsupported StatusCode = 0x80BE0000
+)
+
+var statusNames = map[StatusCode]string{
+	StatusGood:                          "Good",
+	StatusGoodLocalOverride:             "GoodLocalOverride",
+	StatusUncertain:                     "Uncertain",
+	StatusUncertainLastUsableValue:      "UncertainLastUsableValue",
+	StatusUncertainSubstituteValue:      "UncertainSubstituteValue",
+	StatusUncertainEngineeringUnits:     "UncertainEngineeringUnitsExceeded",
+	StatusBad:                           "Bad",
+	StatusBadUnexpectedError:            "BadUnexpectedError",
+	StatusBadInternalError:              "BadInternalError",
+	StatusBadCommunicationError:         "BadCommunicationError",
+	StatusBadTimeout:                    "BadTimeout",
+	StatusBadServiceUnsupported:         "BadServiceUnsupported",
+	StatusBadShutdown:                   "BadShutdown",
+	StatusBadServerNotConnected:         "BadServerNotConnected",
+	StatusBadNothingToDo:                "BadNothingToDo",
+	StatusBadTooManyOperations:          "BadTooManyOperations",
+	StatusBadDecodingError:              "BadDecodingError",
+	StatusBadIdentityTokenInvalid:       "BadIdentityTokenInvalid",
+	StatusBadIdentityTokenRejected:      "BadIdentityTokenRejected",
+	StatusBadUserAccessDenied:           "BadUserAccessDenied",
+	StatusBadSecureChannelIDInvalid:     "BadSecureChannelIdInvalid",
+	StatusBadSessionIDInvalid:           "BadSessionIdInvalid",
+	StatusBadSessionClosed:              "BadSessionClosed",
+	StatusBadSessionNotActivated:        "BadSessionNotActivated",
+	StatusBadSubscriptionIDInvalid:      "BadSubscriptionIdInvalid",
+	StatusBadNoCommunication:            "BadNoCommunication",
+	StatusBadWaitingForInitialData:      "BadWaitingForInitialData",
+	StatusBadNodeIDInvalid:              "BadNodeIdInvalid",
+	StatusBadNodeIDUnknown:              "BadNodeIdUnknown",
+	StatusBadAttributeIDInvalid:         "BadAttributeIdInvalid",
+	StatusBadIndexRangeInvalid:          "BadIndexRangeInvalid",
+	StatusBadIndexRangeNoData:           "BadIndexRangeNoData",
+	StatusBadNotReadable:                "BadNotReadable",
+	StatusBadNotWritable:                "BadNotWritable",
+	StatusBadOutOfRange:                 "BadOutOfRange",
+	StatusBadNotSupported:               "BadNotSupported",
+	StatusBadTypeMismatch:               "BadTypeMismatch",
+	StatusBadNoSubscription:             "BadNoSubscription",
+	StatusBadTooManyPublishRequests:     "BadTooManyPublishRequests",
+	StatusBadNotConnected:               "BadNotConnected",
+	StatusBadDeviceFailure:              "BadDeviceFailure",
+	StatusBadSensorFailure:              "BadSensorFailure",
+	StatusBadOutOfService:               "BadOutOfService",
+	StatusBadConfigurationError:         "BadConfigurationError",
+	StatusBadTCPMessageTypeInvalid:      "BadTcpMessageTypeInvalid",
+	StatusBadSecurityPolicyRejected:     "BadSecurityPolicyRejected",
+	StatusBadRequestTooLarge:            "BadRequestTooLarge",
+	StatusBadResponseTooLarge:           "BadResponseTooLarge",
+	StatusBadProtocolVersionUnsupported: "BadProtocolVersionUnsupported",
+}
+
+// Code возвращает код без битов-флагов (InfoType, Overflow и т.п.)
+func (s StatusCode) Code() StatusCode {
+	return s & 0xFFFF0000
+}
+
+// IsGood сообщает, что значение достоверно
+func (s StatusCode) IsGood() bool { return s&0xC0000000 == 0 }
+
+// IsUncertain сообщает, что значение сомнительно
+func (s StatusCode) IsUncertain() bool { return s&0xC0000000 == 0x40000000 }
+
+// IsBad сообщает, что значение недостоверно или отсутствует
+func (s StatusCode) IsBad() bool { return s&0x80000000 != 0 }
+
+func (s StatusCode) String() string {
+	if name, ok := statusNames[s.Code()]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08X", uint32(s))
+}
+
+// Error позволяет возвращать код состояния как ошибку
+func (s StatusCode) Error() string {
+	return "OPC UA " + s.String()
+}
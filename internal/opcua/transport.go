@@ -0,0 +1,243 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Параметры транспорта OPC UA TCP (Part 6, 7.1)
+const (
+	protocolVersion    = 0
+	bufferSize         = 1 << 16 // Размер фрагмента, объявляемый в Hello/Acknowledge
+	maxMessageSize     = 1 << 24 // Предел собранного из фрагментов сообщения
+	headerSize         = 8       // Тип сообщения (3), тип фрагмента (1), длина (4)
+	securityPolicyNone = "http://opcfoundation.org/UA/SecurityPolicy#None"
+)
+
+// Типы фрагментов
+const (
+	chunkFinal        = 'F'
+	chunkIntermediate = 'C'
+	chunkAbort        = 'A'
+)
+
+// Идентификаторы кодировок (DefaultBinary) запросов. Ответ на запрос
+// кодируется идентификатором запроса + 3.
+const (
+	idServiceFault                = 397
+	idAnonymousIdentityToken      = 321
+	idUserNameIdentityToken       = 324
+	idOpenSecureChannelRequest    = 446
+	idCloseSecureChannelRequest   = 452
+	idCreateSessionRequest        = 461
+	idActivateSessionRequest      = 467
+	idCloseSessionRequest         = 473
+	idBrowseRequest               = 527
+	idBrowseNextRequest           = 533
+	idReadRequest                 = 631
+	idWriteRequest                = 673
+	idCreateMonitoredItemsRequest = 751
+	idCreateSubscriptionRequest   = 787
+	idDataChangeNotification      = 811
+	idPublishRequest              = 826
+	idDeleteSubscriptionsRequest  = 847
+)
+
+// Атрибуты узлов
+const (
+	attributeNodeClass   = 2
+	attributeBrowseName  = 3
+	attributeDisplayName = 4
+	attributeValue       = 13
+	attributeDataType    = 14
+)
+
+// Классы узлов
+const (
+	nodeClassObject   = 1
+	nodeClassVariable = 2
+)
+
+// Типы удостоверений пользователя (UserTokenType)
+const (
+	tokenAnonymous = 0
+	tokenUserName  = 1
+)
+
+// Стандартные узлы пространства имён 0
+var (
+	objectsFolder          = NumericNodeID(0, 85)
+	hierarchicalReferences = NumericNodeID(0, 33)
+	organizesReference     = NumericNodeID(0, 35)
+	baseDataVariableType   = NumericNodeID(0, 63)
+	serverStateNode        = NumericNodeID(0, 2259) // Server.ServerStatus.State
+)
+
+// message сообщение транспорта: тип (HEL, ACK, ERR, OPN, MSG, CLO), тип
+// фрагмента и тело после заголовка
+type message struct {
+	kind  string
+	chunk byte
+	body  []byte
+}
+
+func readMessage(r io.Reader) (message, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return message{}, err
+	}
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size < headerSize || size > maxMessageSize {
+		return message{}, fmt.Errorf("некорректная длина сообщения: %d", size)
+	}
+	body := make([]byte, size-headerSize)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return message{}, err
+	}
+	return message{kind: string(header[:3]), chunk: header[3], body: body}, nil
+}
+
+func writeMessage(w io.Writer, kind string, chunk byte, body []byte) error {
+	frame := make([]byte, headerSize, headerSize+len(body))
+	copy(frame, kind)
+	frame[3] = chunk
+	binary.LittleEndian.PutUint32(frame[4:], uint32(headerSize+len(body)))
+	_, err := w.Write(append(frame, body...))
+	return err
+}
+
+// transportError ошибка, присланная сообщением ERR
+type transportError struct {
+	status StatusCode
+	reason string
+}
+
+func (e *transportError) Error() string {
+	if e.reason == "" {
+		return e.status.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.status.Error(), e.reason)
+}
+
+func (e *transportError) Unwrap() error { return e.status }
+
+func decodeTransportError(body []byte) error {
+	d := &decoder{b: body}
+	err := &transportError{status: d.status(), reason: d.string()}
+	if d.err != nil {
+		return fmt.Errorf("некорректное сообщение ERR: %w", d.err)
+	}
+	return err
+}
+
+// hello параметры Hello/Acknowledge
+type hello struct {
+	receiveBuffer, sendBuffer uint32
+	maxMessage, maxChunks     uint32
+	endpoint                  string // Только в Hello
+}
+
+func (h hello) encode(withEndpoint bool) []byte {
+	e := &encoder{}
+	e.uint32(protocolVersion)
+	e.uint32(h.receiveBuffer)
+	e.uint32(h.sendBuffer)
+	e.uint32(h.maxMessage)
+	e.uint32(h.maxChunks)
+	if withEndpoint {
+		e.string(h.endpoint)
+	}
+	return e.b
+}
+
+func decodeHello(body []byte, withEndpoint bool) (hello, error) {
+	d := &decoder{b: body}
+	d.uint32() // Версия протокола: поддерживается только 0
+	h := hello{receiveBuffer: d.uint32(), sendBuffer: d.uint32(), maxMessage: d.uint32(), maxChunks: d.uint32()}
+	if withEndpoint {
+		h.endpoint = d.string()
+	}
+	return h, d.err
+}
+
+// requestHeader кодирует RequestHeader
+func (e *encoder) requestHeader(authToken NodeID, handle uint32, timeoutMs uint32) {
+	e.nodeID(authToken)
+	e.time(time.Now())
+	e.uint32(handle)
+	e.uint32(0)  // ReturnDiagnostics
+	e.string("") // AuditEntryId
+	e.uint32(timeoutMs)
+	e.extensionObject(0, nil)
+}
+
+// requestHeader разбирает RequestHeader и возвращает токен сессии и handle запроса
+func (d *decoder) requestHeader() (NodeID, uint32) {
+	authToken := d.nodeID()
+	d.time()
+	handle := d.uint32()
+	d.uint32()
+	d.string()
+	d.uint32()
+	d.extensionObject()
+	return authToken, handle
+}
+
+// responseHeader кодирует ResponseHeader
+func (e *encoder) responseHeader(handle uint32, result StatusCode) {
+	e.time(time.Now())
+	e.uint32(handle)
+	e.uint32(uint32(result))
+	e.byte(0)   // ServiceDiagnostics
+	e.int32(-1) // StringTable
+	e.extensionObject(0, nil)
+}
+
+// responseHeader разбирает ResponseHeader и возвращает результат службы
+func (d *decoder) responseHeader() StatusCode {
+	d.time()
+	d.uint32()
+	result := d.status()
+	d.diagnosticInfo()
+	d.strings()
+	d.extensionObject()
+	return result
+}
+
+// applicationDescription кодирует ApplicationDescription
+func (e *encoder) applicationDescription(uri, name string, appType uint32, discoveryURL string) {
+	e.string(uri)
+	e.string("") // ProductUri
+	e.localizedText(name)
+	e.uint32(appType)
+	e.string("") // GatewayServerUri
+	e.string("") // DiscoveryProfileUri
+	if discoveryURL == "" {
+		e.strings(nil)
+	} else {
+		e.strings([]string{discoveryURL})
+	}
+}
+
+func (d *decoder) applicationDescription() {
+	d.string()
+	d.string()
+	d.localizedText()
+	d.uint32()
+	d.string()
+	d.string()
+	d.strings()
+}
+
+// signatureData кодирует пустой SignatureData: без шифрования подписи нет
+func (e *encoder) signatureData() {
+	e.string("")
+	e.bytes(nil)
+}
+
+func (d *decoder) signatureData() {
+	d.string()
+	d.bytes()
+}
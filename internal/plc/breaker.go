@@ -0,0 +1,122 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/logging"
+)
+
+// Значения по умолчанию для размыкателя
+const (
+	defaultBreakerThreshold     = 3
+	defaultBreakerProbeInterval = 30 * time.Second
+)
+
+// BreakerState состояние размыкателя опроса ПЛК
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // ПЛК опрашивается каждый цикл
+	BreakerOpen                         // Опрос приостановлен до пробного чтения
+	BreakerHalfOpen                     // Идёт пробное чтение
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerPolicy параметры размыкателя
+type breakerPolicy struct {
+	threshold     int
+	probeInterval time.Duration
+}
+
+// newBreakerPolicy создаёт политику из конфигурации, подставляя значения по умолчанию
+func newBreakerPolicy(cfg config.CircuitBreakerConfig) breakerPolicy {
+	p := breakerPolicy{threshold: cfg.FailureThreshold, probeInterval: cfg.ProbeInterval}
+	if p.threshold <= 0 {
+		p.threshold = defaultBreakerThreshold
+	}
+	if p.probeInterval <= 0 {
+		p.probeInterval = defaultBreakerProbeInterval
+	}
+	return p
+}
+
+// errBreakerOpen возвращается вместо чтения, пока размыкатель разомкнут
+type errBreakerOpen struct {
+	nextProbe time.Time
+}
+
+func (e errBreakerOpen) Error() string {
+	return fmt.Sprintf("опрос приостановлен после ошибок чтения, проба в %s", e.nextProbe.Format("15:04:05"))
+}
+
+// IsBreakerOpen сообщает, что чтение не выполнялось из-за разомкнутого размыкателя
+func IsBreakerOpen(err error) bool {
+	var open errBreakerOpen
+	return errors.As(err, &open)
+}
+
+// allowRead решает, можно ли читать ПЛК в этом цикле. В разомкнутом
+// состоянии по истечении probeInterval пропускается одно пробное чтение.
+func (c *PLCClient) allowRead() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.status.Breaker {
+	case BreakerOpen:
+		if time.Now().Before(c.status.NextProbe) {
+			return errBreakerOpen{nextProbe: c.status.NextProbe}
+		}
+		c.status.Breaker = BreakerHalfOpen
+		logging.Info("Пробное чтение ПЛК", "PLC", c.name)
+		return nil
+	case BreakerHalfOpen:
+		// Пробное чтение уже идёт в другом цикле
+		return errBreakerOpen{nextProbe: c.status.NextProbe}
+	default:
+		return nil
+	}
+}
+
+// recordRead учитывает результат чтения: ошибки подряд размыкают опрос,
+// успешное чтение замыкает его
+func (c *PLCClient) recordRead(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		if c.status.Breaker != BreakerClosed {
+			logging.Info("Опрос ПЛК возобновлён", "PLC", c.name)
+		}
+		c.status.Breaker = BreakerClosed
+		c.status.ReadFailures = 0
+		return
+	}
+
+	c.status.ReadFailures++
+	switch {
+	case c.status.Breaker == BreakerHalfOpen:
+		logging.Debug("Пробное чтение ПЛК не удалось", "PLC", c.name, "error", err)
+	case c.status.ReadFailures >= c.breaker.threshold:
+		logging.Warn("Опрос ПЛК приостановлен", "PLC", c.name, "ошибок подряд", c.status.ReadFailures,
+			"проба через", c.breaker.probeInterval, "error", err)
+	default:
+		return
+	}
+	c.status.Breaker = BreakerOpen
+	c.status.NextProbe = time.Now().Add(c.breaker.probeInterval)
+}
@@ -0,0 +1,70 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+
+	"github.com/danomagnum/gologix"
+)
+
+// Бит структуры в коде типа символа (1756-PM020, Symbol Type)
+const symbolTypeStruct = 0x8000
+
+// BrowseTags подключается к ПЛК plcName, получает список его тегов и
+// отключается. Используется для подготовки tags.yaml.
+func BrowseTags(plcName string, plcConfig config.PLCConfig) ([]browse.Tag, error) {
+	newBuilder, known := driverBuilders[plcConfig.DriverName()]
+	if !known {
+		return nil, fmt.Errorf("неизвестный драйвер %q", plcConfig.DriverName())
+	}
+	cfg := &config.Config{PLCs: map[string]config.PLCConfig{plcName: plcConfig}}
+	driver, err := newBuilder(cfg).build(plcName, plcConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := driver.Connect(); err != nil {
+		return nil, fmt.Errorf("ошибка подключения к %s: %w", driver.Address(), err)
+	}
+	defer driver.Disconnect()
+
+	return driver.Browse(context.Background())
+}
+
+// browsedTag переводит тег из списка gologix в browse.Tag
+func browsedTag(known gologix.KnownTag) browse.Tag {
+	tag := browse.Tag{
+		Name:       known.Name,
+		Dimensions: known.Array_Order,
+	}
+
+	// gologix хранит программные теги как program:Main.Tag
+	if known.Parent != nil {
+		tag.Program = known.Parent.Name
+		tag.Name = "Program:" + known.Parent.Name + strings.TrimPrefix(known.Name, "program:"+known.Parent.Name)
+	}
+
+	symbolType := uint16(known.Info.Type) | uint16(known.Info.TypeInfo)<<8
+	switch {
+	case symbolType&symbolTypeStruct != 0:
+		tag.Struct = true
+		if known.UDT != nil {
+			tag.Type = known.UDT.Name
+		} else {
+			tag.Type = fmt.Sprintf("template_%d", known.Info.Template_ID())
+		}
+	default:
+		if dataType, ok := datatype.LookupCode(uint8(known.Info.Type)); ok {
+			tag.Type = dataType.Name
+			tag.Atomic = true
+		} else {
+			tag.Type = fmt.Sprintf("0x%02X", uint8(known.Info.Type))
+		}
+	}
+	return tag
+}
@@ -1,29 +1,39 @@
 package plc
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
-
-	// "time"
+	"time"
 
 	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
 	"plc_tsdb/internal/logging"
-
-	"github.com/danomagnum/gologix"
 )
 
 // PLCClient представляет клиент для одного ПЛК
 type PLCClient struct {
-	name        string
-	client      *gologix.Client
-	config      *config.PLCConfig
-	isConnected bool
+	name   string
+	driver Driver // Обмен по протоколу из поля driver, см. driverBuilders
+	config *config.PLCConfig
+
+	configErr error // Ошибка в настройке драйвера: подключение невозможно
+
+	mu      sync.Mutex // Защищает status
+	status  ConnectionStatus
+	wake    chan struct{} // Сигнал супервизору о потере соединения
+	breaker breakerPolicy // Когда приостанавливать опрос, см. allowRead
 }
 
 // PLCManager управляет несколькими клиентами ПЛК
 type PLCManager struct {
 	clients map[string]*PLCClient
 	config  *config.Config
+	auditor WriteAuditor // Журнал попыток записи, см. WriteTags
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
 }
 
 // NewPLCManager создает менеджер для работы с несколькими ПЛК
@@ -33,113 +43,136 @@ func NewPLCManager(cfg *config.Config) *PLCManager {
 		config:  cfg,
 	}
 
-	// Создаём общий gologix.Logger, связанный с нашим slog
-	var goLogger gologix.LoggerInterface
-	if l, ok := gologix.NewLogger().(*gologix.Logger); ok {
-		l.SetLogger(logging.Logger) // logging.Logger — твой *slog.Logger
-		goLogger = l
-	}
-
-	// Создаем клиентов для каждого ПЛК
+	// Создаем клиентов для каждого ПЛК с драйвером его протокола
+	builders := make(map[string]driverBuilder)
+	breaker := newBreakerPolicy(cfg.CircuitBreaker)
 	for plcName, plcConfig := range cfg.PLCs {
-		client := gologix.NewClient(plcConfig.Host)
+		driverName := plcConfig.DriverName()
+		builder, exists := builders[driverName]
+		if newBuilder, known := driverBuilders[driverName]; known && !exists {
+			builder = newBuilder(cfg)
+			builders[driverName] = builder
+		}
 
-		// Назначаем логгер клиенту, если поддерживается
-		if goLogger != nil {
-			client.Logger = goLogger
+		var (
+			driver    Driver
+			configErr error
+		)
+		if builder != nil {
+			driver, configErr = builder.build(plcName, plcConfig)
+		} else {
+			configErr = fmt.Errorf("неизвестный драйвер %q", driverName)
+		}
+		if configErr != nil {
+			// Клиент всё равно создаётся: ошибка будет видна в статусе ПЛК
+			configErr = fmt.Errorf("ПЛК %s: %w", plcName, configErr)
+			logging.Error("Ошибка в настройке ПЛК, он не будет опрашиваться", "PLC", plcName, "error", configErr)
 		}
 
 		manager.clients[plcName] = &PLCClient{
-			name:   plcName,
-			config: &plcConfig,
-			client: client,
+			name:      plcName,
+			config:    &plcConfig,
+			driver:    driver,
+			configErr: configErr,
+			wake:      make(chan struct{}, 1),
+			breaker:   breaker,
 		}
 	}
 
 	return manager
 }
 
-// Connect подключается ко всем ПЛК
-func (m *PLCManager) Connect() error {
-	var errors []string
+// Connect запускает супервизоры подключения для всех ПЛК и дожидается
+// первой попытки подключения каждого. Недоступные ПЛК не мешают старту:
+// они переподключаются в фоне, пока остальные опрашиваются.
+func (m *PLCManager) Connect() {
+	m.stopChan = make(chan struct{})
+	policy := newBackoffPolicy(m.config.Reconnect)
 
-	for plcName, client := range m.clients {
-		if err := client.Connect(); err != nil {
-			errors = append(errors, fmt.Sprintf("ПЛК %s: %v", plcName, err))
-		}
+	var firstAttempts sync.WaitGroup
+	for _, client := range m.clients {
+		firstAttempts.Add(1)
+		m.wg.Add(1)
+		go func(client *PLCClient) {
+			defer m.wg.Done()
+			client.supervise(m.stopChan, policy, firstAttempts.Done)
+		}(client)
 	}
+	firstAttempts.Wait()
 
-	if len(errors) > 0 {
-		return fmt.Errorf("ошибки подключения: %v", errors)
+	connected := 0
+	for _, client := range m.clients {
+		if client.connected() {
+			connected++
+		}
+	}
+	if connected < len(m.clients) {
+		logging.Warn("Не все ПЛК подключены, недоступные будут переподключаться в фоне",
+			"подключено", connected, "всего", len(m.clients))
 	}
-
-	return nil
 }
 
-// Disconnect отключается от всех ПЛК
+// Disconnect останавливает супервизоры и отключается от всех ПЛК
 func (m *PLCManager) Disconnect() {
+	if m.stopChan != nil {
+		close(m.stopChan)
+		m.wg.Wait()
+		m.stopChan = nil
+	}
 	for _, client := range m.clients {
 		client.Disconnect()
 	}
 }
 
-// ReadAllTags читает все теги со всех ПЛК параллельно
-func (m *PLCManager) ReadAllTags() (map[string]interface{}, error) {
-	result := make(map[string]interface{})
-	var errors []string
+// Acquisition время получения данных с ПЛК
+type Acquisition struct {
+	Time    time.Time     // Середина интервала от запроса до ответа; нулевое — обмена не было
+	Latency time.Duration // Время от первого запроса до последнего ответа
+}
 
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+// acquisitionSince возвращает время получения данных для обмена, начатого в start
+func acquisitionSince(start time.Time) Acquisition {
+	latency := time.Since(start)
+	return Acquisition{Time: start.Add(latency / 2), Latency: latency}
+}
 
-	for plcName, client := range m.clients {
-		wg.Add(1)
-
-		go func(plcName string, client *PLCClient) {
-			defer wg.Done()
-
-			if !client.isConnected {
-				mu.Lock()
-				errors = append(errors, fmt.Sprintf("ПЛК %s не подключен", plcName))
-				mu.Unlock()
-				return
-			}
-
-			// Получаем теги для этого ПЛК
-			tagsForPLC := m.config.GetTagsByPLC(plcName)
-			if len(tagsForPLC) == 0 {
-				return
-			}
-
-			// Читаем теги
-			plcTags, err := client.readTags(tagsForPLC)
-			if err != nil {
-				mu.Lock()
-				errors = append(errors, fmt.Sprintf("ПЛК %s: %v", plcName, err))
-				mu.Unlock()
-				return
-			}
-
-			// Добавляем теги в общий результат
-			mu.Lock()
-			for tagName, value := range plcTags {
-				fullTagName := fmt.Sprintf("%s/%s", plcName, tagName)
-				result[fullTagName] = value
-			}
-			mu.Unlock()
-		}(plcName, client)
+// ReadPLC читает теги одного ПЛК и возвращает значения под полными именами
+// PLC/тег вместе со временем их получения. Пока размыкатель ПЛК разомкнут,
+// чтение не выполняется.
+func (m *PLCManager) ReadPLC(ctx context.Context, plcName string, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	client, exists := m.clients[plcName]
+	if !exists {
+		return nil, Acquisition{}, fmt.Errorf("ПЛК %s не найден в конфигурации", plcName)
+	}
+	if !client.connected() {
+		return nil, Acquisition{}, fmt.Errorf("ПЛК %s не подключен", plcName)
 	}
 
-	wg.Wait()
+	values, acquisition, err := client.poll(ctx, tags)
 
-	if len(errors) > 0 {
-		return result, fmt.Errorf("ошибки чтения: %v", errors)
+	// Добавляем теги в результат (при ошибке — то, что успели прочитать)
+	result := make(map[string]interface{}, len(values))
+	for tagName, value := range values {
+		result[fmt.Sprintf("%s/%s", plcName, tagName)] = value
 	}
+	if err != nil {
+		return result, acquisition, fmt.Errorf("ПЛК %s: %w", plcName, err)
+	}
+	return result, acquisition, nil
+}
 
-	return result, nil
+// PLCNames возвращает имена всех ПЛК из конфигурации
+func (m *PLCManager) PLCNames() []string {
+	names := make([]string, 0, len(m.clients))
+	for plcName := range m.clients {
+		names = append(names, plcName)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ReadTags читает конкретные теги
-func (m *PLCManager) ReadTags(tagNames []string) (map[string]interface{}, error) {
+func (m *PLCManager) ReadTags(ctx context.Context, tagNames []string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 
 	for _, tagName := range tagNames {
@@ -150,19 +183,22 @@ func (m *PLCManager) ReadTags(tagNames []string) (map[string]interface{}, error)
 		}
 
 		plcClient, exists := m.clients[tagConfig.PLC]
-		if !exists || !plcClient.isConnected {
+		if !exists || !plcClient.connected() {
 			logging.Warn("ПЛК недоступен", "PLC", tagConfig.PLC)
 			continue
 		}
 
-		value, err := plcClient.readSingleTag(tagName, tagConfig)
+		// Массив возвращает несколько рядов, поэтому читаем через общий путь
+		values, _, err := plcClient.readTags(ctx, map[string]config.TagConfig{tagName: tagConfig})
 		if err != nil {
-			logging.Error("Ошибка чтения тега", "tagName", err)
+			logging.Error("Ошибка чтения тега", "tagName", tagName, "error", err)
 			continue
 		}
 
-		fullTagName := fmt.Sprintf("%s/%s", tagConfig.PLC, tagName)
-		result[fullTagName] = value
+		for seriesName, value := range values {
+			fullTagName := fmt.Sprintf("%s/%s", tagConfig.PLC, seriesName)
+			result[fullTagName] = value
+		}
 	}
 
 	return result, nil
@@ -170,107 +206,97 @@ func (m *PLCManager) ReadTags(tagNames []string) (map[string]interface{}, error)
 
 // Connect подключает один ПЛК
 func (c *PLCClient) Connect() error {
-	err := c.client.Connect()
+	if c.configErr != nil {
+		c.recordError(c.configErr)
+		c.setState(StateDisconnected)
+		return c.configErr
+	}
+
+	c.setState(StateConnecting)
+
+	err := c.driver.Connect()
 	if err != nil {
-		return fmt.Errorf("ошибка подключения к ПЛК %s: %w", c.name, err)
+		err = fmt.Errorf("ошибка подключения к ПЛК %s: %w", c.name, err)
+		c.recordError(err)
+		c.setState(StateDisconnected)
+		return err
 	}
 
-	c.isConnected = true
-	logging.Info("Успешно подключен к ПЛК", "PLC", c.name, "IP", c.config.Host)
+	c.mu.Lock()
+	c.status.LastConnected = time.Now()
+	c.status.Failures = 0
+	c.status.NextRetry = time.Time{}
+	c.mu.Unlock()
+
+	c.setState(StateConnected)
+	logging.Info("Успешно подключен к ПЛК", "PLC", c.name, "driver", c.config.DriverName(), "address", c.driver.Address())
 	return nil
 }
 
 // Disconnect отключает ПЛК
 func (c *PLCClient) Disconnect() {
-	if c.isConnected {
-		c.client.Disconnect()
-		c.isConnected = false
+	if c.connected() {
+		c.driver.Disconnect()
+		c.setState(StateDisconnected)
 		logging.Info("Отключен от ПЛК", "PLC", c.name)
 	}
 }
 
-// readTags читает теги для одного ПЛК
-func (c *PLCClient) readTags(tags map[string]config.TagConfig) (map[string]interface{}, error) {
-	tagMap := make(map[string]interface{})
-
-	for tagName, tagConfig := range tags {
-		switch tagConfig.Type {
-		case "float32":
-			tagMap[tagName] = float32(0)
-		case "int32":
-			tagMap[tagName] = int32(0)
-		case "bool":
-			tagMap[tagName] = false
-		// ... другие типы
-		default:
-			logging.Error("Неподдерживаемый тип тега", "TagName", tagName, "Type", tagConfig.Type)
-		}
+// checkReadError проверяет, не разорвала ли ошибка обмена соединение.
+// Драйвер закрывает соединение при сетевых ошибках, поэтому достаточно
+// проверить его состояние.
+func (c *PLCClient) checkReadError(err error) {
+	if !c.driver.Connected() {
+		c.connectionLost(err)
+		return
 	}
-
-	if err := c.client.ReadMulti(tagMap); err != nil {
-		return nil, fmt.Errorf("ошибка чтения тегов: %w", err)
-	}
-
-	// Применяем масштабирование
-	c.applyScaleFactors(tagMap, tags)
-
-	return tagMap, nil
+	c.recordError(err)
 }
 
-// readSingleTag читает один тег
-func (c *PLCClient) readSingleTag(tagName string, tagConfig config.TagConfig) (interface{}, error) {
-	var value interface{}
-
-	switch tagConfig.Type {
-	case "float32":
-		value = float32(0)
-	case "int32":
-		value = int32(0)
-	case "bool":
-		value = false
-	default:
-		return nil, fmt.Errorf("неподдерживаемый тип: %s", tagConfig.Type)
+// poll читает теги с учётом размыкателя: пока он разомкнут, ПЛК не
+// опрашивается, а ошибки чтения подряд его размыкают
+func (c *PLCClient) poll(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	if err := c.allowRead(); err != nil {
+		return nil, Acquisition{}, err
 	}
+	values, acquisition, err := c.readTags(ctx, tags)
+	c.recordRead(err)
+	return values, acquisition, err
+}
 
-	err := c.client.Read(tagName, value)
+// readTags читает теги драйвером и применяет масштабирование.
+// Элементы массива возвращаются под именами вида Temps[3], члены
+// структуры — Pump_A.Speed. При ошибке возвращается то, что успели прочитать.
+func (c *PLCClient) readTags(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	values, acquisition, err := c.driver.Read(ctx, tags)
 	if err != nil {
-		return nil, err
+		c.checkReadError(err)
 	}
-
-	// Применяем масштабирование
-	if tagConfig.ScaleFactor != 0 && tagConfig.ScaleFactor != 1.0 {
-		switch v := value.(type) {
-		case float32:
-			value = v * float32(tagConfig.ScaleFactor)
-		case int32:
-			value = float32(v) * float32(tagConfig.ScaleFactor)
-		}
-	}
-
-	return value, nil
+	scaleSeries(values, tags)
+	return values, acquisition, err
 }
 
-// applyScaleFactors применяет коэффициенты масштабирования
-func (c *PLCClient) applyScaleFactors(tags map[string]interface{}, tagConfigs map[string]config.TagConfig) {
-	for tagName, value := range tags {
-		if tagConfig, exists := tagConfigs[tagName]; exists {
-			if tagConfig.ScaleFactor != 0 && tagConfig.ScaleFactor != 1.0 {
-				switch v := value.(type) {
-				case float32:
-					tags[tagName] = v * float32(tagConfig.ScaleFactor)
-				case int32:
-					tags[tagName] = float32(v) * float32(tagConfig.ScaleFactor)
-				}
-			}
-		}
+// scaleValue умножает числовое значение на коэффициент. Логические значения
+// и коэффициенты 0 и 1 не меняют значение (ok=false).
+func scaleValue(value interface{}, scaleFactor float64) (float64, bool) {
+	if scaleFactor == 0 || scaleFactor == 1.0 {
+		return 0, false
+	}
+	if _, isBool := value.(bool); isBool {
+		return 0, false
+	}
+	numericValue, _, ok := datatype.ToFloat64(value)
+	if !ok {
+		return 0, false
 	}
+	return numericValue * scaleFactor, true
 }
 
 // GetConnectionStatus возвращает статус подключения ПЛК
-func (m *PLCManager) GetConnectionStatus() map[string]bool {
-	status := make(map[string]bool)
+func (m *PLCManager) GetConnectionStatus() map[string]ConnectionStatus {
+	status := make(map[string]ConnectionStatus)
 	for plcName, client := range m.clients {
-		status[plcName] = client.isConnected
+		status[plcName] = client.Status()
 	}
 	return status
 }
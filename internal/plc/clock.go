@@ -0,0 +1,194 @@
+package plc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"plc_tsdb/internal/logging"
+
+	"github.com/danomagnum/gologix"
+)
+
+// Атрибут CurrentUTCValue объекта WallClockTime (класс 0x8B, экземпляр 1)
+// контроллера Logix: мкс от эпохи Unix (UTC), чтение и запись. Атрибут
+// CurrentValue (0x06) хранит местное время с учётом часового пояса
+// контроллера и не используется.
+const wallClockUTCAttr gologix.CIPAttribute = 0x0B
+
+// cipMessenger отправляет произвольный запрос CIP (*gologix.Client)
+type cipMessenger interface {
+	GenericCIPMessage(service gologix.CIPService, path, data []byte) (*gologix.CIPItem, error)
+}
+
+// ClockReading результат чтения часов контроллера
+type ClockReading struct {
+	PLCTime time.Time   // Время контроллера (UTC)
+	At      Acquisition // Время хоста, к которому относится PLCTime
+}
+
+// Offset возвращает смещение часов контроллера относительно хоста:
+// положительное — часы контроллера спешат
+func (r ClockReading) Offset() time.Duration {
+	return r.PLCTime.Sub(r.At.Time)
+}
+
+// wallClockResponse ответ на Get/Set_Attribute_List с одним атрибутом
+type wallClockResponse struct {
+	Count  int16
+	AttrID uint16
+	Status uint16
+}
+
+// ReadClock читает часы контроллера ПЛК plcName
+func (m *PLCManager) ReadClock(ctx context.Context, plcName string) (ClockReading, error) {
+	client, clock, err := m.clockDriver(plcName)
+	if err != nil {
+		return ClockReading{}, err
+	}
+	reading, err := clock.ReadClock(ctx)
+	if err != nil {
+		client.checkReadError(err)
+	}
+	return reading, err
+}
+
+// clockDriver возвращает клиент подключенного ПЛК и его драйвер, если тот умеет работать с часами
+func (m *PLCManager) clockDriver(plcName string) (*PLCClient, ClockDriver, error) {
+	client, exists := m.clients[plcName]
+	if !exists {
+		return nil, nil, fmt.Errorf("ПЛК %s не найден в конфигурации", plcName)
+	}
+	clock, ok := client.driver.(ClockDriver)
+	if !ok {
+		return nil, nil, fmt.Errorf("драйвер %s ПЛК %s не поддерживает часы", client.config.DriverName(), plcName)
+	}
+	if !client.connected() {
+		return nil, nil, fmt.Errorf("ПЛК %s не подключен", plcName)
+	}
+	return client, clock, nil
+}
+
+// SetClock устанавливает часы контроллера ПЛК plcName по часам хоста от
+// имени user. Как и запись тегов, установка часов журналируется (ряд
+// PLC/$clock, старое значение — смещение в секундах) и без журнала запрещена.
+func (m *PLCManager) SetClock(ctx context.Context, user, plcName string) error {
+	if m.auditor == nil {
+		return fmt.Errorf("журнал записи не настроен")
+	}
+
+	oldOffset := math.NaN()
+	err := func() error {
+		client, clock, err := m.clockDriver(plcName)
+		if err != nil {
+			return err
+		}
+		if reading, err := clock.ReadClock(ctx); err == nil {
+			oldOffset = reading.Offset().Seconds()
+		}
+		if err := clock.SetClock(ctx); err != nil {
+			client.checkReadError(err)
+			return err
+		}
+		return nil
+	}()
+
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	auditName := fmt.Sprintf("%s/$clock", plcName)
+	if auditErr := m.auditor.AuditWrite(time.Now(), user, auditName, oldOffset, 0, result); auditErr != nil {
+		logging.Error("Ошибка записи в журнал записи тегов", "tag", auditName, "error", auditErr)
+	}
+
+	if err != nil {
+		logging.Warn("Часы ПЛК не установлены", "PLC", plcName, "user", user, "error", err)
+		return err
+	}
+	logging.Info("Часы ПЛК установлены по часам хоста", "PLC", plcName, "user", user, "смещение было", oldOffset)
+	return nil
+}
+
+// ReadClock читает объект WallClockTime контроллера
+func (d *logixDriver) ReadClock(ctx context.Context) (ClockReading, error) {
+	if err := d.session.lock(ctx); err != nil {
+		return ClockReading{}, fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	defer d.session.unlock()
+
+	start := time.Now()
+	plcTime, err := readWallClock(d.session.client)
+	if err != nil {
+		return ClockReading{}, err
+	}
+	return ClockReading{PLCTime: plcTime, At: acquisitionSince(start)}, nil
+}
+
+// SetClock записывает в объект WallClockTime время хоста
+func (d *logixDriver) SetClock(ctx context.Context) error {
+	if err := d.session.lock(ctx); err != nil {
+		return fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	defer d.session.unlock()
+
+	return writeWallClock(d.session.client, time.Now())
+}
+
+// readWallClock читает время UTC объекта WallClockTime
+func readWallClock(m cipMessenger) (time.Time, error) {
+	item, err := m.GenericCIPMessage(gologix.CIPService_GetAttributeList,
+		wallClockPath(), attributeList(wallClockUTCAttr))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка чтения часов: %w", err)
+	}
+
+	var response struct {
+		Count  int16
+		AttrID uint16
+		Status uint16
+		Micros int64 // Мкс от эпохи Unix
+	}
+	if err := item.DeSerialize(&response); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка разбора ответа часов: %w", err)
+	}
+	if response.Status != 0 {
+		return time.Time{}, fmt.Errorf("ошибка чтения часов: статус атрибута 0x%X", response.Status)
+	}
+	return time.UnixMicro(response.Micros).UTC(), nil
+}
+
+// writeWallClock записывает время now в CurrentUTCValue объекта WallClockTime
+func writeWallClock(m cipMessenger, now time.Time) error {
+	var request bytes.Buffer
+	request.Write(attributeList(wallClockUTCAttr))
+	binary.Write(&request, binary.LittleEndian, uint64(now.UnixMicro()))
+
+	item, err := m.GenericCIPMessage(gologix.CIPService_SetAttributeList, wallClockPath(), request.Bytes())
+	if err != nil {
+		return fmt.Errorf("ошибка установки часов: %w", err)
+	}
+
+	var response wallClockResponse
+	if err := item.DeSerialize(&response); err != nil {
+		return fmt.Errorf("ошибка разбора ответа часов: %w", err)
+	}
+	if response.Status != 0 {
+		return fmt.Errorf("ошибка установки часов: статус атрибута 0x%X", response.Status)
+	}
+	return nil
+}
+
+// wallClockPath возвращает путь CIP к объекту WallClockTime
+func wallClockPath() []byte {
+	path, _ := gologix.Serialize(gologix.CipObject_TIME, gologix.CIPInstance(1))
+	return path.Bytes()
+}
+
+// attributeList возвращает данные запроса Get/Set_Attribute_List для одного атрибута
+func attributeList(attr gologix.CIPAttribute) []byte {
+	return binary.LittleEndian.AppendUint16(binary.LittleEndian.AppendUint16(nil, 1), uint16(attr))
+}
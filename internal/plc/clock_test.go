@@ -0,0 +1,59 @@
+package plc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danomagnum/gologix"
+)
+
+// wallClockStub объект WallClockTime, хранящий записанные атрибуты
+type wallClockStub struct {
+	attrs   map[gologix.CIPAttribute]int64
+	written []gologix.CIPAttribute
+}
+
+func (s *wallClockStub) GenericCIPMessage(service gologix.CIPService, path, data []byte) (*gologix.CIPItem, error) {
+	if !bytes.Equal(path, wallClockPath()) {
+		return nil, fmt.Errorf("путь %X", path)
+	}
+	attr := gologix.CIPAttribute(binary.LittleEndian.Uint16(data[2:]))
+	response := binary.LittleEndian.AppendUint16(nil, 1)
+	response = binary.LittleEndian.AppendUint16(response, uint16(attr))
+	response = binary.LittleEndian.AppendUint16(response, 0)
+
+	switch service {
+	case gologix.CIPService_SetAttributeList:
+		s.written = append(s.written, attr)
+		s.attrs[attr] = int64(binary.LittleEndian.Uint64(data[4:]))
+	case gologix.CIPService_GetAttributeList:
+		response = binary.LittleEndian.AppendUint64(response, uint64(s.attrs[attr]))
+	default:
+		return nil, fmt.Errorf("сервис 0x%X", service)
+	}
+	return &gologix.CIPItem{Data: response}, nil
+}
+
+func TestWallClockWritesUTC(t *testing.T) {
+	stub := &wallClockStub{attrs: make(map[gologix.CIPAttribute]int64)}
+	now := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.FixedZone("MSK", 3*3600))
+
+	if err := writeWallClock(stub, now); err != nil {
+		t.Fatalf("writeWallClock: %v", err)
+	}
+	if len(stub.written) != 1 || stub.written[0] != 0x0B {
+		t.Fatalf("записаны атрибуты %v, ожидался CurrentUTCValue (0x0B)", stub.written)
+	}
+
+	// Чтение возвращает записанное время без сдвига на часовой пояс
+	got, err := readWallClock(stub)
+	if err != nil {
+		t.Fatalf("readWallClock: %v", err)
+	}
+	if !got.Equal(now) {
+		t.Errorf("прочитано %v, записано %v", got, now.UTC())
+	}
+}
@@ -0,0 +1,206 @@
+package plc
+
+import (
+	"math/rand"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/logging"
+)
+
+// Значения по умолчанию для переподключения
+const (
+	defaultReconnectInitialDelay = 1 * time.Second
+	defaultReconnectMaxDelay     = 60 * time.Second
+	defaultReconnectMultiplier   = 2.0
+	defaultReconnectJitter       = 0.2
+)
+
+// ConnectionState состояние подключения к ПЛК
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota // Не подключен, попытка ещё не делалась
+	StateConnecting                          // Идёт попытка подключения
+	StateConnected                           // Подключен, теги опрашиваются
+	StateBackoff                             // Ожидание перед повторной попыткой
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateBackoff:
+		return "backoff"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionStatus снимок состояния подключения одного ПЛК
+type ConnectionStatus struct {
+	State         ConnectionState
+	LastError     string    // Текст последней ошибки подключения или чтения
+	LastErrorTime time.Time // Время последней ошибки
+	LastConnected time.Time // Время последнего успешного подключения
+	Failures      int       // Число неудачных попыток подряд
+	NextRetry     time.Time // Время следующей попытки (в состоянии backoff)
+
+	Breaker      BreakerState // Состояние размыкателя опроса
+	ReadFailures int          // Число ошибок чтения подряд
+	NextProbe    time.Time    // Время пробного чтения (размыкатель разомкнут)
+}
+
+// Connected сообщает, подключен ли ПЛК
+func (s ConnectionStatus) Connected() bool {
+	return s.State == StateConnected
+}
+
+// backoffPolicy рассчитывает задержки между попытками подключения
+type backoffPolicy struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+}
+
+// newBackoffPolicy создаёт политику из конфигурации, подставляя значения по умолчанию
+func newBackoffPolicy(cfg config.ReconnectConfig) backoffPolicy {
+	p := backoffPolicy{
+		initial:    cfg.InitialDelay,
+		max:        cfg.MaxDelay,
+		multiplier: cfg.Multiplier,
+		jitter:     cfg.Jitter,
+	}
+	if p.initial <= 0 {
+		p.initial = defaultReconnectInitialDelay
+	}
+	if p.max <= 0 {
+		p.max = defaultReconnectMaxDelay
+	}
+	if p.max < p.initial {
+		p.max = p.initial
+	}
+	if p.multiplier < 1 {
+		p.multiplier = defaultReconnectMultiplier
+	}
+	if p.jitter <= 0 || p.jitter > 1 {
+		p.jitter = defaultReconnectJitter
+	}
+	return p
+}
+
+// delay возвращает задержку перед попыткой номер failures (начиная с 1)
+func (p backoffPolicy) delay(failures int) time.Duration {
+	d := float64(p.initial)
+	for i := 1; i < failures && d < float64(p.max); i++ {
+		d *= p.multiplier
+	}
+	if d > float64(p.max) {
+		d = float64(p.max)
+	}
+
+	// Случайный разброс в пределах ±jitter, чтобы ПЛК не переподключались синхронно
+	d += d * p.jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+// Status возвращает текущее состояние подключения
+func (c *PLCClient) Status() ConnectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// connected сообщает, подключен ли ПЛК в данный момент
+func (c *PLCClient) connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status.State == StateConnected
+}
+
+// setState меняет состояние и логирует переход
+func (c *PLCClient) setState(state ConnectionState) {
+	c.mu.Lock()
+	prev := c.status.State
+	c.status.State = state
+	c.mu.Unlock()
+
+	if prev != state {
+		logging.Info("Смена состояния подключения ПЛК", "PLC", c.name, "from", prev, "to", state)
+	}
+}
+
+// recordError запоминает последнюю ошибку подключения или чтения
+func (c *PLCClient) recordError(err error) {
+	c.mu.Lock()
+	c.status.LastError = err.Error()
+	c.status.LastErrorTime = time.Now()
+	c.mu.Unlock()
+}
+
+// connectionLost переводит ПЛК в отключенное состояние после ошибки чтения
+// и будит супервизор, чтобы тот начал переподключение
+func (c *PLCClient) connectionLost(err error) {
+	c.recordError(err)
+	if !c.connected() {
+		return
+	}
+
+	logging.Warn("Потеряно соединение с ПЛК", "PLC", c.name, "error", err)
+	c.setState(StateDisconnected)
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// supervise поддерживает подключение к ПЛК, пока не закрыт stop.
+// После ошибки подключения ждёт по экспоненциальной политике с джиттером.
+// firstAttempt вызывается один раз после завершения первой попытки подключения.
+func (c *PLCClient) supervise(stop <-chan struct{}, policy backoffPolicy, firstAttempt func()) {
+	for {
+		if !c.connected() {
+			err := c.Connect()
+			if firstAttempt != nil {
+				firstAttempt()
+				firstAttempt = nil
+			}
+			if err != nil && c.configErr != nil {
+				// Ошибка конфигурации: повторные попытки бессмысленны
+				<-stop
+				return
+			}
+			if err != nil {
+				c.mu.Lock()
+				c.status.Failures++
+				wait := policy.delay(c.status.Failures)
+				c.status.NextRetry = time.Now().Add(wait)
+				failures := c.status.Failures
+				c.mu.Unlock()
+
+				c.setState(StateBackoff)
+				logging.Warn("Не удалось подключиться к ПЛК", "PLC", c.name, "попытка", failures, "повтор через", wait.Round(time.Millisecond), "error", err)
+
+				select {
+				case <-time.After(wait):
+				case <-stop:
+					return
+				}
+				continue
+			}
+		}
+
+		// Подключены: ждём сигнала о потере соединения или остановки
+		select {
+		case <-c.wake:
+		case <-stop:
+			return
+		}
+	}
+}
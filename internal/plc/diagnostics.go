@@ -0,0 +1,262 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+
+	"github.com/danomagnum/gologix"
+)
+
+// Атрибуты объекта Identity (класс 0x01, экземпляр 1)
+const (
+	identityRevision    gologix.CIPAttribute = 4 // Версия прошивки: старший и младший байт
+	identityStatus      gologix.CIPAttribute = 5 // Слово состояния
+	identitySerial      gologix.CIPAttribute = 6 // Серийный номер
+	identityProductName gologix.CIPAttribute = 7 // Наименование (SHORT_STRING)
+)
+
+// Режим контроллера для ряда $diag/mode
+const (
+	ModeProgram = 0 // PROGRAM
+	ModeRun     = 1 // RUN
+	ModeOther   = 2 // Иное состояние (TEST, ошибка и т.п.)
+)
+
+// Diagnostics состояние контроллера по объекту Identity
+type Diagnostics struct {
+	Status        uint16 // Слово состояния
+	FirmwareMajor uint8
+	FirmwareMinor uint8
+	Serial        uint32
+	ProductName   string
+	ScanTime      time.Duration // Время скана из тега scan_time_tag; -1 — не задано или не прочитано
+
+	// Тип и код последней ошибки из тегов *_fault_type_tag и *_fault_code_tag;
+	// -1 — не задано или не прочитано
+	MajorFaultType, MajorFaultCode int
+	MinorFaultType, MinorFaultCode int
+}
+
+// Mode возвращает режим контроллера (ModeRun, ModeProgram, ModeOther)
+// по расширенному состоянию устройства (биты 4..7 слова состояния Logix)
+func (d Diagnostics) Mode() int {
+	switch (d.Status >> 4) & 0x0F {
+	case 6:
+		return ModeRun
+	case 7:
+		return ModeProgram
+	default:
+		return ModeOther
+	}
+}
+
+// KeySwitch возвращает положение ключа Logix (биты 12..13):
+// 1 — RUN, 2 — PROG, 3 — REM, 0 — неизвестно
+func (d Diagnostics) KeySwitch() int {
+	return int(d.Status>>12) & 0x03
+}
+
+// MajorFault возвращает признак серьёзной ошибки: 0 — нет,
+// 1 — устранимая, 2 — неустранимая, 3 — обе (биты 10..11)
+func (d Diagnostics) MajorFault() int {
+	return int(d.Status>>10) & 0x03
+}
+
+// MinorFault возвращает признак незначительной ошибки в том же виде, что
+// MajorFault (биты 8..9)
+func (d Diagnostics) MinorFault() int {
+	return int(d.Status>>8) & 0x03
+}
+
+// Firmware возвращает версию прошивки числом: 32.011 — версия 32.11
+func (d Diagnostics) Firmware() float64 {
+	return float64(d.FirmwareMajor) + float64(d.FirmwareMinor)/1000
+}
+
+// DiagSeries возвращает имя ряда диагностики ПЛК: JAR24/$diag/mode
+func DiagSeries(plcName, name string) string {
+	return fmt.Sprintf("%s/$diag/%s", plcName, name)
+}
+
+// ReadDiagnostics читает диагностику ПЛК и возвращает её рядами
+// PLC/$diag/*. Ряд connected пишется всегда, остальные — только если
+// контроллер ответил.
+func (m *PLCManager) ReadDiagnostics(ctx context.Context, plcName string) (map[string]interface{}, Acquisition, error) {
+	client, exists := m.clients[plcName]
+	if !exists {
+		return nil, Acquisition{}, fmt.Errorf("ПЛК %s не найден в конфигурации", plcName)
+	}
+
+	series := map[string]interface{}{DiagSeries(plcName, "connected"): 0}
+	if !client.connected() {
+		return series, Acquisition{}, nil
+	}
+	series[DiagSeries(plcName, "connected")] = 1
+
+	status, acquisition, err := client.driver.Status(ctx)
+	if err != nil {
+		client.checkReadError(err)
+		return series, acquisition, fmt.Errorf("ПЛК %s: %w", plcName, err)
+	}
+	for name, value := range status {
+		series[DiagSeries(plcName, name)] = value
+	}
+	return series, acquisition, nil
+}
+
+// readDiagnostics читает объект Identity и заданные в конфигурации теги
+// диагностики (время скана, коды ошибок). О смене прошивки, серийного номера,
+// режима или кода ошибки сообщает в лог.
+func (d *logixDriver) readDiagnostics(ctx context.Context) (Diagnostics, Acquisition, error) {
+	diag := Diagnostics{ScanTime: -1, MajorFaultType: -1, MajorFaultCode: -1, MinorFaultType: -1, MinorFaultCode: -1}
+
+	if err := d.session.lock(ctx); err != nil {
+		return diag, Acquisition{}, fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	start := time.Now()
+	err := d.readIdentity(&diag)
+	acquisition := acquisitionSince(start)
+	d.session.unlock()
+	if err != nil {
+		return diag, acquisition, err
+	}
+
+	scanTime := -1
+	d.readDiagTags(ctx, map[string]*int{
+		d.config.ScanTimeTag:       &scanTime,
+		d.config.MajorFaultTypeTag: &diag.MajorFaultType,
+		d.config.MajorFaultCodeTag: &diag.MajorFaultCode,
+		d.config.MinorFaultTypeTag: &diag.MinorFaultType,
+		d.config.MinorFaultCodeTag: &diag.MinorFaultCode,
+	})
+	if scanTime >= 0 {
+		diag.ScanTime = time.Duration(scanTime) * time.Microsecond
+	}
+
+	d.mu.Lock()
+	prev := d.diag
+	d.diag = &diag
+	d.mu.Unlock()
+
+	switch {
+	case prev == nil:
+		logging.Info("Контроллер", "PLC", d.name, "модель", diag.ProductName,
+			"прошивка", fmt.Sprintf("%d.%03d", diag.FirmwareMajor, diag.FirmwareMinor),
+			"серийный номер", fmt.Sprintf("%08X", diag.Serial), "режим", diag.Mode())
+	case prev.Serial != diag.Serial || prev.FirmwareMajor != diag.FirmwareMajor || prev.FirmwareMinor != diag.FirmwareMinor:
+		logging.Warn("Контроллер заменён или перепрошит", "PLC", d.name, "модель", diag.ProductName,
+			"прошивка", fmt.Sprintf("%d.%03d", diag.FirmwareMajor, diag.FirmwareMinor),
+			"серийный номер", fmt.Sprintf("%08X", diag.Serial))
+	case prev.Mode() != diag.Mode() || prev.MajorFault() != diag.MajorFault() ||
+		prev.MajorFaultType != diag.MajorFaultType || prev.MajorFaultCode != diag.MajorFaultCode:
+		logging.Warn("Смена состояния контроллера", "PLC", d.name, "режим", diag.Mode(),
+			"major_fault", diag.MajorFault(), "minor_fault", diag.MinorFault(),
+			"major_fault_type", diag.MajorFaultType, "major_fault_code", diag.MajorFaultCode)
+	}
+	return diag, acquisition, nil
+}
+
+// readDiagTags читает теги диагностики DINT одним запросом и записывает
+// значения по указателям. Пустые имена (тег не задан) пропускаются,
+// непрочитанные теги оставляют прежнее значение.
+func (d *logixDriver) readDiagTags(ctx context.Context, targets map[string]*int) {
+	tags := make(map[string]config.TagConfig)
+	for tagName := range targets {
+		if tagName != "" {
+			tags[tagName] = config.TagConfig{PLC: d.name, Type: "DINT"}
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	values, _, err := d.Read(ctx, tags)
+	for tagName := range tags {
+		v, ok := values[tagName]
+		if !ok || err != nil {
+			logging.Debug("Тег диагностики не прочитан", "PLC", d.name, "tag", tagName, "error", err)
+			continue
+		}
+		if number, _, ok := datatype.ToFloat64(v); ok {
+			*targets[tagName] = int(number)
+		}
+	}
+}
+
+// readIdentity читает атрибуты объекта Identity. Вызывается под session.lock.
+func (d *logixDriver) readIdentity(diag *Diagnostics) error {
+	for _, attr := range []gologix.CIPAttribute{identityRevision, identityStatus, identitySerial, identityProductName} {
+		item, err := d.identityAttr(attr)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения атрибута %d объекта Identity: %w", attr, err)
+		}
+
+		switch attr {
+		case identityRevision:
+			if diag.FirmwareMajor, err = item.Byte(); err == nil {
+				diag.FirmwareMinor, err = item.Byte()
+			}
+		case identityStatus:
+			diag.Status, err = item.Uint16()
+		case identitySerial:
+			diag.Serial, err = item.Uint32()
+		case identityProductName:
+			diag.ProductName = shortString(item.Rest())
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка разбора атрибута %d объекта Identity: %w", attr, err)
+		}
+	}
+	return nil
+}
+
+// identityAttr запрашивает атрибут объекта Identity и проверяет статус ответа
+func (d *logixDriver) identityAttr(attr gologix.CIPAttribute) (*gologix.CIPItem, error) {
+	item, err := d.session.client.GetAttrSingle(gologix.CipObject_Identity, 1, attr)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetAttrSingle не проверяет статус: перечитываем заголовок ответа
+	item.Reset()
+	var header struct {
+		Sequence uint16
+		Service  uint8
+		Reserved uint8
+		Status   uint8
+		ExtSize  uint8
+	}
+	if err := item.DeSerialize(&header); err != nil {
+		return nil, err
+	}
+	if header.Status != 0 {
+		return nil, fmt.Errorf("статус ответа 0x%X", header.Status)
+	}
+	if header.ExtSize > 0 {
+		item.Read(make([]byte, 2*int(header.ExtSize)))
+	}
+	return item, nil
+}
+
+// shortString разбирает SHORT_STRING (байт длины и символы).
+// Управляющие символы отбрасываются: не все устройства следуют формату.
+func shortString(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if n := int(data[0]); n <= len(data)-1 {
+		data = data[1 : 1+n]
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, string(data))
+}
@@ -0,0 +1,125 @@
+package plc
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+)
+
+// Driver обмен с источником данных по одному протоколу. PLCClient отвечает
+// за переподключение, размыкатель, масштабирование и журнал записи, драйвер —
+// только за обмен. Методы, кроме Connect и Disconnect, вызываются на
+// подключенном драйвере, возможно из нескольких горутин одновременно.
+type Driver interface {
+	// Connect устанавливает соединение
+	Connect() error
+	// Disconnect закрывает соединение
+	Disconnect()
+	// Connected сообщает, открыто ли соединение. После ошибки обмена
+	// PLCClient проверяет его, чтобы отличить потерю связи от ошибки тега.
+	Connected() bool
+	// Address возвращает адрес источника для сообщений в лог
+	Address() string
+
+	// Read читает теги пакетом и возвращает сырые (без scale_factor) значения
+	// по именам рядов: элементы массива — Temps[3], члены структуры —
+	// Pump_A.Speed. Ошибки отдельных тегов драйвер пишет в лог и пропускает;
+	// при ошибке обмена возвращает уже прочитанное вместе с ошибкой.
+	Read(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error)
+	// Write записывает сырые значения тегов, приведённые к их типам
+	Write(ctx context.Context, tags map[string]config.TagConfig, values map[string]interface{}) error
+	// Browse возвращает список тегов источника для подготовки tags.yaml
+	Browse(ctx context.Context) ([]browse.Tag, error)
+	// Status возвращает диагностику источника рядами $diag/<имя>
+	// (mode, firmware, ...); драйвер без диагностики возвращает пустой набор
+	Status(ctx context.Context) (map[string]interface{}, Acquisition, error)
+}
+
+// ClockDriver драйвер, умеющий читать и устанавливать часы источника
+type ClockDriver interface {
+	ReadClock(ctx context.Context) (ClockReading, error)
+	// SetClock устанавливает часы источника по часам хоста
+	SetClock(ctx context.Context) error
+}
+
+// driverBuilder создаёт драйверы одного протокола. Один builder создаёт
+// драйверы для всех записей plcs этого протокола, поэтому может делить
+// между ними соединения.
+type driverBuilder interface {
+	// build создаёт драйвер записи plcName. При ошибке в настройке
+	// возвращается ошибка: подключение такого драйвера невозможно.
+	build(plcName string, plcConfig config.PLCConfig) (Driver, error)
+}
+
+// driverBuilders конструкторы драйверов по значению поля driver в plcs.
+// Конструктор получает всю конфигурацию и учитывает только свои записи.
+var driverBuilders = map[string]func(cfg *config.Config) driverBuilder{
+	config.DriverLogix:  newLogixBuilder,
+	config.DriverModbus: newModbusBuilder,
+	config.DriverOPCUA:  newOPCUABuilder,
+	config.DriverSim:    newSimBuilder,
+}
+
+// sortedTagNames возвращает имена тегов ПЛК plcName по алфавиту: builder
+// проверяет теги своих записей в одном порядке при каждом запуске
+func sortedTagNames(tags map[string]config.TagConfig, plcName string) []string {
+	var names []string
+	for tagName, tagConfig := range tags {
+		if tagConfig.PLC == plcName {
+			names = append(names, tagName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scaleSeries применяет коэффициенты масштабирования к рядам, прочитанным
+// драйвером. Масштабированное значение числового тега становится float64;
+// у значения с качеством и меткой времени (database.Sample) масштабируется Value.
+func scaleSeries(values map[string]interface{}, tags map[string]config.TagConfig) {
+	factors := make(map[string]float64)
+	var structs []string // Члены структуры находятся по префиксу Tag.
+	for tagName, tagConfig := range tags {
+		if tagConfig.ScaleFactor == 0 || tagConfig.ScaleFactor == 1.0 {
+			continue
+		}
+		if tagConfig.IsStruct() {
+			structs = append(structs, tagName)
+			continue
+		}
+		spec, isArray, err := config.ParseArrayTag(tagName, tagConfig)
+		if err != nil || !isArray {
+			factors[tagName] = tagConfig.ScaleFactor
+			continue
+		}
+		for i := 0; i < spec.Count; i++ {
+			factors[spec.ElementName(spec.Start+i)] = tagConfig.ScaleFactor
+		}
+	}
+
+	for series, value := range values {
+		factor, ok := factors[series]
+		for _, tagName := range structs {
+			if !ok && strings.HasPrefix(series, tagName+".") {
+				factor, ok = tags[tagName].ScaleFactor, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if sample, isSample := value.(database.Sample); isSample {
+			if scaled, ok := scaleValue(sample.Value, factor); ok {
+				sample.Value = scaled
+				values[series] = sample
+			}
+			continue
+		}
+		if scaled, ok := scaleValue(value, factor); ok {
+			values[series] = scaled
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+
+	"github.com/danomagnum/gologix"
+)
+
+// logixBuilder создаёт драйверы контроллеров Logix. Записи с одинаковыми
+// host и маршрутом ведут к одному процессору и используют общую сессию.
+type logixBuilder struct {
+	logger      gologix.LoggerInterface
+	limiters    map[string]*hostLimiter
+	sessions    map[string]*session
+	sessionErrs map[string]error
+}
+
+func newLogixBuilder(cfg *config.Config) driverBuilder {
+	b := &logixBuilder{
+		logger:      gologixLogger(), // Общий gologix.Logger, связанный с нашим slog
+		limiters:    make(map[string]*hostLimiter),
+		sessions:    make(map[string]*session),
+		sessionErrs: make(map[string]error),
+	}
+
+	// Предел соединений к устройству: наименьший из заданных для его записей
+	maxConnections := make(map[string]int)
+	processors := make(map[string]map[string]bool)
+	for _, plcConfig := range cfg.PLCs {
+		if plcConfig.DriverName() != config.DriverLogix {
+			continue
+		}
+		host := strings.ToLower(plcConfig.Host)
+		if limit := plcConfig.MaxConnections; limit > 0 && (maxConnections[host] == 0 || limit < maxConnections[host]) {
+			maxConnections[host] = limit
+		}
+		if processors[host] == nil {
+			processors[host] = make(map[string]bool)
+		}
+		processors[host][sessionKey(plcConfig)] = true
+	}
+	for host, limit := range maxConnections {
+		b.limiters[host] = newHostLimiter(limit)
+
+		// Предупреждаем, если процессоров за устройством больше, чем разрешено соединений
+		if count := len(processors[host]); count > limit {
+			logging.Warn("Процессоров за устройством больше предела соединений, ПЛК будут опрашиваться по очереди",
+				"host", host, "процессоров", count, "max_connections", limit)
+		}
+	}
+	return b
+}
+
+func (b *logixBuilder) build(plcName string, plcConfig config.PLCConfig) (Driver, error) {
+	key := sessionKey(plcConfig)
+	sess, exists := b.sessions[key]
+	if !exists {
+		var err error
+		sess, err = newSession(plcConfig, b.logger, b.limiters[strings.ToLower(plcConfig.Host)])
+		b.sessions[key], b.sessionErrs[key] = sess, err
+	}
+	return &logixDriver{name: plcName, config: plcConfig, session: sess}, b.sessionErrs[key]
+}
+
+// gologixLogger создаёт gologix.Logger, пишущий в наш slog
+func gologixLogger() gologix.LoggerInterface {
+	if l, ok := gologix.NewLogger().(*gologix.Logger); ok {
+		l.SetLogger(logging.Logger) // logging.Logger — твой *slog.Logger
+		return l
+	}
+	return nil
+}
+
+// newGologixClient создаёт клиент gologix с маршрутом CIP из конфигурации.
+// При ошибке в маршруте возвращает клиент с маршрутом по умолчанию и ошибку.
+func newGologixClient(plcConfig config.PLCConfig, logger gologix.LoggerInterface) (*gologix.Client, error) {
+	client := gologix.NewClient(plcConfig.Host)
+	if logger != nil {
+		client.Logger = logger
+	}
+
+	// gologix.ParsePath не проверяет структуру маршрута (и паникует на IP
+	// в начале), поэтому сначала проверяем его сами
+	cipPath := plcConfig.CIPPath()
+	if err := config.ValidateCIPPath(cipPath); err != nil {
+		return client, err
+	}
+	path, err := gologix.ParsePath(cipPath)
+	if err != nil {
+		return client, fmt.Errorf("некорректный маршрут CIP %q: %w", cipPath, err)
+	}
+	client.Controller.Path = path
+	return client, nil
+}
+
+// logixDriver драйвер контроллеров ControlLogix и CompactLogix по
+// EtherNet/IP (CIP) на основе gologix
+type logixDriver struct {
+	name    string
+	config  config.PLCConfig
+	session *session // Может быть общей с другими ПЛК на том же процессоре
+
+	mu   sync.Mutex   // Защищает diag
+	diag *Diagnostics // Последняя прочитанная диагностика
+}
+
+func (d *logixDriver) Connect() error {
+	if err := d.session.connect(d.name); err != nil {
+		return fmt.Errorf("маршрут %q: %w", d.config.CIPPath(), err)
+	}
+	return nil
+}
+
+func (d *logixDriver) Disconnect() {
+	d.session.disconnect(d.name)
+}
+
+// Connected сообщает состояние сессии: gologix закрывает соединение
+// при сетевых ошибках. Сессия, ждущая очереди на соединение, считается
+// подключённой.
+func (d *logixDriver) Connected() bool {
+	return d.session.connected()
+}
+
+func (d *logixDriver) Address() string {
+	return fmt.Sprintf("%s, маршрут %s", d.config.Host, d.config.CIPPath())
+}
+
+// Read читает теги. Скалярные теги читаются одним пакетным запросом, каждый
+// массив и каждая структура — отдельным запросом. Если дедлайн ctx истекает
+// между запросами, возвращается уже прочитанное вместе с ошибкой. Время
+// получения отсчитывается без ожидания сессии.
+func (d *logixDriver) Read(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	tagMap := make(map[string]interface{})
+	var separate []string // Теги, которые читаются в обход пакетного запроса
+
+	for tagName, tagConfig := range tags {
+		if tagConfig.IsStruct() {
+			separate = append(separate, tagName)
+			continue
+		}
+		dataType, ok := datatype.Lookup(tagConfig.Type)
+		if !ok {
+			logging.Error("Неподдерживаемый тип тега", "TagName", tagName, "Type", tagConfig.Type)
+			continue
+		}
+		// Массивы и ULINT (его не декодирует gologix) читаются отдельно
+		if _, isArray, _ := config.ParseArrayTag(tagName, tagConfig); isArray || dataType.Name == "ULINT" {
+			separate = append(separate, tagName)
+			continue
+		}
+		tagMap[tagName] = dataType.Zero()
+	}
+
+	if err := d.session.lock(ctx); err != nil {
+		return nil, Acquisition{}, fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	defer d.session.unlock()
+
+	start := time.Now()
+	if len(tagMap) > 0 {
+		if err := d.session.client.ReadMulti(tagMap); err != nil {
+			return nil, Acquisition{}, fmt.Errorf("ошибка чтения тегов: %w", err)
+		}
+	}
+
+	for _, tagName := range separate {
+		if err := ctx.Err(); err != nil {
+			return tagMap, acquisitionSince(start), err
+		}
+		values, err := d.readSeparateTag(tagName, tags[tagName])
+		if err != nil {
+			if !d.Connected() {
+				return nil, Acquisition{}, err
+			}
+			logging.Error("Ошибка чтения тега", "TagName", tagName, "error", err)
+			continue
+		}
+		for name, value := range values {
+			tagMap[name] = value
+		}
+	}
+
+	return tagMap, acquisitionSince(start), nil
+}
+
+// readSeparateTag читает массив, структуру или ULINT-тег отдельным запросом и
+// возвращает значения по именам рядов
+func (d *logixDriver) readSeparateTag(tagName string, tagConfig config.TagConfig) (map[string]interface{}, error) {
+	if tagConfig.IsStruct() {
+		return d.readStruct(tagName, tagConfig)
+	}
+	dataType, _ := datatype.Lookup(tagConfig.Type)
+
+	spec, isArray, err := config.ParseArrayTag(tagName, tagConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !isArray {
+		value, err := d.readAtomic(tagName, dataType)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{tagName: value}, nil
+	}
+
+	var values []interface{}
+	if dataType.Name == "BOOL" {
+		values, err = d.readBoolArray(spec)
+	} else {
+		values, err = d.readElements(spec.ElementName(spec.Start), spec.Count, dataType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		result[spec.ElementName(spec.Start+i)] = value
+	}
+	return result, nil
+}
+
+// Write записывает теги по одному под одним захватом сессии
+func (d *logixDriver) Write(ctx context.Context, tags map[string]config.TagConfig, values map[string]interface{}) error {
+	if err := d.session.lock(ctx); err != nil {
+		return fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	defer d.session.unlock()
+
+	for tagName, value := range values {
+		if err := d.session.client.Write(tagName, value); err != nil {
+			return fmt.Errorf("ошибка записи тега %s: %w", tagName, err)
+		}
+	}
+	return nil
+}
+
+// Browse получает список тегов контроллера и программ
+func (d *logixDriver) Browse(ctx context.Context) ([]browse.Tag, error) {
+	if err := d.session.lock(ctx); err != nil {
+		return nil, fmt.Errorf("ПЛК занят другим запросом: %w", err)
+	}
+	defer d.session.unlock()
+
+	if err := d.session.client.ListAllTags(0); err != nil {
+		return nil, fmt.Errorf("ошибка получения списка тегов: %w", err)
+	}
+	d.session.tagsListed = true
+
+	tags := make([]browse.Tag, 0, len(d.session.client.KnownTags))
+	for _, known := range d.session.client.KnownTags {
+		tags = append(tags, browsedTag(known))
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Program != tags[j].Program {
+			return tags[i].Program < tags[j].Program
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// Status возвращает состояние контроллера по объекту Identity, время скана
+// и коды ошибок
+func (d *logixDriver) Status(ctx context.Context) (map[string]interface{}, Acquisition, error) {
+	diag, acquisition, err := d.readDiagnostics(ctx)
+	if err != nil {
+		return nil, acquisition, err
+	}
+
+	series := map[string]interface{}{
+		"status":      diag.Status,
+		"mode":        diag.Mode(),
+		"keyswitch":   diag.KeySwitch(),
+		"major_fault": diag.MajorFault(),
+		"minor_fault": diag.MinorFault(),
+		"firmware":    diag.Firmware(),
+		"serial":      diag.Serial,
+	}
+	if diag.ScanTime >= 0 {
+		series["scan_time"] = diag.ScanTime.Seconds()
+	}
+	for name, value := range map[string]int{
+		"major_fault_type": diag.MajorFaultType,
+		"major_fault_code": diag.MajorFaultCode,
+		"minor_fault_type": diag.MinorFaultType,
+		"minor_fault_code": diag.MinorFaultCode,
+	} {
+		if value >= 0 {
+			series[name] = value
+		}
+	}
+	return series, acquisition, nil
+}
@@ -0,0 +1,330 @@
+package plc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/modbus"
+)
+
+// modbusBuilder создаёт драйверы устройств Modbus TCP. Соединения не
+// делятся: у каждой записи plcs своё, как у шлюзов с несколькими unit ID.
+type modbusBuilder struct {
+	tags map[string]config.TagConfig // Теги всех ПЛК: адреса проверяются при создании драйвера
+}
+
+func newModbusBuilder(cfg *config.Config) driverBuilder {
+	return modbusBuilder{tags: cfg.Tags}
+}
+
+func (b modbusBuilder) build(plcName string, plcConfig config.PLCConfig) (Driver, error) {
+	if err := validateModbusConfig(plcConfig); err != nil {
+		return nil, err
+	}
+	for _, tagName := range sortedTagNames(b.tags, plcName) {
+		if err := validateModbusTag(tagName, b.tags[tagName]); err != nil {
+			return nil, err
+		}
+	}
+
+	port := plcConfig.Port
+	if port == 0 {
+		port = modbus.DefaultPort
+	}
+	maxRegisters := plcConfig.MaxRegisters
+	if maxRegisters == 0 {
+		maxRegisters = modbus.MaxReadRegisters
+	}
+
+	address := net.JoinHostPort(plcConfig.Host, strconv.Itoa(port))
+	return &modbusDriver{
+		name:   plcName,
+		client: modbus.NewClient(address, plcConfig.ModbusUnitID()),
+		encoding: modbus.Encoding{
+			LowWordFirst: plcConfig.WordOrder == config.WordOrderLowFirst,
+			ByteSwap:     plcConfig.ByteSwap,
+		},
+		maxRegisters: maxRegisters,
+	}, nil
+}
+
+// validateModbusConfig проверяет параметры Modbus TCP
+func validateModbusConfig(plcConfig config.PLCConfig) error {
+	if plcConfig.Port < 0 || plcConfig.Port > 65535 {
+		return fmt.Errorf("некорректный порт %d", plcConfig.Port)
+	}
+	if plcConfig.UnitID != nil && (*plcConfig.UnitID < 0 || *plcConfig.UnitID > 255) {
+		return fmt.Errorf("некорректный unit_id %d (0..255)", *plcConfig.UnitID)
+	}
+	switch plcConfig.WordOrder {
+	case "", config.WordOrderHighFirst, config.WordOrderLowFirst:
+	default:
+		return fmt.Errorf("некорректный word_order %q (%s или %s)",
+			plcConfig.WordOrder, config.WordOrderHighFirst, config.WordOrderLowFirst)
+	}
+	if plcConfig.MaxRegisters < 0 || plcConfig.MaxRegisters > modbus.MaxReadRegisters {
+		return fmt.Errorf("некорректный max_registers %d (1..%d)", plcConfig.MaxRegisters, modbus.MaxReadRegisters)
+	}
+	return nil
+}
+
+// validateModbusTag проверяет адрес и тип тега устройства Modbus: биты
+// (coil, di) читаются в BOOL, регистры (ir, hr) — в числовые типы
+func validateModbusTag(tagName string, tagConfig config.TagConfig) error {
+	if tagConfig.IsStruct() {
+		return fmt.Errorf("тег %s: структуры не поддерживаются драйвером modbus", tagName)
+	}
+	if tagConfig.Address == "" {
+		return fmt.Errorf("тег %s: не указан address", tagName)
+	}
+	address, err := modbus.ParseAddress(tagConfig.Address)
+	if err != nil {
+		return fmt.Errorf("тег %s: %w", tagName, err)
+	}
+	dataType, ok := datatype.Lookup(tagConfig.Type)
+	if !ok {
+		return nil // Сообщение о типе — в проверке конфигурации
+	}
+	if address.Table.IsBits() != (dataType.Name == "BOOL") {
+		return fmt.Errorf("тег %s: тип %s не подходит для адреса %s", tagName, dataType.Name, address)
+	}
+	if tagConfig.Writable && !address.Table.Writable() {
+		return fmt.Errorf("тег %s: таблица %s доступна только для чтения", tagName, address.Table)
+	}
+	return nil
+}
+
+// modbusDriver драйвер устройства Modbus TCP. Теги адресуются полем address;
+// соседние адреса одной таблицы читаются одним запросом.
+type modbusDriver struct {
+	name         string
+	client       *modbus.Client
+	encoding     modbus.Encoding // Порядок слов и байт многорегистровых значений
+	maxRegisters int             // Предел регистров в одном запросе
+}
+
+// modbusItem значение одного ряда в таблице устройства
+type modbusItem struct {
+	series   string
+	address  modbus.Address
+	size     int // Число регистров (для битов — 1)
+	dataType datatype.Type
+}
+
+// modbusBlock диапазон адресов одной таблицы, читаемый одним запросом
+type modbusBlock struct {
+	table  modbus.Table
+	offset int
+	count  int
+	items  []modbusItem
+}
+
+func (d *modbusDriver) Connect() error {
+	return d.client.Connect()
+}
+
+func (d *modbusDriver) Disconnect() {
+	d.client.Close()
+}
+
+func (d *modbusDriver) Connected() bool {
+	return d.client.Connected()
+}
+
+func (d *modbusDriver) Address() string {
+	return d.client.String()
+}
+
+// Read читает теги, объединяя соседние адреса одной таблицы в запросы до
+// max_registers регистров. Если устройство отвечает на объединённый запрос
+// исключением (в диапазоне есть неподдерживаемые адреса), теги блока
+// читаются по одному.
+func (d *modbusDriver) Read(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	items := make([]modbusItem, 0, len(tags))
+	for tagName, tagConfig := range tags {
+		tagItems, err := modbusItems(tagName, tagConfig)
+		if err != nil {
+			logging.Error("Ошибка в адресе тега", "PLC", d.name, "TagName", tagName, "error", err)
+			continue
+		}
+		items = append(items, tagItems...)
+	}
+
+	result := make(map[string]interface{}, len(items))
+	start := time.Now()
+	for _, block := range d.coalesce(items) {
+		if err := ctx.Err(); err != nil {
+			return result, acquisitionSince(start), err
+		}
+
+		err := d.readBlock(ctx, block, result)
+		var exception *modbus.Exception
+		if errors.As(err, &exception) && len(block.items) > 1 {
+			logging.Debug("Объединённый запрос отклонён, теги читаются по одному", "PLC", d.name,
+				"address", modbus.Address{Table: block.table, Offset: uint16(block.offset)}, "count", block.count, "error", err)
+			for _, item := range block.items {
+				single := modbusBlock{table: block.table, offset: int(item.address.Offset), count: item.size, items: []modbusItem{item}}
+				if err := d.readBlock(ctx, single, result); err != nil {
+					if !errors.As(err, &exception) {
+						return result, acquisitionSince(start), err
+					}
+					logging.Error("Ошибка чтения тега", "PLC", d.name, "TagName", item.series, "address", item.address, "error", err)
+				}
+			}
+			continue
+		}
+		if errors.As(err, &exception) {
+			logging.Error("Ошибка чтения тега", "PLC", d.name, "TagName", block.items[0].series, "address", block.items[0].address, "error", err)
+			continue
+		}
+		if err != nil {
+			return result, acquisitionSince(start), fmt.Errorf("ошибка чтения тегов: %w", err)
+		}
+	}
+	return result, acquisitionSince(start), nil
+}
+
+// modbusItems разбирает тег на ряды: массив занимает подряд идущие адреса
+func modbusItems(tagName string, tagConfig config.TagConfig) ([]modbusItem, error) {
+	address, err := modbus.ParseAddress(tagConfig.Address)
+	if err != nil {
+		return nil, err
+	}
+	dataType, ok := datatype.Lookup(tagConfig.Type)
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый тип %s", tagConfig.Type)
+	}
+	size := 1
+	if !address.Table.IsBits() {
+		size = (dataType.Size + 1) / 2
+	}
+
+	spec, isArray, err := config.ParseArrayTag(tagName, tagConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !isArray {
+		spec = config.ArraySpec{Count: 1}
+	}
+	if int(address.Offset)+spec.Count*size > 1<<16 {
+		return nil, fmt.Errorf("тег выходит за пределы таблицы %s", address.Table)
+	}
+
+	items := make([]modbusItem, spec.Count)
+	for i := range items {
+		items[i] = modbusItem{series: tagName, address: address, size: size, dataType: dataType}
+		items[i].address.Offset += uint16(i * size)
+		if isArray {
+			items[i].series = spec.ElementName(spec.Start + i)
+		}
+	}
+	return items, nil
+}
+
+// coalesce объединяет ряды в блоки: по таблицам, по возрастанию адреса,
+// пока адреса идут подряд (или перекрываются) и блок не превышает предел запроса
+func (d *modbusDriver) coalesce(items []modbusItem) []modbusBlock {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].address.Table != items[j].address.Table {
+			return items[i].address.Table < items[j].address.Table
+		}
+		return items[i].address.Offset < items[j].address.Offset
+	})
+
+	var blocks []modbusBlock
+	for _, item := range items {
+		limit := d.maxRegisters
+		if item.address.Table.IsBits() {
+			limit = modbus.MaxReadBits
+		}
+
+		offset := int(item.address.Offset)
+		if n := len(blocks); n > 0 {
+			last := &blocks[n-1]
+			end := max(last.offset+last.count, offset+item.size)
+			if last.table == item.address.Table && offset <= last.offset+last.count && end-last.offset <= limit {
+				last.count = end - last.offset
+				last.items = append(last.items, item)
+				continue
+			}
+		}
+		blocks = append(blocks, modbusBlock{table: item.address.Table, offset: offset, count: item.size, items: []modbusItem{item}})
+	}
+	return blocks
+}
+
+// readBlock читает блок одним запросом и раскладывает значения по рядам
+func (d *modbusDriver) readBlock(ctx context.Context, block modbusBlock, result map[string]interface{}) error {
+	if block.table.IsBits() {
+		bits, err := d.client.ReadBits(ctx, block.table, uint16(block.offset), uint16(block.count))
+		if err != nil {
+			return err
+		}
+		for _, item := range block.items {
+			result[item.series] = bits[int(item.address.Offset)-block.offset]
+		}
+		return nil
+	}
+
+	regs, err := d.client.ReadRegisters(ctx, block.table, uint16(block.offset), uint16(block.count))
+	if err != nil {
+		return err
+	}
+	for _, item := range block.items {
+		first := int(item.address.Offset) - block.offset
+		result[item.series] = item.dataType.Decode(d.encoding.Bytes(regs[first : first+item.size]))
+	}
+	return nil
+}
+
+// Write записывает теги по одному: coil — функцией записи бита,
+// регистры хранения — с учётом word_order и byte_swap
+func (d *modbusDriver) Write(ctx context.Context, tags map[string]config.TagConfig, values map[string]interface{}) error {
+	for tagName, value := range values {
+		address, err := modbus.ParseAddress(tags[tagName].Address)
+		if err != nil {
+			return fmt.Errorf("тег %s: %w", tagName, err)
+		}
+
+		switch address.Table {
+		case modbus.Coils:
+			bit, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("тег %s: в coil записывается только BOOL", tagName)
+			}
+			err = d.client.WriteCoils(ctx, address.Offset, []bool{bit})
+		case modbus.HoldingRegisters:
+			raw, encodeErr := binary.Append(nil, binary.LittleEndian, value)
+			if encodeErr != nil {
+				return fmt.Errorf("тег %s: %w", tagName, encodeErr)
+			}
+			err = d.client.WriteRegisters(ctx, address.Offset, d.encoding.Registers(raw))
+		default:
+			return fmt.Errorf("тег %s: таблица %s доступна только для чтения", tagName, address.Table)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка записи тега %s: %w", tagName, err)
+		}
+	}
+	return nil
+}
+
+// Browse недоступен: в Modbus нет списка тегов
+func (d *modbusDriver) Browse(ctx context.Context) ([]browse.Tag, error) {
+	return nil, fmt.Errorf("драйвер modbus не поддерживает просмотр тегов: адреса берутся из документации устройства")
+}
+
+// Status возвращает пустой набор: в Modbus нет стандартной диагностики
+func (d *modbusDriver) Status(ctx context.Context) (map[string]interface{}, Acquisition, error) {
+	return map[string]interface{}{}, Acquisition{}, nil
+}
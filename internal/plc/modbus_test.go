@@ -0,0 +1,230 @@
+package plc
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"testing"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/modbus"
+)
+
+// startModbusServer запускает сервер Modbus TCP с size адресами в каждой таблице
+func startModbusServer(t *testing.T, size int) *modbus.Server {
+	t.Helper()
+	server := modbus.NewServer(size)
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// newModbusTestDriver создаёт и подключает драйвер к серверу; plcConfig
+// дополняется адресом сервера
+func newModbusTestDriver(t *testing.T, server *modbus.Server, plcConfig config.PLCConfig, tags map[string]config.TagConfig) Driver {
+	t.Helper()
+	host, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatalf("SplitHostPort: %v", err)
+	}
+	plcConfig.Driver = config.DriverModbus
+	plcConfig.Host = host
+	plcConfig.Port, _ = strconv.Atoi(port)
+
+	cfg := &config.Config{PLCs: map[string]config.PLCConfig{"VFD1": plcConfig}, Tags: tags}
+	driver, err := newModbusBuilder(cfg).build("VFD1", plcConfig)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if err := driver.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(driver.Disconnect)
+	return driver
+}
+
+func modbusTag(address, dataType string) config.TagConfig {
+	return config.TagConfig{PLC: "VFD1", Type: dataType, Address: address}
+}
+
+func TestModbusReadCoalesced(t *testing.T) {
+	server := startModbusServer(t, 1000)
+	server.SetRegisters(modbus.HoldingRegisters, 0, 100, 0x3FC0, 0x0000)
+	for i := uint16(0); i < 8; i++ {
+		server.SetRegisters(modbus.HoldingRegisters, 3+i, 10+i)
+	}
+	server.SetRegisters(modbus.HoldingRegisters, 500, 7)
+	server.SetBits(modbus.Coils, 0, true, true)
+
+	tags := map[string]config.TagConfig{
+		"Level":       modbusTag("hr:0", "INT"),
+		"Flow":        modbusTag("hr:1", "REAL"),
+		"Temps[0..7]": modbusTag("hr:3", "INT"), // hr:3..10
+		"Far":         modbusTag("hr:500", "INT"),
+		"Run":         modbusTag("coil:0", "BOOL"),
+		"Fault":       modbusTag("coil:1", "BOOL"),
+	}
+	driver := newModbusTestDriver(t, server, config.PLCConfig{MaxRegisters: 10}, tags)
+
+	before := server.Requests()
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	// hr:0..10 — 11 регистров при пределе 10: два запроса; hr:500 — третий;
+	// coil:0..1 — четвёртый
+	if got := server.Requests() - before; got != 4 {
+		t.Errorf("запросов %d, ожидалось 4", got)
+	}
+	want := map[string]interface{}{
+		"Level":    int16(100),
+		"Flow":     float32(1.5),
+		"Temps[0]": int16(10),
+		"Temps[7]": int16(17),
+		"Far":      int16(7),
+		"Run":      true,
+		"Fault":    true,
+	}
+	for series, value := range want {
+		if values[series] != value {
+			t.Errorf("%s = %v (%T), ожидалось %v (%T)", series, values[series], values[series], value, value)
+		}
+	}
+	if len(values) != 13 {
+		t.Errorf("прочитано %d рядов, ожидалось 13: %v", len(values), values)
+	}
+}
+
+func TestModbusWordOrder(t *testing.T) {
+	// REAL 1.5 = 0x3FC00000, DINT 0x12345678
+	tests := []struct {
+		name      string
+		plcConfig config.PLCConfig
+		real      []uint16
+		dint      []uint16
+	}{
+		{"high_first", config.PLCConfig{}, []uint16{0x3FC0, 0x0000}, []uint16{0x1234, 0x5678}},
+		{"low_first", config.PLCConfig{WordOrder: config.WordOrderLowFirst}, []uint16{0x0000, 0x3FC0}, []uint16{0x5678, 0x1234}},
+		{"byte_swap", config.PLCConfig{ByteSwap: true}, []uint16{0xC03F, 0x0000}, []uint16{0x3412, 0x7856}},
+		{"low_first byte_swap", config.PLCConfig{WordOrder: config.WordOrderLowFirst, ByteSwap: true}, []uint16{0x0000, 0xC03F}, []uint16{0x7856, 0x3412}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startModbusServer(t, 100)
+			server.SetRegisters(modbus.InputRegisters, 0, tt.real...)
+			server.SetRegisters(modbus.InputRegisters, 2, tt.dint...)
+
+			tags := map[string]config.TagConfig{
+				"Speed": modbusTag("ir:0", "REAL"),
+				"Count": modbusTag("ir:2", "DINT"),
+			}
+			driver := newModbusTestDriver(t, server, tt.plcConfig, tags)
+			values, _, err := driver.Read(context.Background(), tags)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if values["Speed"] != float32(1.5) {
+				t.Errorf("Speed = %v, ожидалось 1.5", values["Speed"])
+			}
+			if values["Count"] != int32(0x12345678) {
+				t.Errorf("Count = %v, ожидалось %d", values["Count"], 0x12345678)
+			}
+		})
+	}
+}
+
+func TestModbusReadIllegalAddressFallback(t *testing.T) {
+	server := startModbusServer(t, 100)
+	server.SetRegisters(modbus.HoldingRegisters, 96, 1, 2, 0, 42)
+
+	// Count выходит за таблицу (hr:99..100): объединённый запрос hr:96..100
+	// отклоняется, остальные теги читаются по одному
+	tags := map[string]config.TagConfig{
+		"A":     modbusTag("hr:96", "INT"),
+		"B":     modbusTag("hr:97", "INT"),
+		"C":     modbusTag("hr:98", "INT"),
+		"Count": modbusTag("hr:99", "DINT"),
+	}
+	driver := newModbusTestDriver(t, server, config.PLCConfig{}, tags)
+
+	before := server.Requests()
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got := server.Requests() - before; got != 5 {
+		t.Errorf("запросов %d, ожидалось 5 (объединённый и по одному на тег)", got)
+	}
+	want := map[string]interface{}{"A": int16(1), "B": int16(2), "C": int16(0)}
+	for series, value := range want {
+		if values[series] != value {
+			t.Errorf("%s = %v, ожидалось %v", series, values[series], value)
+		}
+	}
+	if _, ok := values["Count"]; ok || len(values) != 3 {
+		t.Errorf("прочитаны ряды %v, ожидались A, B, C", values)
+	}
+}
+
+func TestModbusWriteRoundTrip(t *testing.T) {
+	server := startModbusServer(t, 100)
+	tags := map[string]config.TagConfig{
+		"Start":    {PLC: "VFD1", Type: "BOOL", Address: "coil:5", Writable: true},
+		"Setpoint": {PLC: "VFD1", Type: "REAL", Address: "hr:10", Writable: true},
+		"Limit":    {PLC: "VFD1", Type: "DINT", Address: "40021", Writable: true}, // hr:20
+	}
+	driver := newModbusTestDriver(t, server, config.PLCConfig{WordOrder: config.WordOrderLowFirst}, tags)
+
+	values := map[string]interface{}{
+		"Start":    true,
+		"Setpoint": float32(-12.25),
+		"Limit":    int32(-100000),
+	}
+	if err := driver.Write(context.Background(), tags, values); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if !server.Bits(modbus.Coils, 5, 1)[0] {
+		t.Errorf("coil:5 не установлен")
+	}
+	bits := math.Float32bits(-12.25)
+	if got := server.Registers(modbus.HoldingRegisters, 10, 2); got[0] != uint16(bits) || got[1] != uint16(bits>>16) {
+		t.Errorf("hr:10 = %04X, ожидалось младшее слово первым", got)
+	}
+
+	read, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	for series, value := range values {
+		if read[series] != value {
+			t.Errorf("%s = %v, записано %v", series, read[series], value)
+		}
+	}
+}
+
+func TestModbusBuildValidatesTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		plcConfig config.PLCConfig
+		tag       config.TagConfig
+	}{
+		{"без адреса", config.PLCConfig{}, config.TagConfig{PLC: "VFD1", Type: "INT"}},
+		{"BOOL в регистре", config.PLCConfig{}, modbusTag("hr:0", "BOOL")},
+		{"запись во входной регистр", config.PLCConfig{}, config.TagConfig{PLC: "VFD1", Type: "INT", Address: "ir:0", Writable: true}},
+		{"max_registers", config.PLCConfig{MaxRegisters: 200}, modbusTag("hr:0", "INT")},
+		{"word_order", config.PLCConfig{WordOrder: "middle"}, modbusTag("hr:0", "INT")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Tags: map[string]config.TagConfig{"Tag": tt.tag}}
+			if _, err := newModbusBuilder(cfg).build("VFD1", tt.plcConfig); err == nil {
+				t.Errorf("build без ошибки")
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/opcua"
+)
+
+// defaultPublishInterval интервал публикации подписки OPC UA по умолчанию
+const defaultPublishInterval = time.Second
+
+// Стандартные узлы состояния сервера OPC UA (пространство имён 0)
+var serverStateNode = opcua.NumericNodeID(0, 2259) // Server.ServerStatus.State
+
+// browseDepth предел вложенности папок при просмотре адресного пространства
+const browseDepth = 8
+
+// opcuaBuilder создаёт драйверы серверов OPC UA. У каждой записи plcs своё
+// соединение и своя сессия.
+type opcuaBuilder struct {
+	tags map[string]config.TagConfig // Теги всех ПЛК: NodeId проверяются при создании драйвера
+}
+
+func newOPCUABuilder(cfg *config.Config) driverBuilder {
+	return opcuaBuilder{tags: cfg.Tags}
+}
+
+func (b opcuaBuilder) build(plcName string, plcConfig config.PLCConfig) (Driver, error) {
+	if err := validateOPCUAConfig(plcConfig); err != nil {
+		return nil, err
+	}
+	for _, tagName := range sortedTagNames(b.tags, plcName) {
+		if err := validateOPCUATag(tagName, b.tags[tagName]); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := plcConfig.PublishInterval
+	if interval == 0 {
+		interval = defaultPublishInterval
+	}
+	return &opcuaDriver{
+		name:            plcName,
+		client:          opcua.NewClient(plcConfig.Endpoint, plcConfig.Username, plcConfig.Password),
+		subscribe:       plcConfig.Subscribe,
+		publishInterval: interval,
+	}, nil
+}
+
+// validateOPCUAConfig проверяет параметры OPC UA
+func validateOPCUAConfig(plcConfig config.PLCConfig) error {
+	if !strings.HasPrefix(plcConfig.Endpoint, "opc.tcp://") {
+		return fmt.Errorf("некорректный endpoint %q: ожидается opc.tcp://host:port", plcConfig.Endpoint)
+	}
+	if plcConfig.Password != "" && plcConfig.Username == "" {
+		return fmt.Errorf("password задан без username")
+	}
+	if plcConfig.PublishInterval < 0 || (plcConfig.PublishInterval > 0 && !plcConfig.Subscribe) {
+		return fmt.Errorf("publish_interval задаётся положительным и только вместе с subscribe: true")
+	}
+	return nil
+}
+
+// validateOPCUATag проверяет NodeId тега сервера OPC UA
+func validateOPCUATag(tagName string, tagConfig config.TagConfig) error {
+	if tagConfig.IsStruct() {
+		return fmt.Errorf("тег %s: структуры не поддерживаются драйвером opcua", tagName)
+	}
+	if tagConfig.Address == "" {
+		return fmt.Errorf("тег %s: не указан address (NodeId)", tagName)
+	}
+	if _, err := opcua.ParseNodeID(tagConfig.Address); err != nil {
+		return fmt.Errorf("тег %s: %w", tagName, err)
+	}
+	return nil
+}
+
+// opcuaDriver драйвер сервера OPC UA. Теги адресуются NodeId в поле address.
+// Значения возвращаются как database.Sample: качество берётся из кода
+// состояния, метка времени — из SourceTimestamp (или ServerTimestamp).
+// С subscribe: true значения приходят уведомлениями подписки, а Read
+// возвращает последние из них; узлы без уведомления читаются запросом.
+// Неизменившееся значение возвращается с прежней меткой источника:
+// повтор точки отбрасывается при записи в БД.
+type opcuaDriver struct {
+	name            string
+	client          *opcua.Client
+	subscribe       bool
+	publishInterval time.Duration
+
+	mu        sync.Mutex                 // Защищает поля ниже
+	monitored map[string]bool            // Узлы, для которых создан отслеживаемый элемент
+	latest    map[string]opcua.DataValue // Последние уведомления по узлам
+}
+
+// opcuaItem узел, значение которого раскладывается на ряды тега
+type opcuaItem struct {
+	tagName   string
+	tagConfig config.TagConfig
+	node      opcua.NodeID
+}
+
+func (d *opcuaDriver) Connect() error {
+	if err := d.client.Connect(); err != nil {
+		return err
+	}
+	// Подписки принадлежат сессии: после переподключения создаются заново
+	d.mu.Lock()
+	d.monitored = make(map[string]bool)
+	d.latest = make(map[string]opcua.DataValue)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *opcuaDriver) Disconnect() {
+	d.client.Close()
+}
+
+func (d *opcuaDriver) Connected() bool {
+	return d.client.Connected()
+}
+
+func (d *opcuaDriver) Address() string {
+	return d.client.String()
+}
+
+// Read читает узлы тегов одним запросом Read или берёт значения из
+// уведомлений подписки
+func (d *opcuaDriver) Read(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	items := make([]opcuaItem, 0, len(tags))
+	for tagName, tagConfig := range tags {
+		node, err := opcua.ParseNodeID(tagConfig.Address)
+		if err != nil {
+			logging.Error("Ошибка в адресе тега", "PLC", d.name, "TagName", tagName, "error", err)
+			continue
+		}
+		items = append(items, opcuaItem{tagName: tagName, tagConfig: tagConfig, node: node})
+	}
+
+	result := make(map[string]interface{}, len(items))
+	start := time.Now()
+	if d.subscribe {
+		if err := d.monitor(ctx, items); err != nil {
+			return result, acquisitionSince(start), err
+		}
+		// Значения из уведомлений; узлы, по которым их ещё нет, читаются запросом
+		d.mu.Lock()
+		var pending []opcuaItem
+		for _, item := range items {
+			if value, ok := d.latest[item.node.String()]; ok {
+				d.series(item, value, result)
+				continue
+			}
+			pending = append(pending, item)
+		}
+		d.mu.Unlock()
+		items = pending
+	}
+	if len(items) == 0 {
+		return result, acquisitionSince(start), nil
+	}
+
+	nodes := make([]opcua.NodeID, len(items))
+	for i, item := range items {
+		nodes[i] = item.node
+	}
+	values, err := d.client.Read(ctx, nodes)
+	acquisition := acquisitionSince(start)
+	if err != nil {
+		return result, acquisition, fmt.Errorf("ошибка чтения тегов: %w", err)
+	}
+	for i, item := range items {
+		d.series(item, values[i], result)
+	}
+	return result, acquisition, nil
+}
+
+// monitor создаёт отслеживаемые элементы для узлов, ещё не включённых в
+// подписку. Узлы, которые сервер отклонил, дальше читаются запросом.
+func (d *opcuaDriver) monitor(ctx context.Context, items []opcuaItem) error {
+	d.mu.Lock()
+	var keys []string
+	var nodes []opcua.NodeID
+	for _, item := range items {
+		key := item.node.String()
+		if _, ok := d.monitored[key]; !ok {
+			d.monitored[key] = false
+			keys = append(keys, key)
+			nodes = append(nodes, item.node)
+		}
+	}
+	d.mu.Unlock()
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	results, err := d.client.Subscribe(ctx, d.publishInterval, nodes, func(handle uint32, value opcua.DataValue) {
+		if int(handle) >= len(keys) {
+			return
+		}
+		d.mu.Lock()
+		d.latest[keys[handle]] = value
+		d.mu.Unlock()
+	})
+	if err != nil {
+		d.mu.Lock()
+		for _, key := range keys {
+			delete(d.monitored, key)
+		}
+		d.mu.Unlock()
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, status := range results {
+		if status.IsBad() {
+			logging.Warn("Узел не включён в подписку, читается опросом", "PLC", d.name, "node", keys[i], "status", status)
+			continue
+		}
+		d.monitored[keys[i]] = true
+	}
+	logging.Info("Создана подписка OPC UA", "PLC", d.name, "nodes", len(nodes), "publish_interval", d.publishInterval)
+	return nil
+}
+
+// series раскладывает значение узла на ряды тега: массив — по элементам
+// Tag[i] из диапазона тега. Значение без метки источника получает метку сервера.
+func (d *opcuaDriver) series(item opcuaItem, value opcua.DataValue, result map[string]interface{}) {
+	timestamp := value.SourceTimestamp
+	if timestamp.IsZero() {
+		timestamp = value.ServerTimestamp
+	}
+	quality := opcuaQuality(value.Status)
+	if quality != database.QualityGood {
+		logging.Debug("Значение узла с нехорошим качеством", "PLC", d.name, "TagName", item.tagName,
+			"node", item.node, "status", value.Status)
+	}
+
+	spec, isArray, err := config.ParseArrayTag(item.tagName, item.tagConfig)
+	if err != nil {
+		logging.Error("Ошибка в описании массива", "PLC", d.name, "TagName", item.tagName, "error", err)
+		return
+	}
+	if !isArray {
+		if _, isList := value.Value.([]interface{}); isList {
+			logging.Error("Узел содержит массив, укажите elements", "PLC", d.name, "TagName", item.tagName, "node", item.node)
+			return
+		}
+		result[item.tagName] = database.Sample{Value: value.Value, Quality: quality, Timestamp: timestamp}
+		return
+	}
+
+	list, isList := value.Value.([]interface{})
+	if !isList && value.Value != nil {
+		logging.Error("Узел не содержит массив", "PLC", d.name, "TagName", item.tagName, "node", item.node)
+		return
+	}
+	for i := 0; i < spec.Count; i++ {
+		index := spec.Start + i
+		var element interface{}
+		if index < len(list) {
+			element = list[index]
+		} else if quality.IsGood() {
+			continue // Элемента нет на сервере: ряд отмечается как непрочитанный
+		}
+		result[spec.ElementName(index)] = database.Sample{Value: element, Quality: quality, Timestamp: timestamp}
+	}
+}
+
+// opcuaQuality переводит код состояния OPC UA в признак качества: сбои
+// связи сервера с устройством — CommFailure, ошибки адреса и типа —
+// ConfigError, остальные коды — по важности (Good, Uncertain, Bad)
+func opcuaQuality(status opcua.StatusCode) database.Quality {
+	switch status.Code() {
+	case opcua.StatusGoodLocalOverride, opcua.StatusUncertainSubstituteValue:
+		return database.QualitySubstituted
+	case opcua.StatusUncertainLastUsableValue:
+		return database.QualityStale
+	case opcua.StatusUncertainEngineeringUnits, opcua.StatusBadOutOfRange:
+		return database.QualityOutOfRange
+	case opcua.StatusBadCommunicationError, opcua.StatusBadNoCommunication, opcua.StatusBadNotConnected,
+		opcua.StatusBadServerNotConnected, opcua.StatusBadWaitingForInitialData, opcua.StatusBadTimeout,
+		opcua.StatusBadShutdown:
+		return database.QualityCommFailure
+	case opcua.StatusBadNodeIDUnknown, opcua.StatusBadNodeIDInvalid, opcua.StatusBadAttributeIDInvalid,
+		opcua.StatusBadTypeMismatch, opcua.StatusBadNotReadable, opcua.StatusBadUserAccessDenied,
+		opcua.StatusBadIndexRangeInvalid, opcua.StatusBadConfigurationError:
+		return database.QualityConfigError
+	}
+	switch {
+	case status.IsGood():
+		return database.QualityGood
+	case status.IsUncertain():
+		return database.QualityUncertain
+	default:
+		return database.QualityBad
+	}
+}
+
+// Write записывает значения узлов одним запросом. Тип значения (по type
+// тега) должен совпадать с DataType узла, иначе сервер вернёт BadTypeMismatch.
+func (d *opcuaDriver) Write(ctx context.Context, tags map[string]config.TagConfig, values map[string]interface{}) error {
+	names := make([]string, 0, len(values))
+	nodes := make([]opcua.NodeID, 0, len(values))
+	raw := make([]interface{}, 0, len(values))
+	for tagName, value := range values {
+		node, err := opcua.ParseNodeID(tags[tagName].Address)
+		if err != nil {
+			return fmt.Errorf("тег %s: %w", tagName, err)
+		}
+		names = append(names, tagName)
+		nodes = append(nodes, node)
+		raw = append(raw, value)
+	}
+
+	results, err := d.client.Write(ctx, nodes, raw)
+	if err != nil {
+		return fmt.Errorf("ошибка записи тегов: %w", err)
+	}
+	for i, status := range results {
+		if status.IsBad() && i < len(names) {
+			return fmt.Errorf("ошибка записи тега %s: %w", names[i], status)
+		}
+	}
+	return nil
+}
+
+// opcuaTypes соответствие встроенных типов OPC UA (DataType) типам тегов
+var opcuaTypes = map[string]string{
+	"i=1":  "BOOL",
+	"i=2":  "SINT",
+	"i=3":  "USINT",
+	"i=4":  "INT",
+	"i=5":  "UINT",
+	"i=6":  "DINT",
+	"i=7":  "UDINT",
+	"i=8":  "LINT",
+	"i=9":  "ULINT",
+	"i=10": "REAL",
+	"i=11": "LREAL",
+}
+
+// Browse обходит папку Objects (кроме узлов пространства имён 0) и
+// возвращает переменные с путём из BrowseName в качестве имени
+func (d *opcuaDriver) Browse(ctx context.Context) ([]browse.Tag, error) {
+	var tags []browse.Tag
+	var nodes []opcua.NodeID
+	visited := make(map[string]bool)
+
+	var walk func(node opcua.NodeID, path string, depth int) error
+	walk = func(node opcua.NodeID, path string, depth int) error {
+		refs, err := d.client.Browse(ctx, node)
+		if err != nil {
+			return fmt.Errorf("ошибка просмотра узла %s: %w", node, err)
+		}
+		for _, ref := range refs {
+			key := ref.NodeID.String()
+			if ref.NodeID.Namespace == 0 || visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			name := ref.BrowseName
+			if path != "" {
+				name = path + "." + name
+			}
+			switch {
+			case ref.IsVariable():
+				tag := browse.Tag{Name: name, Address: key}
+				if ref.DisplayName != ref.BrowseName {
+					tag.Description = ref.DisplayName
+				}
+				tags = append(tags, tag)
+				nodes = append(nodes, ref.NodeID)
+			case ref.IsObject() && depth < browseDepth:
+				if err := walk(ref.NodeID, name, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(opcua.NumericNodeID(0, 85), "", 0); err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return tags, nil
+	}
+
+	dataTypes, err := d.client.DataTypes(ctx, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения типов переменных: %w", err)
+	}
+	for i := range tags {
+		tags[i].Type, tags[i].Atomic = opcuaTypes[dataTypes[i]]
+		if !tags[i].Atomic {
+			tags[i].Type = dataTypes[i]
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+	return tags, nil
+}
+
+// Status возвращает состояние сервера: status — ServerState
+// (0 — Running, 1 — Failed, ..., 7 — Unknown)
+func (d *opcuaDriver) Status(ctx context.Context) (map[string]interface{}, Acquisition, error) {
+	start := time.Now()
+	values, err := d.client.Read(ctx, []opcua.NodeID{serverStateNode})
+	acquisition := acquisitionSince(start)
+	if err != nil {
+		return nil, acquisition, err
+	}
+	series := make(map[string]interface{})
+	if values[0].Status.IsGood() {
+		series["status"] = values[0].Value
+	}
+	return series, acquisition, nil
+}
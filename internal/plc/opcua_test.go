@@ -0,0 +1,215 @@
+package plc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/opcua"
+)
+
+var (
+	speedNode    = opcua.StringNodeID(2, "Line1.Speed")
+	setpointNode = opcua.StringNodeID(2, "Line1.Setpoint")
+	tempsNode    = opcua.StringNodeID(2, "Line1.Temps")
+)
+
+// startOPCUAServer запускает сервер OPC UA с переменными Line1.Speed (LREAL),
+// Line1.Setpoint (REAL) и массивом Line1.Temps (REAL[4])
+func startOPCUAServer(t *testing.T) *opcua.Server {
+	t.Helper()
+	server := opcua.NewServer()
+	for id, value := range map[opcua.NodeID]interface{}{
+		speedNode:    float64(1450),
+		setpointNode: float32(20),
+		tempsNode:    []float32{10, 11, 12, 13},
+	} {
+		if err := server.AddVariable(id, id.String(), value); err != nil {
+			t.Fatalf("AddVariable: %v", err)
+		}
+	}
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// newOPCUATestDriver создаёт и подключает драйвер к серверу
+func newOPCUATestDriver(t *testing.T, server *opcua.Server, plcConfig config.PLCConfig, tags map[string]config.TagConfig) Driver {
+	t.Helper()
+	plcConfig.Driver = config.DriverOPCUA
+	plcConfig.Endpoint = server.Endpoint()
+
+	cfg := &config.Config{PLCs: map[string]config.PLCConfig{"LINE1": plcConfig}, Tags: tags}
+	driver, err := newOPCUABuilder(cfg).build("LINE1", plcConfig)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if err := driver.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(driver.Disconnect)
+	return driver
+}
+
+func opcuaTag(node opcua.NodeID, dataType string) config.TagConfig {
+	return config.TagConfig{PLC: "LINE1", Type: dataType, Address: node.String()}
+}
+
+// sampleOf возвращает прочитанное значение ряда как database.Sample
+func sampleOf(t *testing.T, values map[string]interface{}, series string) database.Sample {
+	t.Helper()
+	value, ok := values[series]
+	if !ok {
+		t.Fatalf("ряд %s не прочитан: %v", series, values)
+	}
+	sample, ok := value.(database.Sample)
+	if !ok {
+		t.Fatalf("ряд %s: %T вместо database.Sample", series, value)
+	}
+	return sample
+}
+
+func TestOPCUAReadPoll(t *testing.T) {
+	server := startOPCUAServer(t)
+	sourceTime := time.Date(2026, 3, 1, 8, 30, 0, 123456700, time.UTC)
+	server.SetValue(speedNode, opcua.DataValue{Value: float64(1500), SourceTimestamp: sourceTime})
+
+	tags := map[string]config.TagConfig{
+		"Speed":       opcuaTag(speedNode, "LREAL"),
+		"Temps[1..2]": opcuaTag(tempsNode, "REAL"),
+		"Missing":     opcuaTag(opcua.StringNodeID(2, "Line1.Missing"), "REAL"),
+	}
+	driver := newOPCUATestDriver(t, server, config.PLCConfig{}, tags)
+
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	speed := sampleOf(t, values, "Speed")
+	if speed.Value != float64(1500) || speed.Quality != database.QualityGood {
+		t.Errorf("Speed = %v (%s), ожидалось 1500 (good)", speed.Value, speed.Quality)
+	}
+	if !speed.Timestamp.Equal(sourceTime) {
+		t.Errorf("метка Speed %v, ожидалась метка источника %v", speed.Timestamp, sourceTime)
+	}
+
+	// Элементы массива узла раскладываются по рядам из диапазона тега
+	for series, want := range map[string]float32{"Temps[1]": 11, "Temps[2]": 12} {
+		if sample := sampleOf(t, values, series); sample.Value != want {
+			t.Errorf("%s = %v, ожидалось %v", series, sample.Value, want)
+		}
+	}
+	for _, series := range []string{"Temps", "Temps[0]", "Temps[3]"} {
+		if _, ok := values[series]; ok {
+			t.Errorf("лишний ряд %s", series)
+		}
+	}
+
+	if missing := sampleOf(t, values, "Missing"); missing.Quality != database.QualityConfigError {
+		t.Errorf("качество неизвестного узла %s, ожидалось %s", missing.Quality, database.QualityConfigError)
+	}
+
+	// Неизменившееся значение возвращается снова с прежней меткой источника
+	values, _, err = driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if again := sampleOf(t, values, "Speed"); again != speed {
+		t.Errorf("повторное чтение Speed %+v, ожидалось %+v", again, speed)
+	}
+}
+
+func TestOPCUAReadBadSensorFailure(t *testing.T) {
+	server := startOPCUAServer(t)
+	server.SetValue(speedNode, opcua.DataValue{Value: float64(0), Status: opcua.StatusBadSensorFailure})
+
+	tags := map[string]config.TagConfig{"Speed": opcuaTag(speedNode, "LREAL")}
+	driver := newOPCUATestDriver(t, server, config.PLCConfig{}, tags)
+
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if speed := sampleOf(t, values, "Speed"); speed.Quality != database.QualityBad {
+		t.Errorf("качество %s, ожидалось %s", speed.Quality, database.QualityBad)
+	}
+}
+
+func TestOPCUAReadSubscribe(t *testing.T) {
+	server := startOPCUAServer(t)
+	tags := map[string]config.TagConfig{
+		"Speed":  opcuaTag(speedNode, "LREAL"),
+		"Levels": {PLC: "LINE1", Type: "REAL", Address: tempsNode.String(), Elements: 4},
+	}
+	plcConfig := config.PLCConfig{Subscribe: true, PublishInterval: 20 * time.Millisecond}
+	driver := newOPCUATestDriver(t, server, plcConfig, tags)
+
+	// Первое чтение создаёт подписку; до уведомлений значения читаются запросом
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if speed := sampleOf(t, values, "Speed"); speed.Value != float64(1450) {
+		t.Errorf("Speed = %v, ожидалось 1450", speed.Value)
+	}
+	if levels := sampleOf(t, values, "Levels[3]"); levels.Value != float32(13) {
+		t.Errorf("Levels[3] = %v, ожидалось 13", levels.Value)
+	}
+
+	sourceTime := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	server.SetValue(speedNode, opcua.DataValue{Value: float64(1600), SourceTimestamp: sourceTime})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		values, _, err := driver.Read(context.Background(), tags)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if value, ok := values["Speed"]; ok {
+			speed := value.(database.Sample)
+			if speed.Value == float64(1600) {
+				if !speed.Timestamp.Equal(sourceTime) {
+					t.Errorf("метка Speed %v, ожидалась метка источника %v", speed.Timestamp, sourceTime)
+				}
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("уведомление подписки не получено")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOPCUAWriteRoundTrip(t *testing.T) {
+	server := startOPCUAServer(t)
+	tags := map[string]config.TagConfig{
+		"Setpoint": {PLC: "LINE1", Type: "REAL", Address: setpointNode.String(), Writable: true},
+	}
+	driver := newOPCUATestDriver(t, server, config.PLCConfig{}, tags)
+
+	if err := driver.Write(context.Background(), tags, map[string]interface{}{"Setpoint": float32(42.5)}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := server.Value(setpointNode).Value; got != float32(42.5) {
+		t.Errorf("значение на сервере %v, ожидалось 42.5", got)
+	}
+
+	values, _, err := driver.Read(context.Background(), tags)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if setpoint := sampleOf(t, values, "Setpoint"); setpoint.Value != float32(42.5) {
+		t.Errorf("Setpoint = %v, записано 42.5", setpoint.Value)
+	}
+
+	// Значение другого типа сервер отклоняет
+	if err := driver.Write(context.Background(), tags, map[string]interface{}{"Setpoint": float64(1)}); err == nil {
+		t.Errorf("запись LREAL в переменную REAL без ошибки")
+	}
+}
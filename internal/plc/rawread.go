@@ -0,0 +1,206 @@
+package plc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+
+	"github.com/danomagnum/gologix"
+)
+
+// Сегменты символьного пути CIP
+const (
+	segmentExtendedSymbol = 0x91
+	segmentElement8       = 0x28
+	segmentElement16      = 0x29
+	segmentElement32      = 0x2A
+)
+
+// buildSymbolicPath кодирует имя тега (Program:Main.Tag.Member[1,2]) в символьный путь CIP
+func buildSymbolicPath(tag string) ([]byte, error) {
+	var path bytes.Buffer
+
+	for _, part := range strings.Split(tag, ".") {
+		name := part
+		var indexes []string
+		if open := strings.Index(part, "["); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("некорректный индекс в имени тега %s", tag)
+			}
+			name = part[:open]
+			indexes = strings.Split(part[open+1:len(part)-1], ",")
+		}
+		if name == "" || len(name) > 255 {
+			return nil, fmt.Errorf("некорректное имя тега %s", tag)
+		}
+
+		path.WriteByte(segmentExtendedSymbol)
+		path.WriteByte(byte(len(name)))
+		path.WriteString(name)
+		if len(name)%2 == 1 {
+			path.WriteByte(0) // Путь выравнивается по словам
+		}
+
+		for _, indexStr := range indexes {
+			index, err := strconv.ParseUint(strings.TrimSpace(indexStr), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("некорректный индекс в имени тега %s: %w", tag, err)
+			}
+			switch {
+			case index < 1<<8:
+				path.Write([]byte{segmentElement8, byte(index)})
+			case index < 1<<16:
+				path.Write([]byte{segmentElement16, 0})
+				binary.Write(&path, binary.LittleEndian, uint16(index))
+			default:
+				path.Write([]byte{segmentElement32, 0})
+				binary.Write(&path, binary.LittleEndian, uint32(index))
+			}
+		}
+	}
+
+	return path.Bytes(), nil
+}
+
+// Коды типов CIP, которых нет в реестре атомарных типов
+const (
+	cipTypeDWORD  = 0xD3   // Упакованный BOOL-массив
+	cipTypeStruct = 0x02A0 // Структура: за кодом следует дескриптор шаблона
+)
+
+// readRaw читает тег сервисом Read Tag Fragmented и возвращает код типа из
+// ответа контроллера и сырые данные. Ответ собирается из фрагментов, поэтому
+// размер массива не ограничен размером соединения. Используется для массивов
+// и для типов, которые gologix не декодирует (ULINT).
+func (d *logixDriver) readRaw(tag string, elements uint16) (uint16, []byte, error) {
+	path, err := buildSymbolicPath(tag)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var (
+		cipType uint16
+		data    []byte
+		offset  uint32
+	)
+	for {
+		request := make([]byte, 6)
+		binary.LittleEndian.PutUint16(request[0:], elements)
+		binary.LittleEndian.PutUint32(request[2:], offset)
+
+		item, err := d.session.client.GenericCIPMessage(gologix.CIPService_FragRead, path, request)
+		partial := false
+		if err != nil {
+			// Статус 0x06 (Partial Transfer) означает, что за фрагментом следуют ещё данные
+			if item == nil || !isPartialTransfer(item) {
+				return 0, nil, fmt.Errorf("ошибка чтения тега %s: %w", tag, err)
+			}
+			partial = true
+		}
+
+		cipType, err = item.Uint16()
+		if err != nil {
+			return 0, nil, fmt.Errorf("ошибка разбора ответа для тега %s: %w", tag, err)
+		}
+		if cipType == cipTypeStruct {
+			// Дескриптор шаблона повторяется в каждом фрагменте
+			if _, err := item.Uint16(); err != nil {
+				return 0, nil, fmt.Errorf("ошибка разбора ответа для тега %s: %w", tag, err)
+			}
+		}
+
+		chunk := item.Rest()
+		data = append(data, chunk...)
+		if !partial {
+			return cipType, data, nil
+		}
+		if len(chunk) == 0 {
+			return 0, nil, fmt.Errorf("пустой фрагмент при чтении тега %s", tag)
+		}
+		offset += uint32(len(chunk))
+	}
+}
+
+// isPartialTransfer проверяет статус ответа и оставляет позицию item
+// на начале данных, как это делает GenericCIPMessage
+func isPartialTransfer(item *gologix.CIPItem) bool {
+	item.Reset()
+	for i := 0; i < 2; i++ { // Счётчик последовательности и код сервиса
+		if _, err := item.Uint16(); err != nil {
+			return false
+		}
+	}
+	status, err := item.Uint16()
+	if err != nil {
+		return false
+	}
+	return gologix.CIPStatus(status&0xFF) == gologix.CIPStatus_PartialTransfer && status>>8 == 0
+}
+
+// readAtomic читает один элемент атомарного типа в обход декодера gologix
+func (d *logixDriver) readAtomic(tag string, dataType datatype.Type) (interface{}, error) {
+	values, err := d.readElements(tag, 1, dataType)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// readElements читает count элементов атомарного типа начиная с тега tag
+// (например, Temps[4]) и разбирает их по реестру типов
+func (d *logixDriver) readElements(tag string, count int, dataType datatype.Type) ([]interface{}, error) {
+	if count < 1 || count > 0xFFFF {
+		return nil, fmt.Errorf("некорректное число элементов для тега %s: %d", tag, count)
+	}
+
+	cipType, data, err := d.readRaw(tag, uint16(count))
+	if err != nil {
+		return nil, err
+	}
+	if cipType != uint16(dataType.Code) {
+		return nil, fmt.Errorf("тег %s имеет тип 0x%X, в конфигурации указан %s", tag, cipType, dataType.Name)
+	}
+	if len(data) < count*dataType.Size {
+		return nil, fmt.Errorf("короткий ответ для тега %s: %d байт вместо %d", tag, len(data), count*dataType.Size)
+	}
+
+	values := make([]interface{}, count)
+	for i := range values {
+		values[i] = dataType.Decode(data[i*dataType.Size:])
+	}
+	return values, nil
+}
+
+// readBoolArray читает элементы BOOL-массива. Контроллер хранит такие массивы
+// упакованными в DWORD, поэтому индекс в запросе — номер слова, а нужные биты
+// выделяются из ответа.
+func (d *logixDriver) readBoolArray(spec config.ArraySpec) ([]interface{}, error) {
+	firstWord := spec.Start / 32
+	firstBit := spec.Start % 32
+	words := (firstBit + spec.Count + 31) / 32
+
+	tag := fmt.Sprintf("%s[%d]", spec.Base, firstWord)
+	cipType, data, err := d.readRaw(tag, uint16(words))
+	if err != nil {
+		return nil, err
+	}
+	if cipType != cipTypeDWORD {
+		return nil, fmt.Errorf("тег %s имеет тип 0x%X, ожидался BOOL-массив", spec.Base, cipType)
+	}
+	if len(data) < words*4 {
+		return nil, fmt.Errorf("короткий ответ для тега %s: %d байт вместо %d", spec.Base, len(data), words*4)
+	}
+
+	values := make([]interface{}, spec.Count)
+	for i := range values {
+		bit := firstBit + i
+		word := binary.LittleEndian.Uint32(data[(bit/32)*4:])
+		values[i] = word&(1<<(bit%32)) != 0
+	}
+	return values, nil
+}
@@ -0,0 +1,243 @@
+package plc
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"plc_tsdb/internal/config"
+
+	"github.com/danomagnum/gologix"
+)
+
+// session соединение CIP с одним процессором (host + маршрут). Записи plcs,
+// ведущие к одному процессору, используют общую сессию, чтобы не тратить
+// соединения сетевого модуля.
+//
+// Если процессоров за устройством больше предела соединений, сессии
+// пользуются соединениями по очереди: сессия без свободного места
+// «припаркована» и открывает соединение при следующем обмене, дождавшись
+// места, а занявшая место сессия освобождает его после обмена, если
+// его ждут другие.
+type session struct {
+	client  *gologix.Client
+	limiter *hostLimiter // nil — число соединений к host не ограничено
+
+	io            chan struct{}       // Сериализует подключение и обмен через client, см. lock
+	socketTimeout time.Duration       // Таймаут сокета gologix без учёта дедлайна
+	users         map[string]struct{} // Подключённые PLCClient (по имени), под lock
+	holdsSlot     bool                // Сессия занимает место в limiter, под lock
+	parked        atomic.Bool         // Пользователи подключены, соединение закрыто до обмена
+
+	// Описания структур; обращение под lock, сбрасываются при подключении
+	structLayouts map[string][]structMember
+	tagsListed    bool // Список тегов контроллера уже получен
+}
+
+// sessionKey возвращает ключ сессии: host и маршрут без пробелов и скобок
+func sessionKey(plcConfig config.PLCConfig) string {
+	path := strings.NewReplacer(" ", "", "[", "", "]", "").Replace(plcConfig.CIPPath())
+	return strings.ToLower(plcConfig.Host) + "|" + path
+}
+
+func newSession(plcConfig config.PLCConfig, logger gologix.LoggerInterface, limiter *hostLimiter) (*session, error) {
+	client, err := newGologixClient(plcConfig, logger)
+
+	// Переподключением управляет супервизор, а не gologix при каждом чтении
+	client.AutoConnect = false
+
+	return &session{
+		client:        client,
+		limiter:       limiter,
+		io:            make(chan struct{}, 1),
+		socketTimeout: client.SocketTimeout,
+		users:         make(map[string]struct{}),
+		structLayouts: make(map[string][]structMember),
+	}, err
+}
+
+// lock захватывает сессию для обмена с учётом ctx. Таймаут сокета gologix
+// ограничивается оставшимся до дедлайна временем, чтобы зависший ПЛК
+// не держал цикл опроса дольше таймаута.
+// Припаркованная сессия ждёт места в limiter и открывает соединение.
+func (s *session) lock(ctx context.Context) error {
+	select {
+	case s.io <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.client.SocketTimeout = s.socketTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			<-s.io
+			return context.DeadlineExceeded
+		}
+		if remaining < s.socketTimeout {
+			s.client.SocketTimeout = remaining
+		}
+	}
+
+	if err := s.resume(ctx); err != nil {
+		<-s.io
+		return err
+	}
+	return nil
+}
+
+// unlock освобождает сессию. Если места в limiter ждут другие сессии,
+// соединение закрывается до следующего обмена.
+func (s *session) unlock() {
+	if s.holdsSlot && len(s.users) > 0 && s.client.Connected() && s.limiter.contended() {
+		s.client.Disconnect()
+		s.limiter.release()
+		s.holdsSlot = false
+		s.parked.Store(true)
+	}
+	<-s.io
+}
+
+// resume открывает соединение припаркованной сессии. При ошибке сессия
+// считается отключённой, и её переподключает супервизор. Вызывается под io.
+func (s *session) resume(ctx context.Context) error {
+	if !s.parked.Load() {
+		return nil
+	}
+	if err := s.limiter.acquire(ctx); err != nil {
+		return err
+	}
+	if err := s.client.Connect(); err != nil {
+		s.limiter.release()
+		s.parked.Store(false)
+		return err
+	}
+	s.holdsSlot = true
+	s.parked.Store(false)
+	return nil
+}
+
+// connected сообщает, что сессия подключена или ждёт очереди на соединение
+func (s *session) connected() bool {
+	return s.parked.Load() || s.client.Connected()
+}
+
+// connect подключает сессию для пользователя owner. Если сессия уже
+// подключена другим пользователем, она используется повторно. Если мест
+// в limiter нет, сессия паркуется до первого обмена.
+func (s *session) connect(owner string) error {
+	s.io <- struct{}{}
+	defer func() { <-s.io }()
+
+	delete(s.users, owner) // Прежнее подключение owner уже потеряно
+	if s.connected() {
+		if len(s.users) > 0 {
+			s.users[owner] = struct{}{}
+			return nil
+		}
+		// Сессия могла остаться после сбоя чтения — закрываем её перед новой попыткой
+		if s.client.Connected() {
+			s.client.Disconnect()
+		}
+		s.parked.Store(false)
+	}
+
+	// После переподключения программа в контроллере могла измениться
+	s.structLayouts = make(map[string][]structMember)
+	s.tagsListed = false
+
+	if !s.holdsSlot {
+		if !s.limiter.tryAcquire() {
+			s.parked.Store(true)
+			s.users[owner] = struct{}{}
+			return nil
+		}
+		s.holdsSlot = true
+	}
+
+	if err := s.client.Connect(); err != nil {
+		s.limiter.release()
+		s.holdsSlot = false
+		return err
+	}
+	s.users[owner] = struct{}{}
+	return nil
+}
+
+// disconnect отключает пользователя owner. Соединение закрывается,
+// когда сессией больше никто не пользуется.
+func (s *session) disconnect(owner string) {
+	s.io <- struct{}{}
+	defer func() { <-s.io }()
+
+	delete(s.users, owner)
+	if len(s.users) > 0 {
+		return
+	}
+	s.parked.Store(false)
+	if s.client.Connected() {
+		s.client.Disconnect()
+	}
+	if s.holdsSlot {
+		s.limiter.release()
+		s.holdsSlot = false
+	}
+}
+
+// hostLimiter ограничивает число одновременных сессий к одному устройству.
+// Сессии, которым не хватило места, ждут его в acquire.
+type hostLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int32 // Число сессий, ждущих места
+}
+
+func newHostLimiter(max int) *hostLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &hostLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire занимает место, ожидая его не дольше ctx
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	if l == nil || l.tryAcquire() {
+		return nil
+	}
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// contended сообщает, что места ждут другие сессии
+func (l *hostLimiter) contended() bool {
+	return l != nil && l.waiting.Load() > 0
+}
+
+// tryAcquire занимает место без ожидания; false — мест нет
+func (l *hostLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *hostLimiter) release() {
+	if l == nil {
+		return
+	}
+	select {
+	case <-l.slots:
+	default:
+	}
+}
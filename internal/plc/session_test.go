@@ -0,0 +1,49 @@
+package plc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterQueues(t *testing.T) {
+	limiter := newHostLimiter(1)
+	if !limiter.tryAcquire() {
+		t.Fatalf("tryAcquire: место не занято")
+	}
+	if limiter.tryAcquire() {
+		t.Fatalf("tryAcquire: занято место сверх предела")
+	}
+
+	// Вторая сессия ждёт места, а не получает отказ
+	acquired := make(chan error, 1)
+	go func() { acquired <- limiter.acquire(context.Background()) }()
+	for !limiter.contended() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquire вернулся при занятом месте: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	limiter.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("acquire не получил освободившееся место")
+	}
+	if limiter.contended() {
+		t.Errorf("contended после получения места")
+	}
+
+	// Ожидание ограничено ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("acquire = %v, ожидалось DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,155 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"plc_tsdb/internal/browse"
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/sim"
+)
+
+// simBuilder создаёт имитируемые ПЛК: значения тегов дают генераторы из
+// поля sim, обмена по сети нет
+type simBuilder struct{}
+
+func newSimBuilder(cfg *config.Config) driverBuilder {
+	return simBuilder{}
+}
+
+func (simBuilder) build(plcName string, plcConfig config.PLCConfig) (Driver, error) {
+	return &simDriver{
+		name:       plcName,
+		seed:       plcConfig.Seed,
+		generators: make(map[string]*sim.Generator),
+		written:    make(map[string]float64),
+	}, nil
+}
+
+// simDriver имитируемый ПЛК. Генератор ряда создаётся при первом чтении,
+// зерно выводится из seed ПЛК и имени ряда. Записанное значение ряда
+// заменяет генератор, как уставка в настоящем контроллере.
+type simDriver struct {
+	name string
+	seed int64
+
+	mu         sync.Mutex // Защищает поля ниже
+	connected  bool
+	generators map[string]*sim.Generator // Генераторы по рядам
+	written    map[string]float64        // Записанные значения по рядам
+}
+
+func (d *simDriver) Connect() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connected = true
+	return nil
+}
+
+func (d *simDriver) Disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connected = false
+}
+
+func (d *simDriver) Connected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.connected
+}
+
+func (d *simDriver) Address() string {
+	return fmt.Sprintf("sim (seed %d)", d.seed)
+}
+
+// Read возвращает значения генераторов на текущий момент, приведённые к
+// типам тегов. Ряды в отказе dropout пропускаются, как непрочитанные теги.
+func (d *simDriver) Read(ctx context.Context, tags map[string]config.TagConfig) (map[string]interface{}, Acquisition, error) {
+	start := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make(map[string]interface{})
+	for tagName, tagConfig := range tags {
+		dataType, ok := datatype.Lookup(tagConfig.Type)
+		if !ok || tagConfig.Sim == nil {
+			logging.Error("Тег не может быть имитирован", "PLC", d.name, "TagName", tagName, "type", tagConfig.Type)
+			continue
+		}
+		for _, series := range config.TagSeries(tagName, tagConfig) {
+			value, ok := d.written[series]
+			if !ok {
+				value, ok = d.generator(series, *tagConfig.Sim, start).Next(start)
+			}
+			if !ok {
+				logging.Debug("Имитация пропадания значения", "PLC", d.name, "TagName", series)
+				continue
+			}
+			result[series] = simValue(dataType, value)
+		}
+	}
+	return result, Acquisition{Time: start, Latency: time.Since(start)}, nil
+}
+
+// generator возвращает генератор ряда, создавая его при первом обращении.
+// Вызывается под d.mu.
+func (d *simDriver) generator(series string, cfg config.SimConfig, now time.Time) *sim.Generator {
+	g, ok := d.generators[series]
+	if !ok {
+		seed := sim.Seed(d.seed, series)
+		if cfg.Seed != nil {
+			seed = sim.Seed(*cfg.Seed, series)
+		}
+		g = sim.New(cfg, seed, now)
+		d.generators[series] = g
+	}
+	return g
+}
+
+// simValue приводит значение генератора к типу тега: целые округляются,
+// выход за диапазон типа ограничивается его границами
+func simValue(dataType datatype.Type, value float64) interface{} {
+	if dataType.Name != "REAL" && dataType.Name != "LREAL" {
+		value = math.Round(value)
+	}
+	value = math.Max(dataType.Min, math.Min(dataType.Max, value))
+	converted, err := dataType.FromFloat64(value)
+	if err != nil {
+		return dataType.Zero()
+	}
+	return converted
+}
+
+// Write запоминает значения тегов: дальше тег читается с записанным значением.
+// Значение одно на тег, поэтому массив записать нельзя: элемент-уставка
+// задаётся отдельным тегом.
+func (d *simDriver) Write(ctx context.Context, tags map[string]config.TagConfig, values map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for tagName, value := range values {
+		if _, isArray, _ := config.ParseArrayTag(tagName, tags[tagName]); isArray {
+			return fmt.Errorf("тег %s: запись массива не поддерживается драйвером sim", tagName)
+		}
+		numericValue, _, ok := datatype.ToFloat64(value)
+		if !ok {
+			return fmt.Errorf("тег %s: неподдерживаемое значение %v", tagName, value)
+		}
+		d.written[tagName] = numericValue
+	}
+	return nil
+}
+
+// Browse недоступен: теги имитируемого ПЛК задаются в конфигурации
+func (d *simDriver) Browse(ctx context.Context) ([]browse.Tag, error) {
+	return nil, fmt.Errorf("драйвер sim не поддерживает просмотр тегов: теги и генераторы задаются в конфигурации")
+}
+
+// Status возвращает пустой набор: у имитации нет диагностики контроллера
+func (d *simDriver) Status(ctx context.Context) (map[string]interface{}, Acquisition, error) {
+	return map[string]interface{}{}, Acquisition{}, nil
+}
@@ -0,0 +1,213 @@
+package plc
+
+import (
+	"fmt"
+	"strings"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+
+	"github.com/danomagnum/gologix"
+)
+
+// Признак массива в поле типа члена шаблона (биты 13-14 — число измерений)
+const templateMemberArrayMask = 0x6000
+
+// structMember атомарный член структуры после разворачивания вложенных UDT и массивов
+type structMember struct {
+	Name   string // Путь относительно тега: Speed, PID.PV, Temps[3]
+	Type   datatype.Type
+	Offset int // Смещение в данных структуры, байт
+	Bit    int // Номер бита для BOOL-членов
+}
+
+// structLayout возвращает развёрнутые атомарные члены структуры тега.
+// Описание шаблона берётся из списка тегов контроллера и кэшируется до переподключения.
+func (d *logixDriver) structLayout(tagName string) ([]structMember, error) {
+	if members, ok := d.session.structLayouts[tagName]; ok {
+		return members, nil
+	}
+
+	desc, err := d.templateFor(tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []structMember
+	flattenUDT(desc, "", 0, &members)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("в структуре %s (%s) нет атомарных членов", tagName, desc.Name)
+	}
+
+	d.session.structLayouts[tagName] = members
+	logging.Info("Получено описание структуры", "PLC", d.name, "tag", tagName, "type", desc.Name, "членов", len(members))
+	return members, nil
+}
+
+// templateFor находит описание UDT для тега. Путь вида Pump_A.PID или
+// Motors[2].Drive проходится по вложенным шаблонам.
+func (d *logixDriver) templateFor(tagName string) (*gologix.UDTDescriptor, error) {
+	if !d.session.tagsListed {
+		if err := d.session.client.ListAllTags(0); err != nil {
+			return nil, fmt.Errorf("ошибка получения списка тегов: %w", err)
+		}
+		d.session.tagsListed = true
+	}
+
+	parts := strings.Split(tagName, ".")
+	// Программные теги: Program:Main.Tag — первые две части образуют имя
+	if strings.HasPrefix(strings.ToLower(parts[0]), "program:") && len(parts) > 1 {
+		parts = append([]string{parts[0] + "." + parts[1]}, parts[2:]...)
+	}
+
+	known, ok := d.session.client.KnownTags[strings.ToLower(stripIndex(parts[0]))]
+	if !ok {
+		return nil, fmt.Errorf("тег %s не найден в контроллере", tagName)
+	}
+	if known.UDT == nil {
+		return nil, fmt.Errorf("тег %s не является структурой", tagName)
+	}
+
+	desc := known.UDT
+	for _, part := range parts[1:] {
+		var next *gologix.UDTDescriptor
+		for i := range desc.Members {
+			if strings.EqualFold(desc.Members[i].Name, stripIndex(part)) {
+				next = desc.Members[i].UDT
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("член %s тега %s не найден или не является структурой", part, tagName)
+		}
+		desc = next
+	}
+	return desc, nil
+}
+
+// stripIndex отбрасывает индекс массива: Motors[2] -> Motors
+func stripIndex(name string) string {
+	if i := strings.Index(name, "["); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// flattenUDT разворачивает описание UDT в список атомарных членов.
+// Скрытые служебные члены и неподдерживаемые типы (строки, DWORD) пропускаются.
+func flattenUDT(desc *gologix.UDTDescriptor, prefix string, base int, out *[]structMember) {
+	for _, m := range desc.Members {
+		if strings.HasPrefix(m.Name, "ZZZZZZZZZZ") || strings.HasPrefix(m.Name, "__") {
+			continue // Скрытые SINT-носители BOOL-членов и системные поля
+		}
+
+		name := m.Name
+		if prefix != "" {
+			name = prefix + "." + m.Name
+		}
+		offset := base + int(m.Info.Offset)
+		isArray := m.Info.Type&templateMemberArrayMask != 0
+		count := 1
+		if isArray {
+			count = int(m.Info.Info)
+		}
+
+		if m.UDT != nil {
+			for i := 0; i < count; i++ {
+				elementName := name
+				if isArray {
+					elementName = fmt.Sprintf("%s[%d]", name, i)
+				}
+				flattenUDT(m.UDT, elementName, offset+i*int(m.UDT.Info.SizeBytes), out)
+			}
+			continue
+		}
+
+		dataType, ok := datatype.LookupCode(uint8(m.Info.CIPType()))
+		if !ok {
+			continue
+		}
+
+		if dataType.Name == "BOOL" && !isArray {
+			// Для BOOL-члена поле Info хранит номер бита в байте-носителе
+			*out = append(*out, structMember{Name: name, Type: dataType, Offset: offset, Bit: int(m.Info.Info)})
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			elementName := name
+			if isArray {
+				elementName = fmt.Sprintf("%s[%d]", name, i)
+			}
+			*out = append(*out, structMember{Name: elementName, Type: dataType, Offset: offset + i*dataType.Size})
+		}
+	}
+}
+
+// selectMembers оставляет запрошенные члены. "*" выбирает все; имя вложенной
+// структуры или массива выбирает все его атомарные члены.
+func selectMembers(tagName string, members []structMember, wanted []string) ([]structMember, error) {
+	for _, w := range wanted {
+		if w == "*" {
+			return members, nil
+		}
+	}
+
+	var selected []structMember
+	for _, w := range wanted {
+		found := false
+		lw := strings.ToLower(w)
+		for _, m := range members {
+			lm := strings.ToLower(m.Name)
+			if lm == lw || strings.HasPrefix(lm, lw+".") || strings.HasPrefix(lm, lw+"[") {
+				selected = append(selected, m)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("член %s не найден в структуре %s", w, tagName)
+		}
+	}
+	return selected, nil
+}
+
+// readStruct читает структуру одним запросом и возвращает выбранные члены
+// под именами рядов вида Pump_A.Speed
+func (d *logixDriver) readStruct(tagName string, tagConfig config.TagConfig) (map[string]interface{}, error) {
+	layout, err := d.structLayout(tagName)
+	if err != nil {
+		return nil, err
+	}
+	members, err := selectMembers(tagName, layout, tagConfig.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	cipType, data, err := d.readRaw(tagName, 1)
+	if err != nil {
+		return nil, err
+	}
+	if cipType != cipTypeStruct {
+		return nil, fmt.Errorf("тег %s имеет тип 0x%X, а не структуру", tagName, cipType)
+	}
+
+	result := make(map[string]interface{}, len(members))
+	for _, m := range members {
+		if m.Offset+m.Type.Size > len(data) {
+			// Шаблон в контроллере изменился — описание перечитаем при следующем цикле
+			delete(d.session.structLayouts, tagName)
+			d.session.tagsListed = false
+			return nil, fmt.Errorf("член %s выходит за пределы данных структуры %s", m.Name, tagName)
+		}
+
+		var value interface{}
+		if m.Type.Name == "BOOL" {
+			value = data[m.Offset]&(1<<uint(m.Bit)) != 0
+		} else {
+			value = m.Type.Decode(data[m.Offset:])
+		}
+		result[tagName+"."+m.Name] = value
+	}
+	return result, nil
+}
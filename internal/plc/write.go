@@ -0,0 +1,121 @@
+package plc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/datatype"
+	"plc_tsdb/internal/logging"
+)
+
+// WriteAuditor сохраняет журнал попыток записи в ПЛК.
+// oldValue — значение до записи (NaN, если прочитать не удалось),
+// result — "ok" или текст ошибки.
+type WriteAuditor interface {
+	AuditWrite(timestamp time.Time, user, tagName string, oldValue, newValue float64, result string) error
+}
+
+// SetAuditor задаёт журнал попыток записи. Без него WriteTags отказывает:
+// запись в ПЛК без следа в журнале не допускается.
+func (m *PLCManager) SetAuditor(auditor WriteAuditor) {
+	m.auditor = auditor
+}
+
+// WriteTags записывает значения тегов (в инженерных единицах) в ПЛК от имени
+// user. Записать можно только теги с writable: true и значения в пределах
+// write_min..write_max. Каждая попытка, в том числе отклонённая, попадает в
+// журнал. Возвращает ошибки по тегам; успешно записанных тегов в ней нет.
+func (m *PLCManager) WriteTags(ctx context.Context, user string, values map[string]float64) map[string]error {
+	errs := make(map[string]error)
+	if m.auditor == nil {
+		for tagName := range values {
+			errs[tagName] = fmt.Errorf("журнал записи не настроен")
+		}
+		return errs
+	}
+
+	for tagName, value := range values {
+		oldValue, err := m.writeTag(ctx, tagName, value)
+		result := "ok"
+		if err != nil {
+			result = err.Error()
+			errs[tagName] = err
+		}
+
+		auditName := tagName
+		if tagConfig, exists := m.config.Tags[tagName]; exists {
+			auditName = fmt.Sprintf("%s/%s", tagConfig.PLC, tagName)
+		}
+		if auditErr := m.auditor.AuditWrite(time.Now(), user, auditName, oldValue, value, result); auditErr != nil {
+			logging.Error("Ошибка записи в журнал записи тегов", "tag", auditName, "error", auditErr)
+		}
+
+		if err != nil {
+			logging.Warn("Запись тега отклонена", "tag", auditName, "user", user, "value", value, "error", err)
+		} else {
+			logging.Info("Тег записан", "tag", auditName, "user", user, "old", oldValue, "new", value)
+		}
+	}
+	return errs
+}
+
+// writeTag проверяет разрешения и записывает одно значение.
+// Возвращает значение тега до записи или NaN.
+func (m *PLCManager) writeTag(ctx context.Context, tagName string, value float64) (float64, error) {
+	tagConfig, exists := m.config.Tags[tagName]
+	if !exists {
+		return math.NaN(), fmt.Errorf("тег %s не найден в конфигурации", tagName)
+	}
+	if !tagConfig.Writable {
+		return math.NaN(), fmt.Errorf("тег %s недоступен для записи", tagName)
+	}
+	if err := tagConfig.CheckWriteLimits(value); err != nil {
+		return math.NaN(), err
+	}
+
+	client, exists := m.clients[tagConfig.PLC]
+	if !exists || !client.connected() {
+		return math.NaN(), fmt.Errorf("ПЛК %s не подключен", tagConfig.PLC)
+	}
+
+	return client.writeTag(ctx, tagName, tagConfig, value)
+}
+
+// writeTag читает текущее значение тега и записывает новое.
+// Значение переводится из инженерных единиц в сырые по scale_factor.
+func (c *PLCClient) writeTag(ctx context.Context, tagName string, tagConfig config.TagConfig, value float64) (float64, error) {
+	dataType, ok := datatype.Lookup(tagConfig.Type)
+	if !ok {
+		return math.NaN(), fmt.Errorf("неподдерживаемый тип тега %s: %s", tagName, tagConfig.Type)
+	}
+
+	raw := value
+	if tagConfig.ScaleFactor != 0 && tagConfig.ScaleFactor != 1.0 && dataType.Name != "BOOL" {
+		raw = value / tagConfig.ScaleFactor
+		if dataType.Name != "REAL" && dataType.Name != "LREAL" {
+			raw = math.Round(raw)
+		}
+	}
+	rawValue, err := dataType.FromFloat64(raw)
+	if err != nil {
+		return math.NaN(), err
+	}
+
+	oldValue := math.NaN()
+	if values, _, err := c.readTags(ctx, map[string]config.TagConfig{tagName: tagConfig}); err == nil {
+		if v, ok := values[tagName]; ok {
+			oldValue, _, _ = database.ToNumeric(v)
+		}
+	}
+
+	err = c.driver.Write(ctx, map[string]config.TagConfig{tagName: tagConfig}, map[string]interface{}{tagName: rawValue})
+	if err != nil {
+		c.checkReadError(err)
+		return oldValue, err
+	}
+	return oldValue, nil
+}
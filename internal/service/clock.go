@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/logging"
+)
+
+// defaultMaxDrift допустимое расхождение часов, если clock.max_drift не задан
+const defaultMaxDrift = time.Second
+
+// clockUser имя, от которого сборщик устанавливает часы ПЛК (в журнале записи)
+const clockUser = "collector"
+
+// clockSeries возвращает ряд, в который пишется смещение часов ПЛК
+// относительно часов хоста, в секундах (положительное — ПЛК спешит)
+func clockSeries(plcName string) string {
+	return fmt.Sprintf("%s/$clock/offset", plcName)
+}
+
+// checkClock записывает смещение часов ПЛК, предупреждает о расхождении
+// больше clock.max_drift и при clock.sync устанавливает часы ПЛК по хосту
+func (s *CollectorService) checkClock(plcName string) {
+	ctx, cancel := withTimeout(context.Background(), s.config.Polling.Timeout)
+	defer cancel()
+
+	reading, err := s.plcManager.ReadClock(ctx, plcName)
+	if err != nil {
+		logging.Debug("Часы ПЛК не прочитаны", "PLC", plcName, "error", err)
+		return
+	}
+
+	offset := reading.Offset()
+	s.enqueue(writeBatch{plcName: plcName, points: []database.Point{
+		{Tag: clockSeries(plcName), Timestamp: reading.At.Time, Value: offset.Seconds()},
+	}})
+
+	maxDrift := s.config.Clock.MaxDrift
+	if maxDrift <= 0 {
+		maxDrift = defaultMaxDrift
+	}
+	if offset <= maxDrift && offset >= -maxDrift {
+		return
+	}
+
+	logging.Warn("Часы ПЛК расходятся с часами хоста", "PLC", plcName, "смещение", offset.Round(time.Millisecond),
+		"max_drift", maxDrift, "обмен", reading.At.Latency.Round(time.Microsecond))
+	if s.config.Clock.Sync {
+		s.plcManager.SetClock(ctx, clockUser, plcName)
+	}
+}
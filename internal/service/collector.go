@@ -1,14 +1,20 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"plc_tsdb/internal/config"
 	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/datatype"
 	"plc_tsdb/internal/logging"
+	"plc_tsdb/internal/mqtt"
 	"plc_tsdb/internal/plc"
 )
 
@@ -17,8 +23,28 @@ type CollectorService struct {
 	dbClient   database.TSDBClient
 	config     *config.Config
 	stopChan   chan struct{}
+	queue      chan writeBatch       // Циклы опроса, ожидающие записи в БД
+	timers     map[string]*scanTimer // Статистика опроса по ПЛК и классам опроса, см. statsKey
+
+	mu           sync.Mutex
+	lastValues   map[string]interface{}   // Последние успешно прочитанные значения: PLC/тег -> значение
+	lastReported map[string]reportedValue // Последние записанные значения тегов с записью по исключению
+}
+
+// writeBatch результат одного цикла опроса ПЛК, ожидающий записи в БД
+type writeBatch struct {
+	plcName   string
+	scanClass string // Пусто — служебные ряды вне классов опроса
+	points    []database.Point
+
+	// Значения тегов с записью по исключению: последними записанными
+	// они становятся только после успешной записи
+	reported map[string]reportedValue
 }
 
+// defaultQueueSize размер очереди записи, если database.queue_size не задан
+const defaultQueueSize = 256
+
 func NewCollectorService(cfg *config.Config) (*CollectorService, error) {
 	plcManager := plc.NewPLCManager(cfg)
 
@@ -27,58 +53,340 @@ func NewCollectorService(cfg *config.Config) (*CollectorService, error) {
 		return nil, err
 	}
 
+	// Запись в ПЛК журналируется в ту же БД
+	if auditor, ok := dbClient.(plc.WriteAuditor); ok {
+		plcManager.SetAuditor(auditor)
+	}
+
+	queueSize := cfg.Database.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	// Каждый ПЛК опрашивается отдельно в каждом своём классе опроса
+	timers := make(map[string]*scanTimer)
+	for name, scanClass := range cfg.GetUsedScanClasses() {
+		for _, plcName := range plcManager.PLCNames() {
+			if len(cfg.GetTagsByPLCAndScanClass(plcName, name)) > 0 {
+				timers[statsKey(plcName, name)] = newScanTimer(plcName, name, scanClass.Interval)
+			}
+		}
+	}
+
 	return &CollectorService{
 		plcManager: plcManager,
 		dbClient:   dbClient,
 		config:     cfg,
 		stopChan:   make(chan struct{}),
+		queue:      make(chan writeBatch, queueSize),
+		timers:     timers,
+		lastValues: make(map[string]interface{}),
+
+		lastReported: make(map[string]reportedValue),
 	}, nil
 }
 
 func (s *CollectorService) Start() error {
-	if err := s.plcManager.Connect(); err != nil {
-		return err
-	}
+	s.plcManager.Connect()
 	defer s.plcManager.Disconnect()
 
-	logging.Info("Запуск сбора данных,", "интервал", s.config.Polling.Interval)
+	// Запись в БД идёт отдельно от опроса: медленная запись
+	// не сдвигает циклы опроса
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		s.runWriter()
+	}()
 
-	ticker := time.NewTicker(s.config.Polling.Interval)
-	defer ticker.Stop()
+	// Источники MQTT присылают значения сами и ставят их в ту же очередь
+	sources := make([]*mqtt.Source, 0, len(s.config.MQTT))
+	for name, mqttConfig := range s.config.MQTT {
+		source := mqtt.NewSource(name, mqttConfig, func(points []database.Point) {
+			s.enqueue(writeBatch{plcName: name, points: points})
+		})
+		source.Start()
+		sources = append(sources, source)
+	}
+
+	// Каждый ПЛК в каждом классе опроса опрашивается по своему таймеру,
+	// поэтому медленный или недоступный ПЛК не задерживает остальные
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, timer := range s.timers {
+		plcName, name := timer.stats.PLC, timer.stats.ScanClass
+		scanClass, _ := s.config.GetScanClass(name)
+		logging.Info("Запуск сбора данных,", "PLC", plcName, "класс", name, "интервал", scanClass.Interval)
+
+		wg.Add(1)
+		go func(plcName, name string, scanClass config.ScanClassConfig, timer *scanTimer) {
+			defer wg.Done()
+			s.runPoller(plcName, name, scanClass, timer, done)
+		}(plcName, name, scanClass, timer)
+	}
+
+	// Часы и диагностика контроллеров опрашиваются отдельно от тегов
+	for _, plcName := range s.plcManager.PLCNames() {
+		if interval := s.config.Clock.Interval; interval > 0 {
+			wg.Add(1)
+			go func(plcName string) {
+				defer wg.Done()
+				runEvery(interval, done, func() { s.checkClock(plcName) })
+			}(plcName)
+		}
+		if interval := s.config.Diagnostics.Interval; interval > 0 {
+			wg.Add(1)
+			go func(plcName string) {
+				defer wg.Done()
+				runEvery(interval, done, func() { s.collectDiagnostics(plcName) })
+			}(plcName)
+		}
+	}
+
+	statsInterval := s.config.Polling.StatsInterval
+	if statsInterval <= 0 {
+		statsInterval = defaultStatsInterval
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.logScanStats(statsInterval, done)
+	}()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	select {
+	case <-sigChan:
+		logging.Info("Получен сигнал остановки")
+	case <-s.stopChan:
+		logging.Info("Остановка по команде")
+	}
+
+	// Останавливаем опрос и источники, дописываем очередь и закрываем БД
+	close(done)
+	for _, source := range sources {
+		source.Stop()
+	}
+	wg.Wait()
+	close(s.queue)
+	<-writerDone
+	s.dbClient.Close()
+	return nil
+}
+
+// runPoller опрашивает теги одного ПЛК из одного класса опроса, пока не закрыт done
+func (s *CollectorService) runPoller(plcName, scanClass string, scanClassConfig config.ScanClassConfig, timer *scanTimer, done <-chan struct{}) {
+	if s.config.Polling.Align {
+		s.runAlignedPoller(plcName, scanClass, scanClassConfig, timer, done)
+		return
+	}
+
+	ticker := time.NewTicker(scanClassConfig.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case tick := <-ticker.C:
+			read := s.collectData(plcName, scanClass, scanClassConfig, time.Time{}, 0)
+			timer.recordCycle(tick, read, time.Since(tick))
+		case <-done:
+			return
+		}
+	}
+}
+
+// collectData выполняет один цикл опроса ПЛК и ставит результат в очередь записи.
+// Значения помечаются временем получения с ПЛК (серединой обмена), а если
+// задано время по расписанию scheduled — им; опоздание jitter тогда
+// записывается отдельным рядом (см. jitterSeries). Задержка обмена с
+// record_latency записывается рядом latencySeries с меткой времени получения.
+// Возвращает длительность чтения или -1, если ПЛК не опрашивался.
+func (s *CollectorService) collectData(plcName, scanClass string, scanClassConfig config.ScanClassConfig, scheduled time.Time, jitter time.Duration) time.Duration {
+	// Чтение ограничено таймаутом класса опроса
+	ctx, cancel := withTimeout(context.Background(), scanClassConfig.Timeout)
+	readStart := time.Now()
+	tags, acquisition, err := s.plcManager.ReadPLC(ctx, plcName, s.config.GetTagsByPLCAndScanClass(plcName, scanClass))
+	read := time.Since(readStart)
+	cancel()
+	if plc.IsBreakerOpen(err) {
+		read = -1
+		logging.Debug("ПЛК не опрашивается:", "PLC", plcName, "класс", scanClass, "Error", err)
+	} else if err != nil {
+		logging.Error("Ошибка чтения тегов:", "PLC", plcName, "класс", scanClass, "Error", err)
+	}
+	if tags == nil {
+		tags = make(map[string]interface{})
+	}
+
+	if bad := s.fillMissingTags(plcName, scanClass, tags); bad > 0 {
+		logging.Debug("Записаны значения с нехорошим качеством", "PLC", plcName, "кол-во тегов", bad)
+	}
+
+	// Без обмена с ПЛК (нет связи) значения с плохим качеством помечаются текущим временем
+	timestamp := acquisition.Time
+	if !scheduled.IsZero() {
+		timestamp = scheduled
+	} else if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	reported, suppressed := s.filterExceptions(plcName, scanClass, tags, timestamp)
+	if suppressed > 0 {
+		logging.Debug("Значения без изменений не записаны", "PLC", plcName, "класс", scanClass, "кол-во тегов", suppressed)
+	}
+
+	points := database.PointsAt(tags, timestamp)
+	if !scheduled.IsZero() {
+		points = append(points, database.Point{Tag: jitterSeries(plcName, scanClass), Timestamp: scheduled, Value: jitter.Seconds()})
+	}
+	if scanClassConfig.RecordLatency && !acquisition.Time.IsZero() {
+		points = append(points, database.Point{Tag: latencySeries(plcName, scanClass), Timestamp: acquisition.Time, Value: acquisition.Latency.Seconds()})
+	}
+	if len(points) == 0 {
+		return read
+	}
+
+	s.enqueue(writeBatch{plcName: plcName, scanClass: scanClass, points: points, reported: reported})
+	return read
+}
+
+// enqueue ставит значения в очередь записи; при переполнении они отбрасываются
+func (s *CollectorService) enqueue(batch writeBatch) {
+	select {
+	case s.queue <- batch:
+	default:
+		logging.Error("Очередь записи в TSDB переполнена, цикл опроса отброшен", "PLC", batch.plcName, "класс", batch.scanClass, "кол-во значений", len(batch.points))
+	}
+}
+
+// runWriter записывает циклы опроса из очереди в БД, пока очередь не закрыта
+func (s *CollectorService) runWriter() {
+	for batch := range s.queue {
+		ctx, cancel := withTimeout(context.Background(), s.config.GetWriteTimeout())
+		writeStart := time.Now()
+		err := s.dbClient.Write(ctx, batch.points)
+		if timer, ok := s.timers[statsKey(batch.plcName, batch.scanClass)]; ok {
+			timer.recordWrite(time.Since(writeStart))
+		}
+		cancel()
+		if err != nil {
+			logging.Error("Ошибка записи в TSDB^", "PLC", batch.plcName, "Error", err)
+			continue
+		}
+		s.commitReported(batch.reported)
+
+		logging.Debug("Записано успешно в TSDB:", "PLC", batch.plcName, "класс", batch.scanClass, "кол-во значений", len(batch.points), "время", batch.points[0].Timestamp)
+	}
+}
+
+// runEvery вызывает fn каждые interval, пока не закрыт done
+func runEvery(interval time.Duration, done <-chan struct{}, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
-			s.collectData()
-		case <-sigChan:
-			logging.Info("Получен сигнал остановки")
-			return nil
-		case <-s.stopChan:
-			logging.Info("Остановка по команде")
-			return nil
+			fn()
+		case <-done:
+			return
 		}
 	}
 }
 
-func (s *CollectorService) collectData() {
-	tags, err := s.plcManager.ReadAllTags()
-	if err != nil {
-		logging.Error("Ошибка чтения тегов:", "Error", err)
+// withTimeout как context.WithTimeout, но нулевой таймаут означает отсутствие дедлайна
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
 	}
+	return context.WithTimeout(parent, timeout)
+}
 
-	timestamp := time.Now()
-	if err := s.dbClient.Write(tags, timestamp); err != nil {
-		logging.Error("Ошибка записи в TSDB^", "Error", err)
-		return
+// fillMissingTags дополняет результат чтения значениями с плохим качеством
+// для каждого тега ПЛК из класса опроса, который не удалось прочитать в этом цикле.
+// Используется последнее известное значение, а если его нет — NaN.
+// Прочитанные значения вне инженерного диапазона помечаются QualityOutOfRange.
+// Возвращает число значений с нехорошим качеством.
+func (s *CollectorService) fillMissingTags(plcName, scanClass string, tags map[string]interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bad := 0
+	for tagName, tagConfig := range s.config.Tags {
+		if tagConfig.PLC != plcName || tagConfig.TagScanClass() != scanClass {
+			continue
+		}
+		quality := database.QualityCommFailure
+		if _, ok := datatype.Lookup(tagConfig.Type); !ok && !tagConfig.IsStruct() {
+			quality = database.QualityConfigError
+		}
+
+		for _, fullTagName := range s.tagSeries(tagName, tagConfig, tags) {
+			if value, ok := tags[fullTagName]; ok {
+				s.lastValues[fullTagName] = value
+
+				if numericValue, valueQuality, valid := database.ToNumeric(value); valid && valueQuality.IsGood() && !tagConfig.InRange(numericValue) {
+					tags[fullTagName] = database.Sample{Value: value, Quality: database.QualityOutOfRange}
+					bad++
+				}
+				continue
+			}
+
+			// Метка времени источника у прошлого значения не переносится:
+			// отсутствие значения фиксируется на время этого цикла
+			lastValue := s.lastValues[fullTagName]
+			if sample, isSample := lastValue.(database.Sample); isSample {
+				sample.Timestamp = time.Time{}
+				lastValue = sample
+			}
+			tags[fullTagName] = database.Sample{
+				Value:   lastValue,
+				Quality: quality,
+			}
+			bad++
+		}
 	}
+	return bad
+}
+
+// tagSeries возвращает полные имена рядов тега (PLC/ряд): массив
+// раскладывается на ряды по элементам, структура — по членам.
+// Вызывается под s.mu.
+func (s *CollectorService) tagSeries(tagName string, tagConfig config.TagConfig, tags map[string]interface{}) []string {
+	if tagConfig.IsStruct() {
+		return s.structSeries(tagConfig.PLC, tagName, tags)
+	}
+	var series []string
+	for _, seriesName := range config.TagSeries(tagName, tagConfig) {
+		series = append(series, fmt.Sprintf("%s/%s", tagConfig.PLC, seriesName))
+	}
+	return series
+}
 
-	logging.Debug("Записано успешно в TSDB:", "кол-во тегов", len(tags), "время", timestamp)
+// structSeries возвращает ряды структуры: прочитанные в этом цикле и
+// известные по прошлым циклам. Пока структура ни разу не прочитана,
+// её ряды неизвестны и значения с плохим качеством не записываются.
+// Вызывается под s.mu.
+func (s *CollectorService) structSeries(plcName, tagName string, tags map[string]interface{}) []string {
+	prefix := fmt.Sprintf("%s/%s.", plcName, tagName)
+	seen := make(map[string]bool)
+	var series []string
+	for _, source := range []map[string]interface{}{tags, s.lastValues} {
+		for fullTagName := range source {
+			if strings.HasPrefix(fullTagName, prefix) && !seen[fullTagName] {
+				seen[fullTagName] = true
+				series = append(series, fullTagName)
+			}
+		}
+	}
+	return series
 }
 
+// WriteTags записывает уставки в ПЛК от имени user, см. plc.PLCManager.WriteTags
+func (s *CollectorService) WriteTags(ctx context.Context, user string, values map[string]float64) map[string]error {
+	return s.plcManager.WriteTags(ctx, user, values)
+}
+
+// Stop останавливает сервис; Start дописывает очередь и закрывает БД
 func (s *CollectorService) Stop() {
 	close(s.stopChan)
-	s.dbClient.Close()
 }
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/opcua"
+)
+
+// Неизменившееся значение OPC UA с прежней меткой источника остаётся
+// хорошим в каждом цикле и записывается в БД один раз
+func TestCollectUnchangedOPCUAValue(t *testing.T) {
+	for _, subscribe := range []bool{false, true} {
+		name := "poll"
+		if subscribe {
+			name = "subscribe"
+		}
+		t.Run(name, func(t *testing.T) {
+			server := opcua.NewServer()
+			node := opcua.StringNodeID(2, "Line1.Speed")
+			if err := server.AddVariable(node, "Speed", float64(1450)); err != nil {
+				t.Fatalf("AddVariable: %v", err)
+			}
+			sourceTime := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+			server.SetValue(node, opcua.DataValue{Value: float64(1450), SourceTimestamp: sourceTime})
+			if err := server.Listen("127.0.0.1:0"); err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer server.Close()
+
+			plcConfig := config.PLCConfig{Driver: config.DriverOPCUA, Endpoint: server.Endpoint(), Subscribe: subscribe}
+			if subscribe {
+				plcConfig.PublishInterval = 20 * time.Millisecond
+			}
+			cfg := &config.Config{
+				PLCs:     map[string]config.PLCConfig{"LINE1": plcConfig},
+				Tags:     map[string]config.TagConfig{"Speed": {PLC: "LINE1", Type: "LREAL", Address: node.String()}},
+				Database: config.DatabaseConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "data")},
+				Polling:  config.PollingConfig{Interval: time.Second, Timeout: time.Second},
+			}
+			s, err := NewCollectorService(cfg)
+			if err != nil {
+				t.Fatalf("NewCollectorService: %v", err)
+			}
+			defer s.dbClient.Close()
+			s.plcManager.Connect()
+			defer s.plcManager.Disconnect()
+
+			scanClass, _ := cfg.GetScanClass(config.DefaultScanClass)
+			for cycle := 0; cycle < 3; cycle++ {
+				s.collectData("LINE1", config.DefaultScanClass, scanClass, time.Time{}, 0)
+				batch := <-s.queue
+				for _, point := range batch.points {
+					if point.Tag != "LINE1/Speed" {
+						continue
+					}
+					if _, quality, _ := database.ToNumeric(point.Value); quality != database.QualityGood {
+						t.Errorf("цикл %d: качество %s, ожидалось %s", cycle, quality, database.QualityGood)
+					}
+					if !point.Timestamp.Equal(sourceTime) {
+						t.Errorf("цикл %d: метка %v, ожидалась метка источника %v", cycle, point.Timestamp, sourceTime)
+					}
+				}
+				if err := s.dbClient.Write(context.Background(), batch.points); err != nil {
+					t.Fatalf("цикл %d: Write: %v", cycle, err)
+				}
+				time.Sleep(50 * time.Millisecond) // Цикл подписки без новых уведомлений
+			}
+
+			rows, err := s.dbClient.(*database.SQLiteClient).GetRecentData([]string{"LINE1/Speed"}, 10, database.AnyQuality())
+			if err != nil {
+				t.Fatalf("GetRecentData: %v", err)
+			}
+			if len(rows) != 1 || rows[0].Quality != database.QualityGood || rows[0].Value != 1450 {
+				t.Errorf("записи %+v, ожидалась одна хорошая точка 1450", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"plc_tsdb/internal/config"
+	"plc_tsdb/internal/database"
+)
+
+// reportedValue последнее записанное в БД значение ряда
+type reportedValue struct {
+	value   float64
+	quality database.Quality
+	time    time.Time
+}
+
+// filterExceptions убирает из результата чтения значения тегов с записью
+// по исключению, которые не вышли за зону нечувствительности. Значение
+// записывается, если это первое значение ряда, изменилось качество, изменение
+// больше зоны или с последней записи прошло больше heartbeat. Пропущенное
+// значение по смыслу равно последнему записанному, поэтому ряд
+// восстанавливается ступенчато (см. GetDataForTraining).
+// Оставленные значения возвращаются в reported: последними записанными они
+// становятся только после успешной записи в БД (см. commitReported), иначе
+// потерянное значение подавляло бы следующие без изменений.
+// Возвращает также число незаписанных значений.
+func (s *CollectorService) filterExceptions(plcName, scanClass string, tags map[string]interface{}, timestamp time.Time) (reported map[string]reportedValue, suppressed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tagName, tagConfig := range s.config.Tags {
+		if tagConfig.PLC != plcName || tagConfig.TagScanClass() != scanClass || !tagConfig.ReportByException() {
+			continue
+		}
+
+		for _, fullTagName := range s.tagSeries(tagName, tagConfig, tags) {
+			value, ok := tags[fullTagName]
+			if !ok {
+				continue
+			}
+			numericValue, quality, _ := database.ToNumeric(value)
+
+			last, wasReported := s.lastReported[fullTagName]
+			if wasReported && !exceedsDeadband(tagConfig, last, numericValue, quality, timestamp) {
+				delete(tags, fullTagName)
+				suppressed++
+				continue
+			}
+			if reported == nil {
+				reported = make(map[string]reportedValue)
+			}
+			reported[fullTagName] = reportedValue{value: numericValue, quality: quality, time: timestamp}
+		}
+	}
+	return reported, suppressed
+}
+
+// commitReported запоминает значения, записанные в БД, как последние
+// записанные. Пока цикл ждёт в очереди, следующие циклы сравниваются с
+// прежними значениями и могут записать лишнюю точку, но не потерять её.
+func (s *CollectorService) commitReported(reported map[string]reportedValue) {
+	if len(reported) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for series, value := range reported {
+		s.lastReported[series] = value
+	}
+}
+
+// exceedsDeadband решает, нужно ли записать новое значение
+func exceedsDeadband(tagConfig config.TagConfig, last reportedValue, value float64, quality database.Quality, timestamp time.Time) bool {
+	if quality != last.quality {
+		return true
+	}
+	if tagConfig.Heartbeat > 0 && timestamp.Sub(last.time) >= tagConfig.Heartbeat {
+		return true
+	}
+
+	// NaN (значения нет) равен только NaN
+	if math.IsNaN(value) || math.IsNaN(last.value) {
+		return math.IsNaN(value) != math.IsNaN(last.value)
+	}
+
+	deadband := tagConfig.DeadbandFor(last.value)
+	if deadband == 0 {
+		return value != last.value // Только heartbeat: пишем любое изменение
+	}
+	return math.Abs(value-last.value) > deadband
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"plc_tsdb/internal/database"
+	"plc_tsdb/internal/logging"
+)
+
+// collectDiagnostics читает диагностику ПЛК и ставит ряды PLC/$diag/* в
+// очередь записи. Пока ПЛК не подключен, пишется только $diag/connected.
+func (s *CollectorService) collectDiagnostics(plcName string) {
+	ctx, cancel := withTimeout(context.Background(), s.config.Polling.Timeout)
+	defer cancel()
+
+	series, acquisition, err := s.plcManager.ReadDiagnostics(ctx, plcName)
+	if err != nil {
+		logging.Warn("Диагностика ПЛК не прочитана", "PLC", plcName, "error", err)
+	}
+	if len(series) == 0 {
+		return
+	}
+
+	timestamp := acquisition.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	s.enqueue(writeBatch{plcName: plcName, points: database.PointsAt(series, timestamp)})
+}
@@ -0,0 +1,13 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"plc_tsdb/internal/logging"
+)
+
+func TestMain(m *testing.M) {
+	logging.InitStderr("error")
+	os.Exit(m.Run())
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"plc_tsdb/internal/config"
+)
+
+// nextBoundary возвращает ближайшую после t границу интервала по часам.
+// Границы отсчитываются от начала эпохи, поэтому у всех сборщиков и после
+// перезапуска они совпадают (для интервалов, на которые делятся сутки).
+func nextBoundary(t time.Time, interval time.Duration) time.Time {
+	return t.Truncate(interval).Add(interval)
+}
+
+// jitterSeries возвращает ряд, в который пишется опоздание цикла опроса
+// относительно расписания, в секундах
+func jitterSeries(plcName, scanClass string) string {
+	return fmt.Sprintf("%s/$scan/%s/jitter", plcName, scanClass)
+}
+
+// latencySeries возвращает ряд, в который пишется время обмена с ПЛК
+// (от запроса до ответа) в цикле опроса, в секундах
+func latencySeries(plcName, scanClass string) string {
+	return fmt.Sprintf("%s/$scan/%s/latency", plcName, scanClass)
+}
+
+// runAlignedPoller опрашивает теги одного ПЛК на границах интервала по часам,
+// пока не закрыт done. Если цикл не уложился в интервал, следующий
+// начинается на ближайшей ещё не прошедшей границе, а пропущенные
+// границы учитываются в статистике.
+func (s *CollectorService) runAlignedPoller(plcName, scanClass string, scanClassConfig config.ScanClassConfig, timer *scanTimer, done <-chan struct{}) {
+	interval := scanClassConfig.Interval
+	scheduled := nextBoundary(time.Now(), interval)
+
+	wait := time.NewTimer(time.Until(scheduled))
+	defer wait.Stop()
+
+	for {
+		select {
+		case <-wait.C:
+		case <-done:
+			return
+		}
+
+		jitter := time.Since(scheduled)
+		timer.recordJitter(jitter)
+		read := s.collectData(plcName, scanClass, scanClassConfig, scheduled, jitter)
+		timer.recordCycle(scheduled, read, time.Since(scheduled))
+
+		scheduled = nextBoundary(time.Now(), interval)
+		wait.Reset(time.Until(scheduled))
+	}
+}
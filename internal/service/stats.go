@@ -0,0 +1,201 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"plc_tsdb/internal/logging"
+)
+
+// statsWindow число последних циклов, по которым считается статистика длительностей
+const statsWindow = 1000
+
+// defaultStatsInterval интервал вывода статистики в лог, если polling.stats_interval не задан
+const defaultStatsInterval = time.Minute
+
+// TimingSummary статистика длительностей за последние циклы
+type TimingSummary struct {
+	Count int // Число измерений в окне
+	Min   time.Duration
+	Avg   time.Duration
+	Max   time.Duration
+	P99   time.Duration
+}
+
+// ScanStats снимок статистики опроса одного ПЛК в одном классе опроса
+type ScanStats struct {
+	PLC       string
+	ScanClass string
+	Interval  time.Duration
+
+	Cycles   uint64 // Выполнено циклов
+	Overruns uint64 // Циклов дольше интервала
+	Skipped  uint64 // Пропущенных тактов таймера
+
+	Read   TimingSummary // Длительность чтения из ПЛК
+	Write  TimingSummary // Длительность записи цикла в БД
+	Jitter TimingSummary // Опоздание начала цикла относительно расписания (polling.align)
+}
+
+// durationWindow кольцевой буфер последних длительностей
+type durationWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *durationWindow) add(d time.Duration) {
+	if len(w.samples) < statsWindow {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % statsWindow
+}
+
+func (w *durationWindow) summary() TimingSummary {
+	if len(w.samples) == 0 {
+		return TimingSummary{}
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	p99 := (len(sorted)*99 + 99) / 100 // Ближайший ранг
+	return TimingSummary{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Avg:   total / time.Duration(len(sorted)),
+		Max:   sorted[len(sorted)-1],
+		P99:   sorted[p99-1],
+	}
+}
+
+// scanTimer собирает статистику опроса одного ПЛК в одном классе опроса
+type scanTimer struct {
+	mu       sync.Mutex
+	stats    ScanStats
+	lastTick time.Time
+	read     durationWindow
+	write    durationWindow
+	jitter   durationWindow
+}
+
+func newScanTimer(plcName, scanClass string, interval time.Duration) *scanTimer {
+	return &scanTimer{stats: ScanStats{PLC: plcName, ScanClass: scanClass, Interval: interval}}
+}
+
+// recordCycle учитывает цикл, запущенный тактом tick. Ticker отбрасывает
+// такты, пока цикл не завершён, поэтому пропуски видны по разрыву между
+// временами соседних тактов. read < 0 — чтение не выполнялось.
+func (t *scanTimer) recordCycle(tick time.Time, read, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.Cycles++
+	if !t.lastTick.IsZero() {
+		gap := float64(tick.Sub(t.lastTick)) / float64(t.stats.Interval)
+		if missed := int64(gap+0.5) - 1; missed > 0 {
+			t.stats.Skipped += uint64(missed)
+		}
+	}
+	t.lastTick = tick
+
+	if elapsed > t.stats.Interval {
+		t.stats.Overruns++
+	}
+	if read >= 0 {
+		t.read.add(read)
+	}
+}
+
+// recordJitter учитывает опоздание начала цикла относительно расписания
+func (t *scanTimer) recordJitter(d time.Duration) {
+	t.mu.Lock()
+	t.jitter.add(d)
+	t.mu.Unlock()
+}
+
+// recordWrite учитывает длительность записи цикла в БД
+func (t *scanTimer) recordWrite(d time.Duration) {
+	t.mu.Lock()
+	t.write.add(d)
+	t.mu.Unlock()
+}
+
+func (t *scanTimer) snapshot() ScanStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats
+	stats.Read = t.read.summary()
+	stats.Write = t.write.summary()
+	stats.Jitter = t.jitter.summary()
+	return stats
+}
+
+// statsKey ключ статистики опроса ПЛК в классе опроса
+func statsKey(plcName, scanClass string) string {
+	return plcName + "/" + scanClass
+}
+
+// ScanStats возвращает статистику опроса по всем ПЛК и классам опроса
+func (s *CollectorService) ScanStats() []ScanStats {
+	result := make([]ScanStats, 0, len(s.timers))
+	for _, timer := range s.timers {
+		result = append(result, timer.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PLC != result[j].PLC {
+			return result[i].PLC < result[j].PLC
+		}
+		return result[i].ScanClass < result[j].ScanClass
+	})
+	return result
+}
+
+// logScanStats выводит статистику опроса в лог каждые interval, пока не закрыт done.
+// Счётчики накапливаются с запуска сервиса.
+func (s *CollectorService) logScanStats(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := make(map[string]ScanStats)
+	for {
+		select {
+		case <-ticker.C:
+			for _, stats := range s.ScanStats() {
+				key := statsKey(stats.PLC, stats.ScanClass)
+				prev := previous[key]
+				previous[key] = stats
+
+				logArgs := []any{"PLC", stats.PLC, "класс", stats.ScanClass, "циклов", stats.Cycles,
+					"превышений", stats.Overruns, "пропущено", stats.Skipped,
+					"чтение min/avg/max/p99", formatTiming(stats.Read),
+					"запись min/avg/max/p99", formatTiming(stats.Write)}
+				if stats.Jitter.Count > 0 {
+					logArgs = append(logArgs, "опоздание min/avg/max/p99", formatTiming(stats.Jitter))
+				}
+				// Предупреждаем, только если с прошлого вывода были превышения
+				if stats.Overruns > prev.Overruns || stats.Skipped > prev.Skipped {
+					logging.Warn("Статистика опроса", logArgs...)
+				} else {
+					logging.Info("Статистика опроса", logArgs...)
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func formatTiming(t TimingSummary) string {
+	if t.Count == 0 {
+		return "-"
+	}
+	round := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return round(t.Min).String() + "/" + round(t.Avg).String() + "/" + round(t.Max).String() + "/" + round(t.P99).String()
+}
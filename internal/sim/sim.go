@@ -0,0 +1,202 @@
+// Package sim — генераторы значений для драйвера sim пакета plc: периодические
+// сигналы, случайные процессы и отказы датчиков. Случайные величины берутся из
+// генератора с заданным зерном, поэтому при одинаковых зерне и моментах чтения
+// последовательность значений повторяется.
+package sim
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+
+	"plc_tsdb/internal/config"
+)
+
+// Seed выводит зерно ряда из зерна ПЛК и имени ряда: у элементов массива и
+// у разных тегов одного ПЛК последовательности различаются
+func Seed(base int64, series string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(series))
+	return base ^ int64(h.Sum64())
+}
+
+// Generator источник значений одного ряда. Не безопасен для одновременного
+// использования из нескольких горутин.
+type Generator struct {
+	cfg    config.SimConfig
+	values *rand.Rand // Значения случайных генераторов и шум
+	faults *rand.Rand // Моменты отказов: не зависят от числа прочитанных значений
+
+	last      time.Time // Время предыдущего значения; нулевое — значений ещё не было
+	level     float64   // Текущее значение random_walk и step
+	nextStep  time.Time // Время следующего скачка step
+	lastValue float64   // Последнее выданное значение, на нём залипает stuck
+
+	stuck, flatline, dropout fault
+}
+
+// fault расписание одного вида отказа: [start, end) — ближайший или текущий
+type fault struct {
+	cfg        *config.SimFaultConfig
+	start, end time.Time
+}
+
+// New создаёт генератор; start — момент, от которого отсчитываются отказы
+func New(cfg config.SimConfig, seed int64, start time.Time) *Generator {
+	g := &Generator{
+		cfg:      cfg,
+		values:   rand.New(rand.NewSource(seed)),
+		faults:   rand.New(rand.NewSource(seed + 1)),
+		stuck:    fault{cfg: cfg.Stuck},
+		flatline: fault{cfg: cfg.Flatline},
+		dropout:  fault{cfg: cfg.Dropout},
+	}
+	for _, f := range []*fault{&g.stuck, &g.flatline, &g.dropout} {
+		g.schedule(f, start)
+	}
+	return g
+}
+
+// Next возвращает значение на момент t. ok=false — значение пропало
+// (отказ dropout), тег в этом цикле не читается. Значение с шумом не выходит
+// за [min, max]: скорость насоса не бывает отрицательной; обрыв flatline
+// может задать значение вне диапазона.
+func (g *Generator) Next(t time.Time) (value float64, ok bool) {
+	value = g.base(t)
+	if g.cfg.Noise > 0 {
+		value += g.values.NormFloat64() * g.cfg.Noise
+		value = math.Max(g.cfg.Min, math.Min(g.cfg.Max, value))
+	}
+	g.last = t
+
+	switch {
+	case g.active(&g.dropout, t):
+		return 0, false
+	case g.active(&g.flatline, t):
+		value = g.cfg.Flatline.Value
+	case g.active(&g.stuck, t):
+		value = g.lastValue
+	}
+	g.lastValue = value
+	return value, true
+}
+
+// base возвращает значение генератора без шума и отказов
+func (g *Generator) base(t time.Time) float64 {
+	low, high := g.cfg.Min, g.cfg.Max
+	switch g.cfg.Generator {
+	case config.SimSine:
+		return low + (high-low)*(1+math.Sin(2*math.Pi*g.phase(t)))/2
+	case config.SimRamp:
+		return low + (high-low)*g.phase(t)
+	case config.SimSquare:
+		duty := g.cfg.Duty
+		if duty == 0 {
+			duty = 0.5
+		}
+		if g.phase(t) < duty {
+			return high
+		}
+		return low
+	case config.SimNoise:
+		return low + (high-low)*g.values.Float64()
+	case config.SimRandomWalk:
+		return g.walk(t)
+	case config.SimStep:
+		return g.step(t)
+	}
+	return low
+}
+
+// phase возвращает долю периода [0, 1) на момент t. Отсчёт от эпохи Unix:
+// периодические сигналы не зависят от момента запуска.
+func (g *Generator) phase(t time.Time) float64 {
+	period := g.cfg.Period.Nanoseconds()
+	offset := (t.UnixNano() + g.cfg.Phase.Nanoseconds()) % period
+	if offset < 0 {
+		offset += period
+	}
+	return float64(offset) / float64(period)
+}
+
+// walk делает шаг случайного блуждания: приращение нормальное, его СКО
+// растёт как корень из прошедшего времени. От границ значение отражается.
+func (g *Generator) walk(t time.Time) float64 {
+	low, high := g.cfg.Min, g.cfg.Max
+	if g.last.IsZero() {
+		g.level = low + (high-low)*g.values.Float64()
+		return g.level
+	}
+	dt := t.Sub(g.last).Seconds()
+	if dt > 0 {
+		g.level += g.values.NormFloat64() * g.cfg.Step * math.Sqrt(dt)
+	}
+	for high > low && (g.level < low || g.level > high) {
+		if g.level < low {
+			g.level = 2*low - g.level
+		}
+		if g.level > high {
+			g.level = 2*high - g.level
+		}
+	}
+	return math.Max(low, math.Min(high, g.level))
+}
+
+// step держит уровень и в случайные моменты (в среднем раз в period)
+// переключается на другой
+func (g *Generator) step(t time.Time) float64 {
+	if g.last.IsZero() {
+		g.level = g.pickLevel()
+		g.nextStep = t.Add(exponential(g.values, g.cfg.Period))
+	}
+	for !t.Before(g.nextStep) {
+		g.level = g.pickLevel()
+		g.nextStep = g.nextStep.Add(exponential(g.values, g.cfg.Period))
+	}
+	return g.level
+}
+
+// pickLevel выбирает новый уровень step, отличный от текущего, если уровней несколько
+func (g *Generator) pickLevel() float64 {
+	levels := g.cfg.Levels
+	if len(levels) == 0 {
+		return g.cfg.Min + (g.cfg.Max-g.cfg.Min)*g.values.Float64()
+	}
+	others := make([]float64, 0, len(levels))
+	for _, level := range levels {
+		if level != g.level || g.last.IsZero() {
+			others = append(others, level)
+		}
+	}
+	if len(others) == 0 {
+		return g.level
+	}
+	return others[g.values.Intn(len(others))]
+}
+
+// active сообщает, идёт ли отказ в момент t, и планирует следующий после окончания
+func (g *Generator) active(f *fault, t time.Time) bool {
+	if f.cfg == nil {
+		return false
+	}
+	for !t.Before(f.end) {
+		g.schedule(f, f.end)
+	}
+	return !t.Before(f.start)
+}
+
+// schedule планирует отказ через случайный интервал после from
+func (g *Generator) schedule(f *fault, from time.Time) {
+	if f.cfg == nil {
+		return
+	}
+	f.start = from.Add(exponential(g.faults, f.cfg.Every))
+	f.end = f.start.Add(f.cfg.Duration)
+}
+
+// exponential возвращает экспоненциально распределённый интервал со средним mean:
+// события потока происходят независимо друг от друга
+func exponential(r *rand.Rand, mean time.Duration) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(mean))
+}